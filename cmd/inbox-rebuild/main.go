@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-im/internal/infra"
+	"go-im/internal/repository"
+	"go-im/internal/service"
+)
+
+// inbox-rebuild 从 MySQL timeline_message 回放消息，重建 Redis 中的 im:inbox:* 信箱。
+//
+// 用法示例：
+//
+//	go run ./cmd/inbox-rebuild -user alice
+//	go run ./cmd/inbox-rebuild -conv private_alice_bob -window 72h
+//	go run ./cmd/inbox-rebuild -all -qps 5 -progress /tmp/rebuild.json
+//	go run ./cmd/inbox-rebuild -all -dry-run
+func main() {
+	var (
+		userID       = flag.String("user", "", "只重建该用户的 Inbox")
+		convID       = flag.String("conv", "", "只重建该会话涉及的 Inbox")
+		all          = flag.Bool("all", false, "重建时间窗口内的全部 Inbox")
+		window       = flag.Duration("window", 7*24*time.Hour, "回放最近多长时间的消息（与 Inbox TTL 保持一致）")
+		batch        = flag.Int("batch", 500, "单批扫描条数")
+		qps          = flag.Float64("qps", 10, "每秒最多查询 MySQL 的批次数，<=0 表示不限")
+		dryRun       = flag.Bool("dry-run", false, "只统计将写入的条数，不写 Redis")
+		progressFile = flag.String("progress", "", "进度文件路径，中断后以相同 -user/-conv 重跑可续跑，完成后自动删除")
+		keyPrefix    = flag.String("prefix", "im:inbox:", "Inbox key 前缀")
+		ttl          = flag.Duration("ttl", 7*24*time.Hour, "Inbox TTL")
+		readThresh   = flag.Int("read-threshold", service.DefaultReadDiffusionThreshold, "群聊读扩散阈值，需与服务端 IM_READ_DIFFUSION_THRESHOLD 一致")
+	)
+	flag.Parse()
+
+	if *userID == "" && *convID == "" && !*all {
+		log.Fatalf("必须指定 -user、-conv 或 -all 之一")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := repository.NewDB()
+	if err != nil {
+		log.Fatalf("连接数据库失败: %v", err)
+	}
+	redisClient := infra.NewRedisClient()
+	if err := infra.PingRedis(ctx, redisClient); err != nil {
+		log.Fatalf("Redis 未就绪: %v", err)
+	}
+
+	filter := repository.MessageScanFilter{
+		ConversationID: *convID,
+		UserID:         *userID,
+	}
+	if *window > 0 {
+		filter.SinceMs = time.Now().Add(-*window).UnixMilli()
+	}
+
+	var interval time.Duration
+	if *qps > 0 {
+		interval = time.Duration(float64(time.Second) / *qps)
+	}
+
+	inbox := service.NewRedisInboxWriter(redisClient, *keyPrefix, *ttl)
+	rebuilder := service.NewInboxRebuilder(repository.NewMessageRepository(db), inbox, service.InboxRebuildOptions{
+		BatchSize: *batch,
+		Interval:  interval,
+		DryRun:    *dryRun,
+
+		ReadDiffusionThreshold: *readThresh,
+	})
+	registry := service.NewConversationRegistry(repository.NewConversationRepository(db), repository.NewGroupRepository(db))
+	// 只读解析：未登记的旧会话只推断参与者，不写 conversation 表，-dry-run 不产生任何写入
+	rebuilder.WithResolver(service.NewCachedResolver(registry.ReadOnly(), 10*time.Minute, 0))
+	if *progressFile != "" {
+		rebuilder.WithProgressStore(fileProgressStore{path: *progressFile})
+	}
+
+	start := time.Now()
+	progress, err := rebuilder.Run(ctx, filter)
+	log.Printf("扫描 %d 条消息，写入 %d 个 Inbox 条目，last_id=%d，耗时 %s（dry-run=%v）",
+		progress.Scanned, progress.Written, progress.LastID, time.Since(start).Round(time.Millisecond), *dryRun)
+	if err != nil {
+		log.Fatalf("重建中断: %v", err)
+	}
+}
+
+// fileProgressStore 将进度以 JSON 形式保存在本地文件中。
+type fileProgressStore struct {
+	path string
+}
+
+func (s fileProgressStore) Load() (service.RebuildProgress, error) {
+	var p service.RebuildProgress
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+func (s fileProgressStore) Save(p service.RebuildProgress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免进程中断留下半截文件
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s fileProgressStore) Clear() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -39,10 +41,17 @@ func main() {
 		consumerCancel context.CancelFunc
 	)
 
+	node := nodeID()
 	connManager := service.NewConnectionManager()
+	expvar.Publish("im_connections", expvar.Func(func() interface{} {
+		return map[string]int64{"users": connManager.OnlineUsers(), "sessions": connManager.OnlineSessions()}
+	}))
 	msgRepo := repository.NewMessageRepository(db)
 	seqGen := service.NewRedisSeqGenerator(redisClient, "im:seq:")
-	inbox := service.NewRedisInboxWriter(redisClient, "im:inbox:", 7*24*time.Hour)
+	inbox := service.NewRedisInboxWriter(redisClient, "im:inbox:", 7*24*time.Hour).
+		WithMaxLen(int64(envInt("IM_INBOX_MAX_LEN", 1000)))
+	recentCache := service.NewRedisRecentCache(redisClient, "im:recent:", int64(envInt("IM_RECENT_CACHE_SIZE", 200)), 7*24*time.Hour)
+	convIndex := service.NewRedisConversationIndex(redisClient, "im:conv:", "im:conv_groups", int64(envInt("IM_CONV_INDEX_MAX_LEN", 1000)))
 	retryer := service.NewAsyncInboxRetryer(inbox, service.InboxRetryOptions{
 		QueueSize:   2048,
 		MaxAttempts: 8,
@@ -50,7 +59,42 @@ func main() {
 		MaxBackoff:  5 * time.Second,
 		Timeout:     2 * time.Second,
 	})
-	msgSvc := service.NewMessageServiceWithSeq(msgRepo, seqGen).WithInbox(inbox).WithInboxRetryer(retryer)
+	groupRepo := repository.NewGroupRepository(db)
+	convRegistry := service.NewConversationRegistry(repository.NewConversationRepository(db), groupRepo).WithGroupRoles(groupRepo)
+	mentionRepo := repository.NewMentionRepository(db)
+	// 参与者解析结果进程内缓存 30s，权限校验与扩散不必每条消息查库；本节点的成员变更立即失效
+	participants := service.NewCachedResolver(convRegistry, 30*time.Second, 10000)
+	convRegistry.WithInvalidator(participants)
+	// 推送送达跟踪：5s 未确认重发，最多重发 3 次
+	tracker := service.NewDeliveryTracker(msgRepo, service.DeliveryOptions{Timeout: 5 * time.Second, MaxRetries: 3})
+	pushSvc := service.NewPushService(connManager).WithDeliveryTracker(tracker, connManager)
+	tracker.WithPusher(pushSvc)
+	// 多节点部署：连接所在节点登记在 im:route:{user_id}，推送经 Redis 频道 im:node:{node_id} 转发到目标节点
+	routeRegistry := service.NewRedisRouteRegistry(redisClient, "im:route:", node, 10*time.Minute)
+	nodeBus := service.NewRedisNodeBus(redisClient, "im:node:")
+	pushSvc.WithRouter(routeRegistry, nodeBus, node)
+	pushCtx, pushCancel := context.WithCancel(context.Background())
+	if err := pushSvc.Run(pushCtx); err != nil {
+		log.Fatalf("订阅节点推送频道失败: %v", err)
+	}
+	readThreshold := envInt("IM_READ_DIFFUSION_THRESHOLD", service.DefaultReadDiffusionThreshold)
+	msgSvc := service.NewMessageServiceWithSeq(msgRepo, seqGen).WithInbox(inbox).WithInboxRetryer(retryer).WithRecentCache(recentCache).
+		WithConversationRegistry(participants).
+		WithRecall(msgRepo, time.Duration(envInt("IM_RECALL_WINDOW_SEC", 120))*time.Second).
+		WithGroupRoles(groupRepo).
+		WithEditStore(msgRepo).
+		WithReactionStore(repository.NewReactionRepository(db)).
+		WithMentions(mentionRepo).
+		WithPusher(pushSvc).
+		WithConversationIndex(convIndex).
+		WithReadDiffusionThreshold(readThreshold)
+	// 输入中等瞬时信令：3s 内重复 start 只续期，6s 未收到 stop 自动过期；读扩散大群不转发
+	signalSvc := service.NewSignalService(msgSvc, pushSvc, service.SignalOptions{MaxFanout: readThreshold})
+	pullRepo := repository.NewPullRepository(db)
+	convSvc := service.NewConversationService(convIndex, pullRepo).WithMentionCounter(mentionRepo).WithUserGroups(groupRepo)
+	pullSvc := service.NewPullService(pullRepo).WithInbox(inbox).WithRecentCache(recentCache).WithSeqReader(seqGen).
+		WithMessageFinder(msgRepo).WithAuthorizer(msgSvc).WithRecentConversations(convSvc)
+	receiptSvc := service.NewReceiptService(repository.NewReceiptRepository(db), participants).WithPusher(pushSvc)
 
 	// 初始化 RabbitMQ（可通过 IM_USE_RMQ=0 关闭；默认启用，失败直接退出）
 	var producer *service.MessageProducer
@@ -89,14 +133,44 @@ func main() {
 		log.Printf("已关闭 RabbitMQ，使用直落库路径")
 	}
 
-	wsHandler := handler.NewWebSocketHandler(connManager, msgSvc).WithProducer(producer)
+	// 在线状态：连接心跳 3 分钟未刷新视为掉线，断开 5s 内重连不通知订阅者
+	presenceStore := service.NewRedisPresenceStore(redisClient, "im:presence:", "im:presence:events", 3*time.Minute)
+	// 状态变化已广播到每个节点，各节点只推送给本地订阅者
+	presenceSvc := service.NewPresenceService(presenceStore, connManager, node, service.PresenceOptions{}).
+		WithPusher(pushSvc.Local()).WithBus(presenceStore)
+	presenceCtx, presenceCancel := context.WithCancel(context.Background())
+	if err := presenceSvc.Run(presenceCtx); err != nil {
+		log.Fatalf("订阅在线状态事件失败: %v", err)
+	}
+
+	wsHandler := handler.NewWebSocketHandler(connManager, msgSvc).WithProducer(producer).WithPullService(pullSvc).
+		WithConversationService(convSvc).WithConversationRegistry(convRegistry).WithReceiptService(receiptSvc).WithDeliveryTracker(tracker).
+		WithSignalService(signalSvc).WithPresenceService(presenceSvc).WithRouteRegistry(routeRegistry)
+	restHandler := handler.NewRESTHandler(pullSvc).WithConversationService(convSvc).WithConversationRegistry(convRegistry).
+		WithReceiptService(receiptSvc).WithMessageService(msgSvc).WithMentionService(service.NewMentionService(mentionRepo)).
+		WithPresenceService(presenceSvc).WithProducer(producer)
 
 	// 初始化 Gin，引入基础日志与 panic 恢复
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery())
 
-	// WebSocket 路由；REST API 可在 /api 组下扩展
+	// WebSocket 路由；REST API 在 /api 组下扩展
 	router.GET("/ws", wsHandler.HandleWebSocket)
+	// WebSocket 被拦截时的备用传输：SSE 下行 + HTTP POST 上行
+	router.GET("/sse", wsHandler.HandleSSE)
+	router.POST("/sse/:session_id", wsHandler.HandleSSESend)
+	restHandler.Register(router.Group("/api"))
+	// 运维接口：未配置 IM_ADMIN_TOKEN 时不开放
+	if token := os.Getenv("IM_ADMIN_TOKEN"); token != "" {
+		// 踢下线与系统通知经 im:node:admin:{node_id} 转发到用户所在节点
+		adminSvc := service.NewAdminService(connManager).WithDeliveryTracker(tracker).WithCluster(routeRegistry, nodeBus, node)
+		if err := adminSvc.Run(pushCtx); err != nil {
+			log.Fatalf("订阅运维频道失败: %v", err)
+		}
+		handler.NewAdminHandler(adminSvc, connManager, node, token).Register(router.Group("/admin"))
+	} else {
+		log.Printf("未配置 IM_ADMIN_TOKEN，运维接口未开放")
+	}
 
 	httpServer := &http.Server{
 		Addr:    serverAddr,
@@ -136,6 +210,10 @@ func main() {
 	if retryer != nil {
 		retryer.Stop()
 	}
+	tracker.Stop()
+	signalSvc.Stop()
+	presenceCancel()
+	pushCancel()
 	log.Println("服务已关闭")
 }
 
@@ -144,3 +222,24 @@ func mqEnabled() bool {
 	val := strings.ToLower(os.Getenv("IM_USE_RMQ"))
 	return val == "" || val == "1" || val == "true" || val == "yes"
 }
+
+// nodeID 返回当前网关节点标识（IM_NODE_ID，缺省为主机名），用于区分多节点上的连接。
+func nodeID() string {
+	if v := os.Getenv("IM_NODE_ID"); v != "" {
+		return v
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "node-1"
+}
+
+// envInt 读取整数型环境变量，缺省或非法时返回 def。
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			return parsed
+		}
+	}
+	return def
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-im/internal/service"
+)
+
+const (
+	adminListDefault = 100
+	adminListMax     = 1000
+)
+
+// AdminHandler 提供 /admin 下的运维接口，请求需携带 Authorization: Bearer {token}。
+type AdminHandler struct {
+	adminSvc *service.AdminService
+	conns    *service.ConnectionManager
+	nodeID   string
+	token    string
+}
+
+// NewAdminHandler 创建运维接口 Handler；token 为空时拒绝所有请求。
+func NewAdminHandler(adminSvc *service.AdminService, conns *service.ConnectionManager, nodeID, token string) *AdminHandler {
+	return &AdminHandler{adminSvc: adminSvc, conns: conns, nodeID: nodeID, token: token}
+}
+
+// Register 在 group 上注册运维路由并启用令牌校验。
+func (h *AdminHandler) Register(group *gin.RouterGroup) {
+	group.Use(h.authenticate)
+	group.GET("/connections", h.ListConnections)
+	group.GET("/connections/:user_id", h.GetConnections)
+	group.POST("/connections/:user_id/kick", h.Kick)
+	group.POST("/broadcast", h.Broadcast)
+	// 运行指标（如最近消息缓存命中率 im_recent_cache_hit_rate），与运维接口一样需要令牌
+	group.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+}
+
+// authenticate 校验管理令牌，使用常量时间比较。
+func (h *AdminHandler) authenticate(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	c.Next()
+}
+
+// ListConnections 列出本节点在线用户与设备：GET /admin/connections?limit=100
+func (h *AdminHandler) ListConnections(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = adminListDefault
+	}
+	if limit > adminListMax {
+		limit = adminListMax
+	}
+	users, truncated := h.adminSvc.ListUsers(limit)
+	c.JSON(http.StatusOK, gin.H{
+		"node_id":         h.nodeID,
+		"online_users":    h.conns.OnlineUsers(),
+		"online_sessions": h.conns.OnlineSessions(),
+		"users":           users,
+		"truncated":       truncated,
+	})
+}
+
+// GetConnections 查看用户在本节点的连接详情：GET /admin/connections/:user_id
+func (h *AdminHandler) GetConnections(c *gin.Context) {
+	sessions := h.adminSvc.Sessions(c.Param("user_id"))
+	if len(sessions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不在本节点在线"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node_id": h.nodeID, "sessions": sessions})
+}
+
+type kickRequest struct {
+	DeviceID string `json:"device_id"` // 为空时断开全部设备
+	Reason   string `json:"reason" binding:"required"`
+}
+
+// Kick 断开用户连接并推送原因，其他节点上的连接转发给所在节点断开：POST /admin/connections/:user_id/kick
+func (h *AdminHandler) Kick(c *gin.Context) {
+	var req kickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason 不能为空"})
+		return
+	}
+	result, err := h.adminSvc.Kick(c.Request.Context(), c.Param("user_id"), req.DeviceID, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转发踢下线失败: " + err.Error(), "node_id": h.nodeID, "kicked": result.Local})
+		return
+	}
+	if result.Local == 0 && len(result.Forwarded) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不在线"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node_id": h.nodeID, "kicked": result.Local, "forwarded": result.Forwarded})
+}
+
+type broadcastRequest struct {
+	Content string   `json:"content" binding:"required"`
+	UserIDs []string `json:"user_ids"` // 为空时推送给全部节点的全部连接
+}
+
+// Broadcast 推送系统通知：POST /admin/broadcast
+func (h *AdminHandler) Broadcast(c *gin.Context) {
+	var req broadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content 不能为空"})
+		return
+	}
+	result, err := h.adminSvc.Broadcast(c.Request.Context(), req.Content, req.UserIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转发系统通知失败: " + err.Error(), "node_id": h.nodeID, "sent": result.Local})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node_id": h.nodeID, "sent": result.Local, "forwarded": result.Forwarded})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-im/internal/model"
+	"go-im/internal/service"
+)
+
+// chatSender 封装发送消息的两条路径，WebSocket 与 REST 共用：
+// 注入了 MQ 生产者时校验后入队立即返回 accepted，否则直接落库返回 seq。
+type chatSender struct {
+	messageSvc *service.MessageService
+	producer   *service.MessageProducer
+}
+
+// send 发送一条消息，返回给客户端的回包；code 含义与 CmdChat 回包一致。
+// 仅直落库路径出现非预期错误时返回 error（越权、回复目标不存在等已体现在回包中）。
+func (s chatSender) send(parent context.Context, userID string, packet model.InputPacket, payload service.ChatPayload) (model.OutputPacket, error) {
+	if s.producer == nil {
+		ctx, cancel := context.WithTimeout(parent, 3*time.Second)
+		defer cancel()
+
+		out, err := s.messageSvc.HandleChat(ctx, userID, packet, payload)
+		if errors.Is(err, service.ErrForbidden) || errors.Is(err, service.ErrMessageNotFound) {
+			return out, nil
+		}
+		return out, err
+	}
+
+	msgID := packet.MsgId
+	if msgID == "" {
+		msgID = uuid.NewString()
+	}
+
+	// 入队前校验发送者权限，越权消息不进入 MQ
+	authCtx, authCancel := context.WithTimeout(parent, 3*time.Second)
+	conv, err := s.messageSvc.Authorize(authCtx, userID, packet.ConversationId)
+	authCancel()
+	if errors.Is(err, service.ErrForbidden) {
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 403, MsgId: msgID, Payload: "无权在该会话发送消息"}, nil
+	}
+	if err != nil {
+		log.Printf("解析会话失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msgID, Payload: "会话解析失败"}, nil
+	}
+	if payload.ReplyToMsgID != "" {
+		// 回复目标同样在入队前校验，避免客户端收到 accepted 后消息被消费者丢弃
+		replyCtx, replyCancel := context.WithTimeout(parent, 3*time.Second)
+		_, err := s.messageSvc.ResolveReply(replyCtx, conv, payload.ReplyToMsgID)
+		replyCancel()
+		if errors.Is(err, service.ErrMessageNotFound) {
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 404, MsgId: msgID, Payload: "回复的消息不存在"}, nil
+		}
+		if err != nil {
+			log.Printf("查询回复目标失败 user=%s reply_to=%s: %v", userID, payload.ReplyToMsgID, err)
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msgID, Payload: "查询回复目标失败"}, nil
+		}
+	}
+	if payload.MentionAll && conv.Type == model.ConversationTypeGroup {
+		mentionCtx, mentionCancel := context.WithTimeout(parent, 3*time.Second)
+		err := s.messageSvc.CanMentionAll(mentionCtx, conv, userID)
+		mentionCancel()
+		if errors.Is(err, service.ErrForbidden) {
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 403, MsgId: msgID, Payload: "无权 @所有人"}, nil
+		}
+		if err != nil {
+			log.Printf("查询群角色失败 user=%s conv=%s: %v", userID, conv.ID, err)
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msgID, Payload: "查询群角色失败"}, nil
+		}
+	}
+	event := service.ChatEvent{
+		MsgID:          msgID,
+		ConversationID: conv.ID,
+		SenderID:       userID,
+		Content:        payload.Content,
+		MsgType:        payload.MsgType,
+		SendTime:       payload.SendTime,
+		ReplyToMsgID:   payload.ReplyToMsgID,
+		InThread:       payload.InThread,
+		Mentions:       payload.Mentions,
+		MentionAll:     payload.MentionAll,
+	}
+
+	ctx, cancel := context.WithTimeout(parent, 3*time.Second)
+	defer cancel()
+
+	if err := s.producer.PublishChat(ctx, event); err != nil {
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msgID, Payload: "MQ 发布失败"}, nil
+	}
+	return model.OutputPacket{Cmd: model.CmdChat, Code: 0, MsgId: msgID, Payload: "accepted"}, nil
+}
@@ -0,0 +1,586 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"go-im/internal/model"
+	"go-im/internal/service"
+)
+
+// RESTHandler 提供 /api 下的 HTTP 接口，与 WebSocket 指令共用同一套 service。
+type RESTHandler struct {
+	pullSvc     *service.PullService
+	convSvc     *service.ConversationService
+	registry    *service.ConversationRegistry
+	receiptSvc  *service.ReceiptService
+	messageSvc  *service.MessageService
+	mentionSvc  *service.MentionService
+	presenceSvc *service.PresenceService
+	producer    *service.MessageProducer
+}
+
+// NewRESTHandler 创建 REST Handler。
+func NewRESTHandler(pullSvc *service.PullService) *RESTHandler {
+	return &RESTHandler{pullSvc: pullSvc}
+}
+
+// WithConversationService 注入会话列表服务，启用 GET /conversations。
+func (h *RESTHandler) WithConversationService(convSvc *service.ConversationService) *RESTHandler {
+	h.convSvc = convSvc
+	return h
+}
+
+// WithConversationRegistry 注入会话注册表，启用会话创建与元数据查询接口。
+func (h *RESTHandler) WithConversationRegistry(registry *service.ConversationRegistry) *RESTHandler {
+	h.registry = registry
+	return h
+}
+
+// WithReceiptService 注入已读回执服务，启用已读位点与已读列表查询。
+func (h *RESTHandler) WithReceiptService(receiptSvc *service.ReceiptService) *RESTHandler {
+	h.receiptSvc = receiptSvc
+	return h
+}
+
+// WithMessageService 注入消息服务，启用消息历史版本与表情回应查询。
+func (h *RESTHandler) WithMessageService(messageSvc *service.MessageService) *RESTHandler {
+	h.messageSvc = messageSvc
+	return h
+}
+
+// WithProducer 注入 MQ 生产者，POST 发送消息与 WebSocket 一样走“先入队再处理”的路径。
+func (h *RESTHandler) WithProducer(producer *service.MessageProducer) *RESTHandler {
+	h.producer = producer
+	return h
+}
+
+// WithMentionService 注入提及服务，启用“@我的”查询。
+func (h *RESTHandler) WithMentionService(mentionSvc *service.MentionService) *RESTHandler {
+	h.mentionSvc = mentionSvc
+	return h
+}
+
+// WithPresenceService 注入在线状态服务，启用批量状态查询。
+func (h *RESTHandler) WithPresenceService(presenceSvc *service.PresenceService) *RESTHandler {
+	h.presenceSvc = presenceSvc
+	return h
+}
+
+// Register 在给定路由组（通常为 /api）下注册接口。
+func (h *RESTHandler) Register(api *gin.RouterGroup) {
+	api.GET("/conversations/:id/messages/around", h.GetMessagesAround)
+	api.GET("/conversations/:id/messages/:msg_id/thread", h.GetThread)
+	if h.convSvc != nil {
+		api.GET("/conversations", h.ListConversations)
+	}
+	if h.registry != nil {
+		api.POST("/conversations", h.CreateConversation)
+		api.GET("/conversations/:id", h.GetConversation)
+		api.POST("/conversations/:id/members", h.AddMembers)
+		api.DELETE("/conversations/:id/members/:member_id", h.RemoveMember)
+	}
+	if h.receiptSvc != nil {
+		api.GET("/conversations/:id/read-state", h.GetReadState)
+		api.GET("/conversations/:id/readers", h.ListReaders)
+	}
+	if h.presenceSvc != nil {
+		api.GET("/presence", h.GetPresence)
+	}
+	if h.mentionSvc != nil {
+		api.GET("/mentions", h.ListMentions)
+	}
+	if h.messageSvc != nil {
+		api.POST("/conversations/:id/messages", h.SendMessage)
+		api.GET("/conversations/:id/messages", h.ListMessages)
+		api.GET("/conversations/:id/messages/:msg_id/versions", h.ListMessageVersions)
+		api.GET("/conversations/:id/messages/:msg_id/reactions", h.ListReactions)
+	}
+}
+
+// GetReadState 返回我的已读位点，单聊附带对方已读到的 seq：
+// GET /api/conversations/:id/read-state?user_id=
+func (h *RESTHandler) GetReadState(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	state, err := h.receiptSvc.ReadState(ctx, userID, h.conversationID(ctx, c.Param("id"), userID))
+	if h.writeReceiptError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// ListReaders 返回已读到指定消息的成员：
+// GET /api/conversations/:id/readers?user_id=&seq=
+func (h *RESTHandler) ListReaders(c *gin.Context) {
+	userID := c.Query("user_id")
+	seq := queryInt64(c, "seq")
+	if userID == "" || seq <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 与 seq 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	readers, err := h.receiptSvc.ListReaders(ctx, userID, h.conversationID(ctx, c.Param("id"), userID), seq)
+	if h.writeReceiptError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": seq, "readers": readers})
+}
+
+// writeReceiptError 将已读相关错误映射为 HTTP 状态码，已写响应时返回 true。
+func (h *RESTHandler) writeReceiptError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "不是会话成员"})
+	default:
+		log.Printf("查询已读信息失败 conv=%s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+	}
+	return true
+}
+
+// createConversationRequest 是 POST /conversations 的请求体：
+// type=1 时按 user_id + peer_id 创建（或返回已有）单聊，type=2 时创建群聊。
+type createConversationRequest struct {
+	Type   int8   `json:"type"`
+	UserID string `json:"user_id"`
+	PeerID string `json:"peer_id"`
+	service.GroupSpec
+}
+
+// CreateConversation 创建会话：
+// POST /api/conversations
+func (h *RESTHandler) CreateConversation(c *gin.Context) {
+	var req createConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体非法或缺少 user_id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	var (
+		conv *model.Conversation
+		err  error
+	)
+	switch req.Type {
+	case model.ConversationTypePrivate:
+		if req.PeerID == "" || req.PeerID == req.UserID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "peer_id 非法"})
+			return
+		}
+		conv, err = h.registry.EnsurePrivate(ctx, req.UserID, req.PeerID, req.UserID)
+	case model.ConversationTypeGroup:
+		req.CreatorID = req.UserID
+		if req.ConversationID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "conversation_id 不能为空"})
+			return
+		}
+		conv, err = h.registry.CreateGroup(ctx, req.GroupSpec)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type 仅支持 1(单聊) 或 2(群聊)"})
+		return
+	}
+	if err != nil {
+		log.Printf("创建会话失败 user=%s type=%d: %v", req.UserID, req.Type, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// GetConversation 查询会话元数据，旧格式单聊 ID 会先规范化：
+// GET /api/conversations/:id?user_id=
+func (h *RESTHandler) GetConversation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	id := h.conversationID(ctx, c.Param("id"), c.Query("user_id"))
+	conv, err := h.registry.Get(ctx, id)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+	if err != nil {
+		log.Printf("查询会话失败 conv=%s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+type addMembersRequest struct {
+	UserID  string   `json:"user_id"`
+	Members []string `json:"members"`
+}
+
+// AddMembers 向群聊加入成员，仅群主或管理员可操作：
+// POST /api/conversations/:id/members
+func (h *RESTHandler) AddMembers(c *gin.Context) {
+	var req addMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" || len(req.Members) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体非法或缺少 user_id / members"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	err := h.registry.AddMembers(ctx, c.Param("id"), req.UserID, req.Members)
+	if h.writeMemberError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversation_id": c.Param("id"), "added": req.Members})
+}
+
+// RemoveMember 移除群成员：群主或管理员可移除他人，成员可移除自己（退群）：
+// DELETE /api/conversations/:id/members/:member_id?user_id=
+func (h *RESTHandler) RemoveMember(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	err := h.registry.RemoveMembers(ctx, c.Param("id"), userID, []string{c.Param("member_id")})
+	if h.writeMemberError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversation_id": c.Param("id"), "removed": c.Param("member_id")})
+}
+
+// writeMemberError 将成员变更的错误映射为 HTTP 状态码，已写响应时返回 true。
+func (h *RESTHandler) writeMemberError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权变更群成员"})
+	case errors.Is(err, service.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "群聊不存在"})
+	default:
+		log.Printf("变更群成员失败 conv=%s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "变更失败"})
+	}
+	return true
+}
+
+// ListConversations 返回用户的会话列表：
+// GET /api/conversations?user_id=&cursor=&cursor_id=&limit=
+func (h *RESTHandler) ListConversations(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	page, err := h.convSvc.List(ctx, userID, queryInt64(c, "cursor"), c.Query("cursor_id"), int(queryInt64(c, "limit")))
+	if err != nil {
+		log.Printf("查询会话列表失败 user=%s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetPresence 批量查询在线状态与最后在线时间：
+// GET /api/presence?user_ids=alice,bob
+func (h *RESTHandler) GetPresence(c *gin.Context) {
+	var userIDs []string
+	for _, id := range strings.Split(c.Query("user_ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 || len(userIDs) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids 不能为空且不超过 200 个"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	statuses, err := h.presenceSvc.Get(ctx, userIDs)
+	if err != nil {
+		log.Printf("查询在线状态失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"presence": statuses})
+}
+
+// ListMentions 跨会话返回 @我 的消息（含 @所有人），按时间倒序：
+// GET /api/mentions?user_id=&cursor=&limit=
+func (h *RESTHandler) ListMentions(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	page, err := h.mentionSvc.List(ctx, userID, uint64(queryInt64(c, "cursor")), int(queryInt64(c, "limit")))
+	if err != nil {
+		log.Printf("查询提及失败 user=%s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// sendMessageRequest 是 POST 发送消息的请求体；msg_id 由调用方生成，重试时保持不变以保证幂等。
+type sendMessageRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+	MsgID  string `json:"msg_id" binding:"required"`
+	service.ChatPayload
+}
+
+// SendMessage 发送消息，与 WebSocket CmdChat 共用发送路径：
+// POST /api/conversations/:id/messages
+// 直落库时返回 200 与 seq；启用 MQ 时入队即返回 202，seq 由消费者分配后随推送下发。
+func (h *RESTHandler) SendMessage(c *gin.Context) {
+	var req sendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 与 msg_id 不能为空"})
+		return
+	}
+	if utf8.RuneCountInString(req.Content) > service.MaxContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容过长"})
+		return
+	}
+
+	packet := model.InputPacket{Cmd: model.CmdChat, MsgId: req.MsgID, ConversationId: c.Param("id")}
+	out, err := chatSender{messageSvc: h.messageSvc, producer: h.producer}.send(c.Request.Context(), req.UserID, packet, req.ChatPayload)
+	if err != nil {
+		log.Printf("发送消息失败 user=%s conv=%s msg_id=%s: %v", req.UserID, packet.ConversationId, req.MsgID, err)
+	}
+
+	status := http.StatusOK
+	switch {
+	case out.Code == 0 && h.producer != nil:
+		status = http.StatusAccepted
+	case out.Code == 400 || out.Code == 403 || out.Code == 404:
+		status = out.Code
+	case out.Code != 0:
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, out)
+}
+
+// ListMessages 按游标分页拉取会话消息：
+// GET /api/conversations/:id/messages?user_id=&cursor=&limit=&direction=forward|backward
+// forward（默认）返回 seq > cursor 的消息；backward 向上翻历史，cursor 为 0 时返回最新一页。
+func (h *RESTHandler) ListMessages(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	conv, err := h.messageSvc.Authorize(ctx, userID, c.Param("id"))
+	if h.writeMessageError(c, err) {
+		return
+	}
+
+	var res service.PullResult
+	if c.Query("direction") == model.DirectionBackward {
+		res, err = h.pullSvc.PullHistory(ctx, conv.ID, queryInt64(c, "cursor"), int(queryInt64(c, "limit")))
+	} else {
+		res, err = h.pullSvc.PullForUser(ctx, userID, conv.ID, queryInt64(c, "cursor"), int(queryInt64(c, "limit")))
+	}
+	if err != nil {
+		log.Printf("拉取消息失败 user=%s conv=%s: %v", userID, conv.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "拉取失败"})
+		return
+	}
+	if res.Messages == nil {
+		res.Messages = []model.TimelineMessage{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"conversation_id": conv.ID,
+		"messages":        res.Messages,
+		"next_cursor":     res.NextCursorSeq,
+		"has_more":        res.HasMore,
+	})
+}
+
+// GetMessagesAround 加载锚点前后的消息：
+// GET /api/conversations/:id/messages/around?user_id=&seq=&msg_id=&before=&after=
+func (h *RESTHandler) GetMessagesAround(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+	seq := queryInt64(c, "seq")
+	msgID := c.Query("msg_id")
+	if seq <= 0 && msgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seq 与 msg_id 至少提供一个"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	conv, err := h.messageSvc.Authorize(ctx, userID, c.Param("id"))
+	if h.writeMessageError(c, err) {
+		return
+	}
+
+	res, err := h.pullSvc.PullAround(ctx, conv.ID, seq, msgID, int(queryInt64(c, "before")), int(queryInt64(c, "after")))
+	if errors.Is(err, service.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "锚点消息不存在"})
+		return
+	}
+	if err != nil {
+		log.Printf("拉取上下文失败 conv=%s: %v", conv.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "拉取失败"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ListMessageVersions 返回消息的编辑历史（version 0 为原始内容）：
+// GET /api/conversations/:id/messages/:msg_id/versions?user_id=
+func (h *RESTHandler) ListMessageVersions(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	msgID := c.Param("msg_id")
+	versions, err := h.messageSvc.ListVersions(ctx, userID, h.conversationID(ctx, c.Param("id"), userID), msgID)
+	if h.writeMessageError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg_id": msgID, "versions": versions})
+}
+
+// ListReactions 返回消息按表情聚合的回应人数与回应者：
+// GET /api/conversations/:id/messages/:msg_id/reactions?user_id=
+func (h *RESTHandler) ListReactions(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	msgID := c.Param("msg_id")
+	reactions, err := h.messageSvc.ListReactions(ctx, userID, h.conversationID(ctx, c.Param("id"), userID), msgID)
+	if h.writeMessageError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg_id": msgID, "reactions": reactions})
+}
+
+// writeMessageError 将单条消息查询的错误映射为 HTTP 状态码，已写响应时返回 true。
+func (h *RESTHandler) writeMessageError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "不是会话成员"})
+	case errors.Is(err, service.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+	case errors.Is(err, service.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+	case errors.Is(err, service.ErrAlreadyRecalled):
+		c.JSON(http.StatusGone, gin.H{"error": "消息已撤回"})
+	default:
+		log.Printf("查询消息信息失败 conv=%s msg_id=%s: %v", c.Param("id"), c.Param("msg_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+	}
+	return true
+}
+
+// GetThread 按话题内 seq 拉取根消息下的回复：
+// GET /api/conversations/:id/messages/:msg_id/thread?user_id=&cursor=&limit=
+func (h *RESTHandler) GetThread(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	conv, err := h.messageSvc.Authorize(ctx, userID, c.Param("id"))
+	if h.writeMessageError(c, err) {
+		return
+	}
+
+	res, err := h.pullSvc.PullThread(ctx, conv.ID, c.Param("msg_id"), queryInt64(c, "cursor"), int(queryInt64(c, "limit")))
+	if errors.Is(err, service.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "话题根消息不存在"})
+		return
+	}
+	if err != nil {
+		log.Printf("拉取话题失败 conv=%s root=%s: %v", conv.ID, c.Param("msg_id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "拉取失败"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// conversationID 将路径中的会话 ID 映射为已登记的会话 ID（见 ConversationRegistry.CanonicalID），
+// 未配置注册表或查询失败时原样返回。
+func (h *RESTHandler) conversationID(ctx context.Context, id, userID string) string {
+	if h.registry == nil {
+		return id
+	}
+	canonical, err := h.registry.CanonicalID(ctx, id, userID)
+	if err != nil {
+		log.Printf("规范化会话 ID 失败 user=%s conv=%s: %v", userID, id, err)
+		return id
+	}
+	return canonical
+}
+
+// queryInt64 解析整数查询参数，缺省或非法时返回 0。
+func queryInt64(c *gin.Context, key string) int64 {
+	v, err := strconv.ParseInt(c.Query(key), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"go-im/internal/model"
+	"go-im/internal/service"
+)
+
+const (
+	sseKeepAlive    = 25 * time.Second // 注释行保活，防止代理断开空闲连接
+	sseWriteTimeout = 10 * time.Second
+)
+
+var errStreamClosed = errors.New("sse stream closed")
+
+// sseStream 以 text/event-stream 写出下行消息，实现 service.Stream。
+// Close 之后不再写 ResponseWriter，HandleSSE 等到 Close 后才返回。
+type sseStream struct {
+	mu     sync.Mutex
+	w      gin.ResponseWriter
+	rc     *http.ResponseController
+	closed chan struct{}
+	done   bool
+}
+
+func newSSEStream(w gin.ResponseWriter) *sseStream {
+	return &sseStream{w: w, rc: http.NewResponseController(w), closed: make(chan struct{})}
+}
+
+// WriteJSON 写出一条 data 事件，内容与 WebSocket 下行的 JSON 相同。
+func (s *sseStream) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write("data: " + string(data) + "\n\n")
+}
+
+func (s *sseStream) write(frame string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return errStreamClosed
+	}
+	_ = s.rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+	if _, err := s.w.WriteString(frame); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.done {
+		s.done = true
+		close(s.closed)
+	}
+	return nil
+}
+
+// sseConn 是一条 SSE 连接的上行状态。
+type sseConn struct {
+	userID   string
+	sess     *service.Session
+	stream   *sseStream
+	mu       sync.Mutex   // 串行化上行指令，与 WebSocket 读循环逐条处理的语义一致
+	lastSeen atomic.Int64 // 最近一次上行请求时间（毫秒），超过 readDeadline 视为断开
+}
+
+// HandleSSE 建立 SSE 下行连接，供无法使用 WebSocket 的网络环境：
+// GET /sse?user_id=&device_id=
+// 首个事件为 session（data 含 session_id），之后每个 data 事件与 WebSocket 下行的 JSON 相同。
+// 上行指令通过 POST /sse/:session_id 发送，需按心跳间隔发送 cmd=0，否则连接按读超时关闭。
+func (h *WebSocketHandler) HandleSSE(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 不能为空"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 Nginx 缓冲
+	c.Status(http.StatusOK)
+
+	stream := newSSEStream(c.Writer)
+	sess := service.NewStreamSession(userID, c.Query("device_id"), service.TransportSSE, c.Request.RemoteAddr, stream)
+	conn := &sseConn{userID: userID, sess: sess, stream: stream}
+	conn.lastSeen.Store(time.Now().UnixMilli())
+
+	sessionID := uuid.NewString()
+	data, _ := json.Marshal(gin.H{"session_id": sessionID})
+	if err := stream.write("event: session\ndata: " + string(data) + "\n\n"); err != nil {
+		log.Printf("用户 %s 建立 SSE 失败: %v", userID, err)
+		return
+	}
+	h.streams.Store(sessionID, conn)
+	defer h.streams.Delete(sessionID)
+
+	h.attach(c.Request.Context(), userID, sess)
+	defer h.detach(userID, sess)
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			_ = stream.Close()
+			return
+		case <-stream.closed:
+			return
+		case now := <-ticker.C:
+			if now.UnixMilli()-conn.lastSeen.Load() > readDeadline.Milliseconds() {
+				log.Printf("用户 %s SSE 连接超时未收到上行请求", userID)
+				_ = stream.Close()
+				return
+			}
+			if err := stream.write(": ping\n\n"); err != nil {
+				_ = stream.Close()
+				return
+			}
+		}
+	}
+}
+
+// HandleSSESend 接收 SSE 连接的上行指令，与 WebSocket 读循环共用分发逻辑，回包经 SSE 下行：
+// POST /sse/:session_id，请求体为一条 InputPacket。
+func (h *WebSocketHandler) HandleSSESend(c *gin.Context) {
+	v, ok := h.streams.Load(c.Param("session_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在或已断开，请重新建立 SSE 连接"})
+		return
+	}
+	conn := v.(*sseConn)
+
+	var packet model.InputPacket
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, readLimit)
+	if err := json.NewDecoder(c.Request.Body).Decode(&packet); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体解析失败"})
+		return
+	}
+	conn.lastSeen.Store(time.Now().UnixMilli())
+
+	conn.mu.Lock()
+	err := h.dispatch(conn.userID, packet, conn.sess)
+	conn.mu.Unlock()
+	if err != nil {
+		_ = conn.stream.Close()
+		c.JSON(http.StatusGone, gin.H{"error": "连接已关闭"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -3,12 +3,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
 	"go-im/internal/model"
@@ -17,16 +18,24 @@ import (
 
 const (
 	readDeadline = 90 * time.Second // 允许心跳丢 2-3 次（30s/跳）
-	writeTimeout = 10 * time.Second // 写超时防止阻塞
 	readLimit    = int64(4 << 10)   // 单条消息最大 4KB
 )
 
-// WebSocketHandler 负责握手、注册连接以及消息读循环。
+// WebSocketHandler 负责握手、注册连接以及消息读循环；SSE 传输（见 sse.go）复用同一套分发逻辑。
 type WebSocketHandler struct {
 	connManager *service.ConnectionManager
 	messageSvc  *service.MessageService
 	producer    *service.MessageProducer
+	pullSvc     *service.PullService
+	convSvc     *service.ConversationService
+	receiptSvc  *service.ReceiptService
+	tracker     *service.DeliveryTracker
+	signalSvc   *service.SignalService
+	presenceSvc *service.PresenceService
+	routes      *service.RedisRouteRegistry
+	registry    *service.ConversationRegistry
 	upgrader    websocket.Upgrader
+	streams     sync.Map // SSE session_id -> *sseConn
 }
 
 // NewWebSocketHandler 创建 Handler，允许注入连接管理器与消息服务。
@@ -47,6 +56,54 @@ func (h *WebSocketHandler) WithProducer(producer *service.MessageProducer) *WebS
 	return h
 }
 
+// WithPullService 注入拉取服务，启用 CmdPull / CmdAck 指令。
+func (h *WebSocketHandler) WithPullService(pullSvc *service.PullService) *WebSocketHandler {
+	h.pullSvc = pullSvc
+	return h
+}
+
+// WithConversationService 注入会话列表服务，启用 CmdConvList 指令。
+func (h *WebSocketHandler) WithConversationService(convSvc *service.ConversationService) *WebSocketHandler {
+	h.convSvc = convSvc
+	return h
+}
+
+// WithReceiptService 注入已读回执服务，启用 CmdRead 指令。
+func (h *WebSocketHandler) WithReceiptService(receiptSvc *service.ReceiptService) *WebSocketHandler {
+	h.receiptSvc = receiptSvc
+	return h
+}
+
+// WithDeliveryTracker 注入送达跟踪器，启用 CmdDelivered 指令。
+func (h *WebSocketHandler) WithDeliveryTracker(tracker *service.DeliveryTracker) *WebSocketHandler {
+	h.tracker = tracker
+	return h
+}
+
+// WithSignalService 注入瞬时信令服务，启用 CmdSignal 指令。
+func (h *WebSocketHandler) WithSignalService(signalSvc *service.SignalService) *WebSocketHandler {
+	h.signalSvc = signalSvc
+	return h
+}
+
+// WithPresenceService 注入在线状态服务，连接建立/断开时更新状态并启用 CmdPresence 指令。
+func (h *WebSocketHandler) WithPresenceService(presenceSvc *service.PresenceService) *WebSocketHandler {
+	h.presenceSvc = presenceSvc
+	return h
+}
+
+// WithRouteRegistry 注入跨节点路由表，连接建立/断开时登记所在节点。
+func (h *WebSocketHandler) WithRouteRegistry(routes *service.RedisRouteRegistry) *WebSocketHandler {
+	h.routes = routes
+	return h
+}
+
+// WithConversationRegistry 注入会话注册表，收到的单聊会话 ID 统一规范化。
+func (h *WebSocketHandler) WithConversationRegistry(registry *service.ConversationRegistry) *WebSocketHandler {
+	h.registry = registry
+	return h
+}
+
 // HandleWebSocket 提供给 Gin 的路由函数。
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	userID := c.Query("user_id")
@@ -61,19 +118,58 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	h.connManager.Add(userID, conn)
-	log.Printf("用户 %s 已连接，当前在线: %v", userID, h.connManager.ListIDs())
+	sess := service.NewSession(userID, c.Query("device_id"), conn)
+	h.attach(c.Request.Context(), userID, sess)
 
 	// 独立 goroutine 读消息，避免阻塞握手返回
-	go h.readLoop(userID, conn)
+	go h.readLoop(userID, sess)
 }
 
-// readLoop 读取客户端消息，先支持心跳，后续扩展业务指令。
-func (h *WebSocketHandler) readLoop(userID string, conn *websocket.Conn) {
-	defer func() {
-		h.connManager.Remove(userID)
-		log.Printf("用户 %s 连接关闭", userID)
-	}()
+// attach 登记新连接：加入连接表、登记跨节点路由、更新在线状态。WebSocket 与 SSE 共用。
+func (h *WebSocketHandler) attach(parent context.Context, userID string, sess *service.Session) {
+	h.connManager.Add(userID, sess)
+	log.Printf("用户 %s 设备 %s 已连接（%s），当前在线用户: %d，连接: %d", userID, sess.DeviceID, sess.Transport, h.connManager.OnlineUsers(), h.connManager.OnlineSessions())
+	if h.routes != nil {
+		ctx, cancel := context.WithTimeout(parent, 3*time.Second)
+		if err := h.routes.Register(ctx, userID, sess.DeviceID); err != nil {
+			log.Printf("登记连接路由失败 user=%s: %v", userID, err)
+		}
+		cancel()
+	}
+	if h.presenceSvc != nil {
+		ctx, cancel := context.WithTimeout(parent, 3*time.Second)
+		h.presenceSvc.Connect(ctx, userID, sess.DeviceID)
+		cancel()
+	}
+}
+
+// detach 连接断开后的清理，与 attach 对应。
+func (h *WebSocketHandler) detach(userID string, sess *service.Session) {
+	// 先关闭会话再清理送达跟踪，关闭后的推送不会再登记
+	_ = sess.Close()
+	if h.tracker != nil {
+		h.tracker.Forget(sess)
+	}
+	// 同一设备已被新连接替换时不判定下线
+	if h.connManager.Remove(userID, sess) {
+		if h.routes != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			if err := h.routes.Unregister(ctx, userID, sess.DeviceID); err != nil {
+				log.Printf("注销连接路由失败 user=%s: %v", userID, err)
+			}
+			cancel()
+		}
+		if h.presenceSvc != nil {
+			h.presenceSvc.Disconnect(userID, sess.DeviceID)
+		}
+	}
+	log.Printf("用户 %s 连接关闭", userID)
+}
+
+// readLoop 读取客户端消息并逐条分发。
+func (h *WebSocketHandler) readLoop(userID string, sess *service.Session) {
+	conn := sess.Conn()
+	defer h.detach(userID, sess)
 
 	conn.SetReadLimit(readLimit)
 	_ = conn.SetReadDeadline(time.Now().Add(readDeadline))
@@ -88,74 +184,462 @@ func (h *WebSocketHandler) readLoop(userID string, conn *websocket.Conn) {
 			log.Printf("读取用户 %s 消息失败: %v", userID, err)
 			return
 		}
+		if err := h.dispatch(userID, packet, sess); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch 按指令分发一条上行消息，WebSocket 读循环与 SSE 上行请求共用。
+// 返回 error 表示连接已不可用（通常是回包写失败），调用方应关闭连接。
+func (h *WebSocketHandler) dispatch(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.registry != nil && packet.ConversationId != "" {
+		// private_b_a 与 private_a_b 指向同一会话；旧 ID 下已有消息时沿用旧 ID
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		id, err := h.registry.CanonicalID(ctx, packet.ConversationId, userID)
+		cancel()
+		if err != nil {
+			log.Printf("规范化会话 ID 失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		} else {
+			packet.ConversationId = id
+		}
+	}
 
-		switch packet.Cmd {
-		case model.CmdHeartbeat:
-			if err := h.writeJSON(conn, model.OutputPacket{Cmd: model.CmdHeartbeat, Code: 0}); err != nil {
-				log.Printf("心跳回复失败 user=%s: %v", userID, err)
-				return
+	switch packet.Cmd {
+	case model.CmdHeartbeat:
+		if err := sess.WriteJSON(model.OutputPacket{Cmd: model.CmdHeartbeat, Code: 0}); err != nil {
+			log.Printf("心跳回复失败 user=%s: %v", userID, err)
+			return err
+		}
+		if h.presenceSvc != nil || h.routes != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			if h.presenceSvc != nil {
+				h.presenceSvc.Heartbeat(ctx, userID, sess.DeviceID)
 			}
-		case model.CmdChat:
-			if err := h.handleChat(userID, packet, conn); err != nil {
-				log.Printf("处理聊天消息失败 user=%s: %v", userID, err)
-				return
+			if h.routes != nil {
+				if err := h.routes.Refresh(ctx, userID, sess.DeviceID); err != nil {
+					log.Printf("续期连接路由失败 user=%s: %v", userID, err)
+				}
 			}
-		default:
-			// 预留：登录、聊天、拉取等指令后续接入 service 层
-			log.Printf("收到用户 %s 的指令 cmd=%d msg_id=%s", userID, packet.Cmd, packet.MsgId)
+			cancel()
+		}
+	case model.CmdChat:
+		if err := h.handleChat(userID, packet, sess); err != nil {
+			log.Printf("处理聊天消息失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdPull:
+		if err := h.handlePull(userID, packet, sess); err != nil {
+			log.Printf("处理拉取请求失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdSync:
+		if err := h.handleSync(userID, packet, sess); err != nil {
+			log.Printf("处理批量同步失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdConvList:
+		if err := h.handleConvList(userID, packet, sess); err != nil {
+			log.Printf("处理会话列表请求失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdRead:
+		if err := h.handleRead(userID, packet, sess); err != nil {
+			log.Printf("处理已读回执失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdDelivered:
+		h.handleDelivered(userID, packet, sess)
+	case model.CmdRecall:
+		if err := h.handleRecall(userID, packet, sess); err != nil {
+			log.Printf("处理撤回失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdEdit:
+		if err := h.handleEdit(userID, packet, sess); err != nil {
+			log.Printf("处理编辑失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdReact:
+		if err := h.handleReact(userID, packet, sess); err != nil {
+			log.Printf("处理表情回应失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdSignal:
+		if err := h.handleSignal(userID, packet, sess); err != nil {
+			log.Printf("处理信令失败 user=%s: %v", userID, err)
+			return err
 		}
+	case model.CmdPresence:
+		if err := h.handlePresence(userID, packet, sess); err != nil {
+			log.Printf("处理在线状态订阅失败 user=%s: %v", userID, err)
+			return err
+		}
+	case model.CmdAck:
+		if err := h.handleAck(userID, packet, sess); err != nil {
+			log.Printf("处理 ACK 失败 user=%s: %v", userID, err)
+			return err
+		}
+	default:
+		// 预留：登录、聊天、拉取等指令后续接入 service 层
+		log.Printf("收到用户 %s 的指令 cmd=%d msg_id=%s", userID, packet.Cmd, packet.MsgId)
 	}
-}
-
-// writeJSON 统一设置写超时，防止写阻塞。
-func (h *WebSocketHandler) writeJSON(conn *websocket.Conn, payload interface{}) error {
-	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
-	return conn.WriteJSON(payload)
+	return nil
 }
 
 // handleChat 处理聊天消息：解析、写库并返回 seq。
-func (h *WebSocketHandler) handleChat(userID string, packet model.InputPacket, conn *websocket.Conn) error {
+func (h *WebSocketHandler) handleChat(userID string, packet model.InputPacket, sess *service.Session) error {
 	if packet.ConversationId == "" {
-		return h.writeJSON(conn, model.OutputPacket{Cmd: model.CmdChat, Code: 400, MsgId: packet.MsgId, Payload: "ConversationId 不能为空!"})
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdChat, Code: 400, MsgId: packet.MsgId, Payload: "ConversationId 不能为空!"})
 	}
 
 	var payload service.ChatPayload
 	if err := json.Unmarshal(packet.Payload, &payload); err != nil {
-		return h.writeJSON(conn, model.OutputPacket{Cmd: model.CmdChat, Code: 400, MsgId: packet.MsgId, Payload: "Payload 解析失败!"})
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdChat, Code: 400, MsgId: packet.MsgId, Payload: "Payload 解析失败!"})
 	}
 
-	// 如果注入了 MQ 生产者，则走“入队”路径立即响应
-	if h.producer != nil {
-		msgID := packet.MsgId
-		if msgID == "" {
-			msgID = uuid.NewString()
+	outputPacket, err := chatSender{messageSvc: h.messageSvc, producer: h.producer}.send(context.Background(), userID, packet, payload)
+	if err != nil {
+		_ = sess.WriteJSON(outputPacket)
+		return err
+	}
+	return sess.WriteJSON(outputPacket)
+}
+
+// handlePull 处理拉取请求，各方向都先校验拉取者是会话成员，并按规范会话 ID 拉取：
+//   - forward（默认）：增量同步，优先读用户 Inbox，缺口部分回源 MySQL；
+//   - backward：向上翻历史，cursor_seq 为 0 时返回最新一页，结果按 seq 降序；
+//   - around：以 msg_id（优先）或 cursor_seq 为锚点，前后各取 limit 条；
+//   - thread：按话题内 seq 拉取 msg_id 下的回复。
+func (h *WebSocketHandler) handlePull(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.pullSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 501, Payload: "拉取服务未启用"})
+	}
+	if packet.ConversationId == "" {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 400, Payload: "ConversationId 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conv, ok, err := h.authorizePull(ctx, userID, packet, sess)
+	if !ok {
+		return err
+	}
+
+	if packet.Direction == model.DirectionAround {
+		around, err := h.pullSvc.PullAround(ctx, conv.ID, packet.CursorSeq, packet.MsgId, packet.Limit, packet.Limit)
+		if errors.Is(err, service.ErrMessageNotFound) {
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 404, MsgId: packet.MsgId, Payload: "锚点消息不存在"})
 		}
-		event := service.ChatEvent{
-			MsgID:          msgID,
-			ConversationID: packet.ConversationId,
-			SenderID:       userID,
-			Content:        payload.Content,
-			MsgType:        payload.MsgType,
-			SendTime:       payload.SendTime,
+		if err != nil {
+			log.Printf("拉取上下文失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 1, MsgId: packet.MsgId, Payload: "拉取失败"})
 		}
+		return sess.WriteJSON(model.OutputPacket{
+			Cmd:           model.CmdPull,
+			Code:          0,
+			MsgId:         packet.MsgId,
+			Seq:           around.AnchorSeq,
+			NextCursorSeq: around.NextCursorSeq,
+			HasMore:       around.HasMoreAfter,
+			Payload:       around,
+		})
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
+	if packet.Direction == model.DirectionThread {
+		thread, err := h.pullSvc.PullThread(ctx, conv.ID, packet.MsgId, packet.CursorSeq, packet.Limit)
+		if errors.Is(err, service.ErrMessageNotFound) {
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 404, MsgId: packet.MsgId, Payload: "话题根消息不存在"})
+		}
+		if err != nil {
+			log.Printf("拉取话题失败 user=%s conv=%s root=%s: %v", userID, packet.ConversationId, packet.MsgId, err)
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 1, MsgId: packet.MsgId, Payload: "拉取失败"})
+		}
+		return sess.WriteJSON(model.OutputPacket{
+			Cmd:           model.CmdPull,
+			Code:          0,
+			MsgId:         packet.MsgId,
+			NextCursorSeq: thread.NextCursorSeq,
+			HasMore:       thread.HasMore,
+			Payload:       thread,
+		})
+	}
+
+	var res service.PullResult
+	if packet.Direction == model.DirectionBackward {
+		res, err = h.pullSvc.PullHistory(ctx, conv.ID, packet.CursorSeq, packet.Limit)
+	} else {
+		res, err = h.pullSvc.PullForUser(ctx, userID, conv.ID, packet.CursorSeq, packet.Limit)
+	}
+	if err != nil {
+		log.Printf("拉取消息失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 1, Payload: "拉取失败"})
+	}
+	return sess.WriteJSON(model.OutputPacket{
+		Cmd:           model.CmdPull,
+		Code:          0,
+		NextCursorSeq: res.NextCursorSeq,
+		HasMore:       res.HasMore,
+		Payload:       res.Messages,
+	})
+}
+
+// authorizePull 校验拉取者是会话成员；未通过时已写回错误响应，ok 为 false。
+func (h *WebSocketHandler) authorizePull(ctx context.Context, userID string, packet model.InputPacket, sess *service.Session) (service.ConversationInfo, bool, error) {
+	conv, err := h.messageSvc.Authorize(ctx, userID, packet.ConversationId)
+	switch {
+	case err == nil:
+		return conv, true, nil
+	case errors.Is(err, service.ErrForbidden):
+		return conv, false, sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 403, MsgId: packet.MsgId, Payload: "不是会话成员"})
+	case errors.Is(err, service.ErrConversationNotFound):
+		return conv, false, sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 404, MsgId: packet.MsgId, Payload: "会话不存在"})
+	default:
+		log.Printf("解析会话失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return conv, false, sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPull, Code: 1, MsgId: packet.MsgId, Payload: "会话解析失败"})
+	}
+}
 
-		if err := h.producer.PublishChat(ctx, event); err != nil {
-			return h.writeJSON(conn, model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msgID, Payload: "MQ 发布失败"})
+// handleSync 处理重连后的批量同步，一次返回所有会话的新消息数、最新消息与第一页。
+func (h *WebSocketHandler) handleSync(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.pullSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSync, Code: 501, Payload: "拉取服务未启用"})
+	}
+	var req model.SyncRequest
+	if len(packet.Payload) > 0 {
+		if err := json.Unmarshal(packet.Payload, &req); err != nil {
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSync, Code: 400, Payload: "Payload 解析失败!"})
 		}
-		return h.writeJSON(conn, model.OutputPacket{Cmd: model.CmdChat, Code: 0, MsgId: msgID, Payload: "accepted"})
 	}
 
-	// 默认路径：直接落库
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := h.pullSvc.SyncConversations(ctx, userID, req.Cursors, req.PageSize)
+	if err != nil {
+		log.Printf("批量同步失败 user=%s: %v", userID, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSync, Code: 1, Payload: "同步失败"})
+	}
+	// has_more 表示会话数超过上限被截断，客户端对未返回的会话再次同步
+	return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSync, Code: 0, HasMore: res.Truncated, Payload: res.Conversations})
+}
+
+// handleConvList 返回用户的会话列表，cursor_seq / conversation_id 传上一页的 next_cursor / next_cursor_id 继续翻页。
+func (h *WebSocketHandler) handleConvList(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.convSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdConvList, Code: 501, Payload: "会话列表服务未启用"})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	outputPacket, err := h.messageSvc.HandleChat(ctx, userID, packet, payload)
+	page, err := h.convSvc.List(ctx, userID, packet.CursorSeq, packet.ConversationId, packet.Limit)
 	if err != nil {
-		_ = h.writeJSON(conn, outputPacket)
-		return err
+		log.Printf("查询会话列表失败 user=%s: %v", userID, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdConvList, Code: 1, Payload: "查询失败"})
+	}
+	return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdConvList, Code: 0, HasMore: page.HasMore, Payload: page})
+}
+
+// handleAck 处理会话 ACK，cursor_seq 表示已确认收到的最大 seq。
+func (h *WebSocketHandler) handleAck(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.pullSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdAck, Code: 501, Payload: "拉取服务未启用"})
+	}
+	if packet.ConversationId == "" {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdAck, Code: 400, Payload: "ConversationId 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := h.pullSvc.AckConversation(ctx, userID, packet.ConversationId, packet.CursorSeq); err != nil {
+		log.Printf("更新 ACK 失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdAck, Code: 1})
+	}
+	return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdAck, Code: 0, Seq: packet.CursorSeq})
+}
+
+// handleRead 处理已读回执，cursor_seq 表示已读到的最大 seq。
+func (h *WebSocketHandler) handleRead(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.receiptSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRead, Code: 501, Payload: "已读回执服务未启用"})
+	}
+	if packet.ConversationId == "" || packet.CursorSeq <= 0 {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRead, Code: 400, Payload: "ConversationId 与 cursor_seq 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	receipt, err := h.receiptSvc.MarkRead(ctx, userID, packet.ConversationId, packet.CursorSeq)
+	if errors.Is(err, service.ErrForbidden) {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRead, Code: 403, Payload: "不是会话成员"})
+	}
+	if err != nil {
+		log.Printf("更新已读位点失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRead, Code: 1})
+	}
+	return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRead, Code: 0, Seq: receipt.ReadSeq})
+}
+
+// handleDelivered 处理客户端对推送消息的送达确认（按 msg_id），不回包。
+func (h *WebSocketHandler) handleDelivered(userID string, packet model.InputPacket, sess *service.Session) {
+	if h.tracker == nil || packet.MsgId == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if !h.tracker.Ack(ctx, sess, packet.MsgId) {
+		log.Printf("忽略未跟踪的送达确认 user=%s msg_id=%s", userID, packet.MsgId)
+	}
+}
+
+// handleRecall 撤回 msg_id 指定的消息，成功时返回撤回事件的 seq。
+func (h *WebSocketHandler) handleRecall(userID string, packet model.InputPacket, sess *service.Session) error {
+	if packet.ConversationId == "" || packet.MsgId == "" {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 400, MsgId: packet.MsgId, Payload: "ConversationId 与 msg_id 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	event, err := h.messageSvc.Recall(ctx, userID, packet.ConversationId, packet.MsgId)
+	switch {
+	case err == nil:
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 0, MsgId: packet.MsgId, Seq: int64(event.Seq)})
+	case errors.Is(err, service.ErrMessageNotFound):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 404, MsgId: packet.MsgId, Payload: "消息不存在"})
+	case errors.Is(err, service.ErrRecallWindowExpired):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 403, MsgId: packet.MsgId, Payload: "已超过撤回时限"})
+	case errors.Is(err, service.ErrForbidden):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 403, MsgId: packet.MsgId, Payload: "无权撤回该消息"})
+	case errors.Is(err, service.ErrAlreadyRecalled):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 409, MsgId: packet.MsgId, Payload: "消息已撤回"})
+	default:
+		log.Printf("撤回消息失败 user=%s msg_id=%s: %v", userID, packet.MsgId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdRecall, Code: 1, MsgId: packet.MsgId})
+	}
+}
+
+// handleEdit 编辑 msg_id 指定的消息，成功时返回编辑事件的 seq。
+func (h *WebSocketHandler) handleEdit(userID string, packet model.InputPacket, sess *service.Session) error {
+	var req model.EditRequest
+	if packet.ConversationId == "" || packet.MsgId == "" || json.Unmarshal(packet.Payload, &req) != nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 400, MsgId: packet.MsgId, Payload: "ConversationId、msg_id 与 payload 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	event, err := h.messageSvc.Edit(ctx, userID, packet.ConversationId, packet.MsgId, req.Content)
+	switch {
+	case err == nil:
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 0, MsgId: packet.MsgId, Seq: int64(event.Seq)})
+	case errors.Is(err, service.ErrMessageNotFound):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 404, MsgId: packet.MsgId, Payload: "消息不存在"})
+	case errors.Is(err, service.ErrForbidden):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 403, MsgId: packet.MsgId, Payload: "只能编辑自己发送的消息"})
+	case errors.Is(err, service.ErrAlreadyRecalled):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 409, MsgId: packet.MsgId, Payload: "消息已撤回"})
+	case errors.Is(err, service.ErrContentTooLong):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 400, MsgId: packet.MsgId, Payload: "内容过长"})
+	default:
+		log.Printf("编辑消息失败 user=%s msg_id=%s: %v", userID, packet.MsgId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdEdit, Code: 1, MsgId: packet.MsgId})
+	}
+}
+
+// handleReact 添加或取消表情回应；有变更时返回回应事件的 seq，幂等请求不带 seq。
+func (h *WebSocketHandler) handleReact(userID string, packet model.InputPacket, sess *service.Session) error {
+	var req model.ReactRequest
+	if packet.ConversationId == "" || packet.MsgId == "" || json.Unmarshal(packet.Payload, &req) != nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 400, MsgId: packet.MsgId, Payload: "ConversationId、msg_id 与 payload 不能为空!"})
+	}
+	if req.Action == "" {
+		req.Action = service.ReactionAdd
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	event, err := h.messageSvc.React(ctx, userID, packet.ConversationId, packet.MsgId, req.Emoji, req.Action)
+	switch {
+	case err == nil:
+		out := model.OutputPacket{Cmd: model.CmdReact, Code: 0, MsgId: packet.MsgId}
+		if event != nil {
+			out.Seq = int64(event.Seq)
+		}
+		return sess.WriteJSON(out)
+	case errors.Is(err, service.ErrInvalidEmoji):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 400, MsgId: packet.MsgId, Payload: "表情或动作不合法"})
+	case errors.Is(err, service.ErrMessageNotFound):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 404, MsgId: packet.MsgId, Payload: "消息不存在"})
+	case errors.Is(err, service.ErrForbidden):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 403, MsgId: packet.MsgId, Payload: "不是会话成员"})
+	case errors.Is(err, service.ErrAlreadyRecalled):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 409, MsgId: packet.MsgId, Payload: "消息已撤回"})
+	default:
+		log.Printf("表情回应失败 user=%s msg_id=%s: %v", userID, packet.MsgId, err)
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdReact, Code: 1, MsgId: packet.MsgId})
+	}
+}
+
+// handleSignal 转发输入中等瞬时信令，成功时不回包，只在请求非法或越权时回错误码。
+func (h *WebSocketHandler) handleSignal(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.signalSvc == nil {
+		return nil
+	}
+	var req model.SignalRequest
+	if packet.ConversationId == "" || json.Unmarshal(packet.Payload, &req) != nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSignal, Code: 400, Payload: "ConversationId 与 payload 不能为空!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := h.signalSvc.Relay(ctx, userID, packet.ConversationId, req.Kind, req.State)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, service.ErrInvalidSignal):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSignal, Code: 400, Payload: "信令类型不合法"})
+	case errors.Is(err, service.ErrForbidden):
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdSignal, Code: 403, Payload: "不是会话成员"})
+	default:
+		log.Printf("转发信令失败 user=%s conv=%s: %v", userID, packet.ConversationId, err)
+		return nil
+	}
+}
+
+// handlePresence 处理在线状态的订阅与取消订阅，回包携带新订阅用户的当前状态。
+func (h *WebSocketHandler) handlePresence(userID string, packet model.InputPacket, sess *service.Session) error {
+	if h.presenceSvc == nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPresence, Code: 501, Payload: "在线状态服务未启用"})
+	}
+	var req model.PresenceRequest
+	if err := json.Unmarshal(packet.Payload, &req); err != nil {
+		return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPresence, Code: 400, Payload: "Payload 解析失败!"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if len(req.Unsubscribe) > 0 {
+		h.presenceSvc.Unsubscribe(userID, req.Unsubscribe)
+	}
+	statuses := []service.PresenceStatus{}
+	if len(req.Subscribe) > 0 {
+		var err error
+		statuses, err = h.presenceSvc.Subscribe(ctx, userID, req.Subscribe)
+		if errors.Is(err, service.ErrTooManySubscriptions) {
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPresence, Code: 400, Payload: "订阅数量超过上限"})
+		}
+		if err != nil {
+			log.Printf("查询在线状态失败 user=%s: %v", userID, err)
+			return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPresence, Code: 1})
+		}
 	}
-	return h.writeJSON(conn, outputPacket)
+	return sess.WriteJSON(model.OutputPacket{Cmd: model.CmdPresence, Code: 0, Payload: statuses})
 }
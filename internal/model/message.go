@@ -4,31 +4,150 @@ import "time"
 
 // TimelineMessage 对应 timeline_message 表。
 type TimelineMessage struct {
-	ID             uint64    `gorm:"primaryKey;autoIncrement"`
-	MsgID          string    `gorm:"column:msg_id;size:64;not null;uniqueIndex:uk_msg_id"`
-	ConversationID string    `gorm:"column:conversation_id;size:64;not null;uniqueIndex:uk_conv_seq;index:idx_conv_seq"`
-	Seq            uint64    `gorm:"column:seq;not null;uniqueIndex:uk_conv_seq;index:idx_conv_seq"`
-	SenderID       string    `gorm:"column:sender_id;size:64;not null"`
-	Content        string    `gorm:"column:content;size:4096"`
-	MsgType        int8      `gorm:"column:msg_type;default:1"`
-	Status         int8      `gorm:"column:status;default:0"`
-	SendTime       int64     `gorm:"column:send_time;not null"`
-	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime"`
+	ID             uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
+	MsgID          string    `gorm:"column:msg_id;size:64;not null;uniqueIndex:uk_msg_id" json:"msg_id"`
+	ConversationID string    `gorm:"column:conversation_id;size:64;not null;uniqueIndex:uk_conv_seq;index:idx_conv_seq" json:"conversation_id"`
+	Seq            uint64    `gorm:"column:seq;not null;uniqueIndex:uk_conv_seq;index:idx_conv_seq" json:"seq"`
+	SenderID       string    `gorm:"column:sender_id;size:64;not null" json:"sender_id"`
+	Content        string    `gorm:"column:content;size:4096" json:"content"`
+	MsgType        int8      `gorm:"column:msg_type;default:1" json:"msg_type"`
+	Status         int8      `gorm:"column:status;default:0" json:"status"` // 见 MessageStatus*
+	SendTime       int64     `gorm:"column:send_time;not null" json:"send_time"`
+	Version        int       `gorm:"column:version;default:0" json:"version,omitempty"` // 编辑版本号，0 表示未编辑
+	ReplyToMsgID   string    `gorm:"column:reply_to_msg_id;size:64;default:''" json:"reply_to_msg_id,omitempty"`
+	ReplyToSeq     uint64    `gorm:"column:reply_to_seq;default:0" json:"reply_to_seq,omitempty"`
+	ThreadRootID   string    `gorm:"column:thread_root_id;size:64;default:'';index:idx_thread" json:"thread_root_id,omitempty"` // 所属话题的根消息
+	ThreadSeq      uint64    `gorm:"column:thread_seq;default:0;index:idx_thread" json:"thread_seq,omitempty"`                  // 话题内序列号，从 1 开始
+	ReplyCount     int       `gorm:"column:reply_count;default:0" json:"reply_count,omitempty"`                                 // 话题根消息的回复数
+	Mentions       []string  `gorm:"column:mentions;type:text;serializer:json" json:"mentions,omitempty"`                       // 被 @ 的用户
+	MentionAll     bool      `gorm:"column:mention_all;default:false" json:"mention_all,omitempty"`                             // @所有人
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"-"`
 }
 
+// 消息类型；>= MsgTypeSystem 为系统事件，Content 为事件 JSON
+const (
+	MsgTypeText     int8 = 1
+	MsgTypeImage    int8 = 2
+	MsgTypeSystem   int8 = 100 // 系统事件的起始值，不计入未读
+	MsgTypeRecall   int8 = 100 // 撤回事件，见 service.RecallEvent
+	MsgTypeEdit     int8 = 101 // 编辑事件，见 service.EditEvent
+	MsgTypeReaction int8 = 102 // 表情回应事件，见 service.ReactionEvent
+)
+
+// 消息状态
+const (
+	MessageStatusSending   int8 = 0 // 已落库，尚无设备确认送达
+	MessageStatusDelivered int8 = 1 // 至少一台接收设备确认送达
+	MessageStatusRead      int8 = 2 // 仅单聊：对方已读；群聊的已读情况见 user_conversation_state.last_read_seq
+	MessageStatusRecalled  int8 = 3 // 已撤回，正文已清空
+)
+
 // TableName 自定义表名以符合设计文档。
 func (TimelineMessage) TableName() string {
 	return "timeline_message"
 }
 
-// UserConversationState 对应 user_conversation_state 表，用于存储 ACK 位点。
+// MessageEdit 对应 message_edit 表，保存消息的各个版本（version=0 为原始内容）。
+type MessageEdit struct {
+	ID       uint64 `gorm:"primaryKey;autoIncrement" json:"-"`
+	MsgID    string `gorm:"column:msg_id;size:64;not null;uniqueIndex:uk_msg_version" json:"msg_id"`
+	Version  int    `gorm:"column:version;not null;uniqueIndex:uk_msg_version" json:"version"`
+	Content  string `gorm:"column:content;size:4096" json:"content"`
+	EditorID string `gorm:"column:editor_id;size:64;not null" json:"editor_id"`
+	EditedAt int64  `gorm:"column:edited_at;not null" json:"edited_at"`
+}
+
+func (MessageEdit) TableName() string {
+	return "message_edit"
+}
+
+// MessageReaction 对应 message_reaction 表，一行表示一个用户对消息的一个表情回应。
+type MessageReaction struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
+	MsgID     string    `gorm:"column:msg_id;size:64;not null;uniqueIndex:uk_msg_emoji_user" json:"msg_id"`
+	Emoji     string    `gorm:"column:emoji;type:varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;not null;uniqueIndex:uk_msg_emoji_user" json:"emoji"`
+	UserID    string    `gorm:"column:user_id;size:64;not null;uniqueIndex:uk_msg_emoji_user" json:"user_id"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reaction"
+}
+
+// MentionAllUserID 是 @所有人 记录的 user_id。
+const MentionAllUserID = "@all"
+
+// MessageMention 对应 message_mention 表，一行表示一个用户在某条消息中被提及。
+// @所有人 每条消息只写一行 user_id 为 MentionAllUserID 的记录，读取时按当前群成员解析，不按成员展开。
+type MessageMention struct {
+	ID             uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	MsgID          string    `gorm:"column:msg_id;size:64;not null;uniqueIndex:uk_msg_user" json:"msg_id"`
+	ConversationID string    `gorm:"column:conversation_id;size:64;not null;index:idx_user_conv_seq,priority:2" json:"conversation_id"`
+	Seq            uint64    `gorm:"column:seq;not null;index:idx_user_conv_seq,priority:3" json:"seq"`
+	UserID         string    `gorm:"column:user_id;size:64;not null;uniqueIndex:uk_msg_user;index:idx_user_conv_seq,priority:1" json:"user_id"`
+	SenderID       string    `gorm:"column:sender_id;size:64;not null" json:"sender_id"`
+	MentionAll     bool      `gorm:"column:mention_all;default:false" json:"mention_all"`
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (MessageMention) TableName() string {
+	return "message_mention"
+}
+
+// UserConversationState 对应 user_conversation_state 表，用于存储 ACK 位点与已读位点。
 type UserConversationState struct {
 	UserID         string    `gorm:"column:user_id;size:64;primaryKey"`
 	ConversationID string    `gorm:"column:conversation_id;size:64;primaryKey"`
 	LastAckSeq     int64     `gorm:"column:last_ack_seq;default:0"`
+	LastReadSeq    int64     `gorm:"column:last_read_seq;default:0"` // 已读位点，独立于送达 ACK
+	ReadAt         int64     `gorm:"column:read_at;default:0"`       // last_read_seq 最近一次前进的时间（毫秒），ACK 不改变它
 	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime"`
 }
 
 func (UserConversationState) TableName() string {
 	return "user_conversation_state"
 }
+
+// GroupMember 对应 group_member 表。
+type GroupMember struct {
+	GroupID  string `gorm:"column:group_id;size:64;primaryKey"`
+	UserID   string `gorm:"column:user_id;size:64;primaryKey"`
+	JoinTime int64  `gorm:"column:join_time;not null"`
+	Role     int8   `gorm:"column:role;default:0"` // 见 GroupRole*
+}
+
+// 群成员角色
+const (
+	GroupRoleMember int8 = 0
+	GroupRoleAdmin  int8 = 1
+	GroupRoleOwner  int8 = 2
+)
+
+func (GroupMember) TableName() string {
+	return "group_member"
+}
+
+// 会话类型
+const (
+	ConversationTypePrivate int8 = 1
+	ConversationTypeGroup   int8 = 2
+)
+
+// Conversation 对应 conversation 表，是会话类型与参与者的唯一来源。
+// 单聊的两个参与者按字典序存放在 PeerA / PeerB；群聊成员存放在 group_member。
+type Conversation struct {
+	ConversationID string    `gorm:"column:conversation_id;size:64;primaryKey" json:"conversation_id"`
+	Type           int8      `gorm:"column:type;not null" json:"type"`
+	Title          string    `gorm:"column:title;size:128" json:"title,omitempty"`
+	Avatar         string    `gorm:"column:avatar;size:512" json:"avatar,omitempty"`
+	CreatorID      string    `gorm:"column:creator_id;size:64" json:"creator_id,omitempty"`
+	PeerA          string    `gorm:"column:peer_a;size:64;index:idx_peers" json:"peer_a,omitempty"`
+	PeerB          string    `gorm:"column:peer_b;size:64;index:idx_peers" json:"peer_b,omitempty"`
+	Settings       string    `gorm:"column:settings;type:text" json:"settings,omitempty"` // JSON 格式的会话设置
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (Conversation) TableName() string {
+	return "conversation"
+}
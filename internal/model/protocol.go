@@ -2,6 +2,14 @@ package model
 
 import "encoding/json"
 
+// 拉取方向
+const (
+    DirectionForward  = "forward"
+    DirectionBackward = "backward"
+    DirectionAround   = "around" // 以 cursor_seq 或 msg_id 为锚点，前后各取 limit 条
+    DirectionThread   = "thread" // msg_id 为话题根消息，cursor_seq 为话题内 thread_seq 游标
+)
+
 // 客户端发给服务器的包
 type CmdType int
 const (
@@ -10,16 +18,60 @@ const (
     CmdChat      // 发送消息
     CmdPull      // 核心：主动拉取消息
     CmdAck       // 消息确认
+    CmdPush      // 服务端推送：新消息（写扩散会话）
+    CmdConvUpdate // 服务端推送：会话有更新（读扩散大群，仅通知，客户端自行拉取）
+    CmdSync      // 重连后批量同步多个会话
+    CmdConvList  // 我的会话列表（按最后活跃时间倒序，含未读数）
+    CmdRead      // 已读回执：客户端上报已读到 cursor_seq；服务端向发送者推送 ReadReceipt
+    CmdDelivered // 送达确认：客户端按 msg_id 确认收到推送；服务端向发送者推送 DeliveryNotice
+    CmdRecall    // 撤回消息：msg_id 为被撤回的消息；撤回事件以 msg_type=100 的消息进入 Timeline
+    CmdEdit      // 编辑消息：msg_id 为被编辑的消息，payload 为 EditRequest；编辑事件以 msg_type=101 的消息进入 Timeline
+    CmdReact     // 表情回应：msg_id 为目标消息，payload 为 ReactRequest；回应事件以 msg_type=102 的消息进入 Timeline
+    CmdSignal    // 瞬时信令（输入中、录音中）：payload 为 SignalRequest；只转发给在线参与者，不分配 seq、不落库
+    CmdPresence  // 在线状态：payload 为 PresenceRequest（订阅/取消订阅）；服务端推送订阅对象的状态变化
+    CmdKick      // 服务端推送：连接被管理员断开，payload 含原因，随后服务端关闭连接
+    CmdNotice    // 服务端推送：系统通知
 )
 
 type InputPacket struct {
     Cmd            CmdType         `json:"cmd"`
     MsgId          string          `json:"msg_id,omitempty"`          // 客户端生成的消息唯一ID (幂等)
     ConversationId string          `json:"conversation_id,omitempty"` // 会话ID
-    CursorSeq      int64           `json:"cursor_seq,omitempty"`      // ⭐ 游标：从该seq之后开始拉取
+    CursorSeq      int64           `json:"cursor_seq,omitempty"`      // ⭐ 游标：从该seq之后开始拉取（backward 时为“该seq之前”；CmdConvList 时为上一页的 next_cursor，conversation_id 传 next_cursor_id）
+    Direction      string          `json:"direction,omitempty"`       // 拉取方向：forward(默认，增量同步) / backward(向上翻历史) / around(锚点上下文)
+    Limit          int             `json:"limit,omitempty"`           // 单页条数，缺省 50，上限 200
     Payload        json.RawMessage `json:"payload,omitempty"`         // 具体数据
 }
 
+// SyncRequest 是 CmdSync 的 payload；Cursors 为空时使用服务端记录的 last_ack_seq。
+type SyncRequest struct {
+    Cursors  map[string]int64 `json:"cursors,omitempty"`   // conversation_id -> 客户端本地已有的最大 seq
+    PageSize int              `json:"page_size,omitempty"` // 每个会话返回的第一页条数，缺省 20
+}
+
+// EditRequest 是 CmdEdit 的 payload。
+type EditRequest struct {
+    Content string `json:"content"` // 编辑后的完整内容
+}
+
+// ReactRequest 是 CmdReact 的 payload。
+type ReactRequest struct {
+    Emoji  string `json:"emoji"`
+    Action string `json:"action,omitempty"` // add(默认) / remove
+}
+
+// SignalRequest 是 CmdSignal 的 payload。
+type SignalRequest struct {
+    Kind  string `json:"kind"`  // typing / recording
+    State string `json:"state"` // start / stop
+}
+
+// PresenceRequest 是 CmdPresence 的 payload。
+type PresenceRequest struct {
+    Subscribe   []string `json:"subscribe,omitempty"`   // 订阅这些用户的在线状态，回包返回其当前状态
+    Unsubscribe []string `json:"unsubscribe,omitempty"` // 取消订阅
+}
+
 // 服务端发给客户端的包
 type OutputPacket struct {
     Cmd           CmdType     `json:"cmd"`
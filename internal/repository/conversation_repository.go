@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationRepository 负责 conversation 表的读写。
+type ConversationRepository struct {
+	db *gorm.DB
+}
+
+func NewConversationRepository(db *gorm.DB) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+// FindConversation 查询会话元数据，未找到时返回 gorm.ErrRecordNotFound。
+func (r *ConversationRepository) FindConversation(ctx context.Context, conversationID string) (*model.Conversation, error) {
+	var conv model.Conversation
+	if err := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID).First(&conv).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// CreateConversation 创建会话（已存在时不覆盖），并返回库中的最终记录。
+func (r *ConversationRepository) CreateConversation(ctx context.Context, conv *model.Conversation) (*model.Conversation, error) {
+	if conv.ConversationID == "" {
+		return nil, errors.New("conversationID required")
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(conv).Error; err != nil {
+		return nil, err
+	}
+	return r.FindConversation(ctx, conv.ConversationID)
+}
+
+// FindPrivateConversation 按参与者（peerA < peerB）查询单聊，未找到时返回 gorm.ErrRecordNotFound。
+// 并发登记可能产生多条记录，按创建顺序取最早的一条。
+func (r *ConversationRepository) FindPrivateConversation(ctx context.Context, peerA, peerB string) (*model.Conversation, error) {
+	var conv model.Conversation
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND peer_a = ? AND peer_b = ?", model.ConversationTypePrivate, peerA, peerB).
+		Order("created_at, conversation_id").
+		First(&conv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// HasMessages 判断会话 ID 下是否已有消息，用于沿用旧格式单聊 ID。
+func (r *ConversationRepository) HasMessages(ctx context.Context, conversationID string) (bool, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("conversation_id = ?", conversationID).
+		Limit(1).Pluck("id", &ids).Error
+	if err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+// RemoveGroupMembers 批量移除群成员，不在群内的用户忽略。
+func (r *ConversationRepository) RemoveGroupMembers(ctx context.Context, groupID string, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Where("group_id = ? AND user_id IN ?", groupID, userIDs).
+		Delete(&model.GroupMember{}).Error
+}
+
+// AddGroupMembers 批量加入群成员，已存在的成员保持不变。
+func (r *ConversationRepository) AddGroupMembers(ctx context.Context, members []model.GroupMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMessageRecalled 表示消息已撤回，不能再编辑。
+var ErrMessageRecalled = errors.New("message recalled")
+
+// ApplyEdit 在事务中保存新版本并更新消息的可见内容，返回更新后的消息。
+// 首次编辑时先把原始内容存为 version 0，保证历史完整。
+func (r *MessageRepository) ApplyEdit(ctx context.Context, msgID, editorID, content string) (*model.TimelineMessage, error) {
+	var msg model.TimelineMessage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("msg_id = ?", msgID).
+			First(&msg).Error; err != nil {
+			return err
+		}
+		if msg.Status == model.MessageStatusRecalled {
+			return ErrMessageRecalled
+		}
+
+		now := time.Now().UnixMilli()
+		if msg.Version == 0 {
+			original := model.MessageEdit{MsgID: msgID, Version: 0, Content: msg.Content, EditorID: msg.SenderID, EditedAt: msg.SendTime}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&original).Error; err != nil {
+				return err
+			}
+		}
+		version := msg.Version + 1
+		if err := tx.Create(&model.MessageEdit{MsgID: msgID, Version: version, Content: content, EditorID: editorID, EditedAt: now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.TimelineMessage{}).
+			Where("msg_id = ?", msgID).
+			Updates(map[string]interface{}{"content": content, "version": version}).Error; err != nil {
+			return err
+		}
+		// 行在事务内加锁读取，就地更新即为提交后的最新状态
+		msg.Content = content
+		msg.Version = version
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListVersions 返回消息的全部版本，按版本号升序。
+func (r *MessageRepository) ListVersions(ctx context.Context, msgID string) ([]model.MessageEdit, error) {
+	var edits []model.MessageEdit
+	err := r.db.WithContext(ctx).
+		Where("msg_id = ?", msgID).
+		Order("version ASC").
+		Find(&edits).Error
+	return edits, err
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// GroupRepository 提供群成员查询。
+type GroupRepository struct {
+	db *gorm.DB
+}
+
+func NewGroupRepository(db *gorm.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// GetRole 返回成员在群内的角色，非成员返回 gorm.ErrRecordNotFound。
+func (r *GroupRepository) GetRole(ctx context.Context, groupID, userID string) (int8, error) {
+	var member model.GroupMember
+	err := r.db.WithContext(ctx).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		First(&member).Error
+	if err != nil {
+		return 0, err
+	}
+	return member.Role, nil
+}
+
+// ListMembers 返回群内全部成员的用户 ID。
+func (r *GroupRepository) ListMembers(ctx context.Context, groupID string) ([]string, error) {
+	if groupID == "" {
+		return nil, errors.New("groupID required")
+	}
+	var userIDs []string
+	err := r.db.WithContext(ctx).Model(&model.GroupMember{}).
+		Where("group_id = ?", groupID).
+		Order("join_time ASC").
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// ListUserGroups 返回用户所在的全部群 ID。
+func (r *GroupRepository) ListUserGroups(ctx context.Context, userID string) ([]string, error) {
+	var groupIDs []string
+	err := r.db.WithContext(ctx).Model(&model.GroupMember{}).
+		Where("user_id = ?", userID).
+		Pluck("group_id", &groupIDs).Error
+	return groupIDs, err
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MentionRepository 负责 message_mention 表的读写。
+type MentionRepository struct {
+	db *gorm.DB
+}
+
+func NewMentionRepository(db *gorm.DB) *MentionRepository {
+	return &MentionRepository{db: db}
+}
+
+// SaveMentions 批量写入提及记录，已存在的 (msg_id, user_id) 保持不变，便于消息重试时幂等补写。
+func (r *MentionRepository) SaveMentions(ctx context.Context, mentions []model.MessageMention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&mentions, 500).Error
+}
+
+// mentionsForUser 匹配提及 userID 的记录：单独提及，或 userID 发送前已在群内、且不是自己发出的 @所有人。
+// 调用方需将 message_mention 别名为 m。
+const mentionsForUser = `(m.user_id = ? OR (m.user_id = ? AND m.sender_id <> ? AND EXISTS (
+	SELECT 1 FROM group_member AS g
+	WHERE g.group_id = m.conversation_id AND g.user_id = ? AND g.join_time <= UNIX_TIMESTAMP(m.created_at) * 1000)))`
+
+func mentionArgs(userID string) []interface{} {
+	return []interface{}{userID, model.MentionAllUserID, userID, userID}
+}
+
+// CountUnreadMentions 统计用户在各会话中 seq 大于 last_ack_seq 的提及数（含 @所有人），无未读的会话不出现在结果中。
+func (r *MentionRepository) CountUnreadMentions(ctx context.Context, userID string, conversationIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	if len(conversationIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		ConversationID string
+		Cnt            int64
+	}
+	err := r.db.WithContext(ctx).Table("message_mention AS m").
+		Select("m.conversation_id, COUNT(*) AS cnt").
+		Joins("LEFT JOIN user_conversation_state AS s ON s.user_id = ? AND s.conversation_id = m.conversation_id", userID).
+		Where("m.conversation_id IN ? AND m.seq > COALESCE(s.last_ack_seq, 0)", conversationIDs).
+		Where(mentionsForUser, mentionArgs(userID)...).
+		Group("m.conversation_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Cnt
+	}
+	return counts, nil
+}
+
+// ListMentions 按时间倒序返回提及用户的记录（含 @所有人），beforeID > 0 时只返回 id < beforeID 的记录。
+func (r *MentionRepository) ListMentions(ctx context.Context, userID string, beforeID uint64, limit int) ([]model.MessageMention, error) {
+	query := r.db.WithContext(ctx).Table("message_mention AS m").Where(mentionsForUser, mentionArgs(userID)...)
+	if beforeID > 0 {
+		query = query.Where("m.id < ?", beforeID)
+	}
+	var mentions []model.MessageMention
+	err := query.Order("m.id DESC").Limit(limit).Find(&mentions).Error
+	return mentions, err
+}
+
+// FindMessages 按 msg_id 批量查询消息正文。
+func (r *MentionRepository) FindMessages(ctx context.Context, msgIDs []string) ([]model.TimelineMessage, error) {
+	if len(msgIDs) == 0 {
+		return nil, nil
+	}
+	var messages []model.TimelineMessage
+	err := r.db.WithContext(ctx).Where("msg_id IN ?", msgIDs).Find(&messages).Error
+	return messages, err
+}
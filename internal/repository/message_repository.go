@@ -44,6 +44,23 @@ func (r *MessageRepository) SaveMessage(ctx context.Context, msg *model.Timeline
 			msg.Seq = maxSeq + 1
 		}
 
+		// 话题回复：锁住根消息分配话题内 seq 并累加回复数，与消息写入同一事务，幂等冲突时一并回滚
+		if msg.ThreadRootID != "" {
+			var root model.TimelineMessage
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "reply_count").
+				Where("msg_id = ?", msg.ThreadRootID).
+				First(&root).Error; err != nil {
+				return err
+			}
+			msg.ThreadSeq = uint64(root.ReplyCount) + 1
+			if err := tx.Model(&model.TimelineMessage{}).
+				Where("id = ?", root.ID).
+				Update("reply_count", gorm.Expr("reply_count + 1")).Error; err != nil {
+				return err
+			}
+		}
+
 		if err := tx.Create(msg).Error; err != nil {
 			var mysqlErr *mysql.MySQLError
 			if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
@@ -73,5 +90,23 @@ func (r *MessageRepository) FindByMsgID(ctx context.Context, msgID string) (*mod
 	return &msg, nil
 }
 
+// MarkDelivered 将消息状态从“已落库”推进为“已送达”，不会覆盖已读状态。
+func (r *MessageRepository) MarkDelivered(ctx context.Context, msgID string) error {
+	return r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("msg_id = ? AND status < ?", msgID, model.MessageStatusDelivered).
+		Update("status", model.MessageStatusDelivered).Error
+}
+
+// MarkRecalled 将消息标记为已撤回并清空正文；消息已撤回时返回 false。
+func (r *MessageRepository) MarkRecalled(ctx context.Context, msgID string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("msg_id = ? AND status <> ?", msgID, model.MessageStatusRecalled).
+		Updates(map[string]interface{}{"status": model.MessageStatusRecalled, "content": ""})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
 // ErrDuplicateMsgID 用于幂等冲突识别。
 var ErrDuplicateMsgID = errors.New("duplicate msg_id")
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"go-im/internal/model"
 
@@ -39,6 +40,118 @@ func (r *PullRepository) ListMessages(ctx context.Context, conversationID string
 	return messages, nil
 }
 
+// ListMessagesBefore 拉取 seq < beforeSeq 的历史消息，返回降序列表；beforeSeq <= 0 表示从最新一条开始。
+func (r *PullRepository) ListMessagesBefore(ctx context.Context, conversationID string, beforeSeq int64, limit int) ([]model.TimelineMessage, error) {
+	if conversationID == "" {
+		return nil, errors.New("conversationID cannot be empty")
+	}
+	query := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID)
+	if beforeSeq > 0 {
+		query = query.Where("seq < ?", beforeSeq)
+	}
+	var messages []model.TimelineMessage
+	if err := query.Order("seq DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListThread 拉取话题内 thread_seq > afterThreadSeq 的回复，返回升序列表。
+func (r *PullRepository) ListThread(ctx context.Context, rootMsgID string, afterThreadSeq int64, limit int) ([]model.TimelineMessage, error) {
+	if rootMsgID == "" {
+		return nil, errors.New("rootMsgID cannot be empty")
+	}
+	var messages []model.TimelineMessage
+	err := r.db.WithContext(ctx).
+		Where("thread_root_id = ? AND thread_seq > ?", rootMsgID, afterThreadSeq).
+		Order("thread_seq ASC").Limit(limit).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListBySeqs 按 seq 集合批量查询会话内消息，用于 Inbox 引用回填正文，返回升序列表。
+func (r *PullRepository) ListBySeqs(ctx context.Context, conversationID string, seqs []uint64) ([]model.TimelineMessage, error) {
+	if conversationID == "" {
+		return nil, errors.New("conversationID cannot be empty")
+	}
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+	var messages []model.TimelineMessage
+	err := r.db.WithContext(ctx).
+		Where("conversation_id = ? AND seq IN ?", conversationID, seqs).
+		Order("seq ASC").Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListAcks 返回用户在所有会话的 ACK 位点。
+func (r *PullRepository) ListAcks(ctx context.Context, userID string) ([]model.UserConversationState, error) {
+	if userID == "" {
+		return nil, errors.New("userId required")
+	}
+	var states []model.UserConversationState
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&states).Error; err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// ListLatestMessages 一次查询多个会话各自的最新一条消息，没有消息的会话不出现在结果中。
+func (r *PullRepository) ListLatestMessages(ctx context.Context, conversationIDs []string) ([]model.TimelineMessage, error) {
+	if len(conversationIDs) == 0 {
+		return nil, nil
+	}
+	var messages []model.TimelineMessage
+	err := r.db.WithContext(ctx).Raw(`
+	SELECT t.* FROM timeline_message t
+	JOIN (
+		SELECT conversation_id, MAX(seq) AS seq FROM timeline_message
+		WHERE conversation_id IN ? GROUP BY conversation_id
+	) latest ON t.conversation_id = latest.conversation_id AND t.seq = latest.seq
+	`, conversationIDs).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// CountUnread 统计用户在各会话 afterSeqs[conversation_id] 之后的未读消息数，
+// 不含用户自己发送的消息与系统事件（msg_type >= 100）；没有未读的会话不出现在结果中。
+func (r *PullRepository) CountUnread(ctx context.Context, userID string, afterSeqs map[string]int64) (map[string]int64, error) {
+	counts := make(map[string]int64, len(afterSeqs))
+	if len(afterSeqs) == 0 {
+		return counts, nil
+	}
+	conds := make([]string, 0, len(afterSeqs))
+	args := make([]interface{}, 0, len(afterSeqs)*2+2)
+	for convID, seq := range afterSeqs {
+		conds = append(conds, "(conversation_id = ? AND seq > ?)")
+		args = append(args, convID, seq)
+	}
+	args = append(args, userID, model.MsgTypeSystem)
+	var rows []struct {
+		ConversationID string
+		Unread         int64
+	}
+	err := r.db.WithContext(ctx).Raw(`
+	SELECT conversation_id, COUNT(*) AS unread FROM timeline_message
+	WHERE (`+strings.Join(conds, " OR ")+`) AND sender_id <> ? AND msg_type < ?
+	GROUP BY conversation_id
+	`, args...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Unread
+	}
+	return counts, nil
+}
+
 // UpsertAck 插入或更新用户在会话的 last_ack_seq，ackSeq 只有在更大时才更新。
 func (r *PullRepository) UpsertAck(ctx context.Context, userID, conversationID string, ackSeq int64) error {
 	// TODO: 实现 user_conversation_state 的插入/更新逻辑
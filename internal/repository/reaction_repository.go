@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReactionRepository 负责 message_reaction 表的读写。
+type ReactionRepository struct {
+	db *gorm.DB
+}
+
+func NewReactionRepository(db *gorm.DB) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+// AddReaction 记录表情回应，已存在时返回 false。
+func (r *ReactionRepository) AddReaction(ctx context.Context, msgID, emoji, userID string) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.MessageReaction{MsgID: msgID, Emoji: emoji, UserID: userID})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RemoveReaction 删除表情回应，不存在时返回 false。
+func (r *ReactionRepository) RemoveReaction(ctx context.Context, msgID, emoji, userID string) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Where("msg_id = ? AND emoji = ? AND user_id = ?", msgID, emoji, userID).
+		Delete(&model.MessageReaction{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListReactions 返回消息的全部表情回应，按回应时间升序。
+func (r *ReactionRepository) ListReactions(ctx context.Context, msgID string) ([]model.MessageReaction, error) {
+	var reactions []model.MessageReaction
+	err := r.db.WithContext(ctx).
+		Where("msg_id = ?", msgID).
+		Order("id ASC").
+		Find(&reactions).Error
+	return reactions, err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ReceiptRepository 负责已读位点与消息已读状态的读写。
+type ReceiptRepository struct {
+	db *gorm.DB
+}
+
+func NewReceiptRepository(db *gorm.DB) *ReceiptRepository {
+	return &ReceiptRepository{db: db}
+}
+
+// UpsertRead 更新用户在会话的 last_read_seq，只增不减；已读隐含已送达，last_ack_seq 同步推进。
+// read_at 仅在 last_read_seq 前进时更新，ACK 与重复上报不会改变它。
+func (r *ReceiptRepository) UpsertRead(ctx context.Context, userID, conversationID string, readSeq, readAt int64) error {
+	if userID == "" || conversationID == "" {
+		return errors.New("userId and conversationId required")
+	}
+	return r.db.WithContext(ctx).Exec(`
+	INSERT INTO user_conversation_state (user_id, conversation_id, last_ack_seq, last_read_seq, read_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		read_at = IF(VALUES(last_read_seq) > last_read_seq, VALUES(read_at), read_at),
+		last_read_seq = GREATEST(last_read_seq, VALUES(last_read_seq)),
+		last_ack_seq = GREATEST(last_ack_seq, VALUES(last_ack_seq))
+	`, userID, conversationID, readSeq, readSeq, readAt).Error
+}
+
+// LatestSeq 返回会话已落库的最大 seq，没有消息时返回 0。
+func (r *ReceiptRepository) LatestSeq(ctx context.Context, conversationID string) (int64, error) {
+	var latest int64
+	err := r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("conversation_id = ?", conversationID).
+		Select("COALESCE(MAX(seq), 0)").
+		Scan(&latest).Error
+	return latest, err
+}
+
+// GetState 查询用户在会话的位点，不存在时返回零值。
+func (r *ReceiptRepository) GetState(ctx context.Context, userID, conversationID string) (model.UserConversationState, error) {
+	state := model.UserConversationState{UserID: userID, ConversationID: conversationID}
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND conversation_id = ?", userID, conversationID).
+		First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return state, nil
+	}
+	return state, err
+}
+
+// ListReaders 返回会话中 last_read_seq >= seq 的用户。
+func (r *ReceiptRepository) ListReaders(ctx context.Context, conversationID string, seq int64) ([]model.UserConversationState, error) {
+	var states []model.UserConversationState
+	err := r.db.WithContext(ctx).
+		Where("conversation_id = ? AND last_read_seq >= ?", conversationID, seq).
+		Order("read_at ASC").
+		Find(&states).Error
+	return states, err
+}
+
+// ListSenders 返回 (afterSeq, upToSeq] 区间内消息的去重发送者。
+func (r *ReceiptRepository) ListSenders(ctx context.Context, conversationID string, afterSeq, upToSeq int64) ([]string, error) {
+	var senders []string
+	err := r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("conversation_id = ? AND seq > ? AND seq <= ?", conversationID, afterSeq, upToSeq).
+		Distinct().
+		Pluck("sender_id", &senders).Error
+	return senders, err
+}
+
+// MarkMessagesRead 将会话中 (afterSeq, upToSeq] 区间内非 readerID 发送的消息标记为已读（仅用于单聊）。
+// afterSeq 为此前的已读位点，之前的消息已在上次标记，限定区间避免每次回执都扫描整个会话历史。
+func (r *ReceiptRepository) MarkMessagesRead(ctx context.Context, conversationID, readerID string, afterSeq, upToSeq int64) error {
+	return r.db.WithContext(ctx).Model(&model.TimelineMessage{}).
+		Where("conversation_id = ? AND seq > ? AND seq <= ? AND sender_id <> ? AND status IN ?", conversationID, afterSeq, upToSeq, readerID,
+			[]int8{model.MessageStatusSending, model.MessageStatusDelivered}).
+		Update("status", model.MessageStatusRead).Error
+}
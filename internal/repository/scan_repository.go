@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"go-im/internal/model"
+)
+
+// MessageScanFilter 描述批量扫描 timeline_message 的范围，零值字段表示不限。
+type MessageScanFilter struct {
+	ConversationID string // 指定会话
+	UserID         string // 指定用户：匹配该用户参与的单聊与所在的群聊
+	SinceMs        int64  // send_time 下界（含），毫秒
+	UntilMs        int64  // send_time 上界（不含），毫秒
+}
+
+// ScanMessages 按主键 id 递增分批扫描消息，afterID 为上一批最后一条的 id，用于断点续扫。
+// UserID 过滤按 conversation.peer_a/peer_b 与 group_member 匹配，规范化后的 private_{hash} 会话也能命中；
+// 尚未登记的旧格式单聊仍按 ID 前缀/后缀粗筛。群成员取当前成员，调用方需再按参与者精确过滤。
+func (r *MessageRepository) ScanMessages(ctx context.Context, filter MessageScanFilter, afterID uint64, limit int) ([]model.TimelineMessage, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	query := r.db.WithContext(ctx).Model(&model.TimelineMessage{}).Where("id > ?", afterID)
+	if filter.ConversationID != "" {
+		query = query.Where("conversation_id = ?", filter.ConversationID)
+	}
+	if filter.UserID != "" {
+		uid := escapeLike(filter.UserID)
+		query = query.Where("conversation_id IN (SELECT conversation_id FROM conversation WHERE peer_a = ? OR peer_b = ?)"+
+			" OR conversation_id IN (SELECT group_id FROM group_member WHERE user_id = ?)"+
+			" OR conversation_id LIKE ? OR conversation_id LIKE ?",
+			filter.UserID, filter.UserID, filter.UserID, `private\_`+uid+`\_%`, `private\_%\_`+uid)
+	}
+	if filter.SinceMs > 0 {
+		query = query.Where("send_time >= ?", filter.SinceMs)
+	}
+	if filter.UntilMs > 0 {
+		query = query.Where("send_time < ?", filter.UntilMs)
+	}
+
+	var messages []model.TimelineMessage
+	if err := query.Order("id ASC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// escapeLike 转义 LIKE 通配符，避免用户 ID 中的 "_"、"%" 被当作模式匹配。
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `_`, `\_`, `%`, `\%`).Replace(s)
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// SessionInfo 是管理接口展示的单个连接信息。
+type SessionInfo struct {
+	UserID      string `json:"user_id"`
+	DeviceID    string `json:"device_id"`
+	Transport   string `json:"transport"`
+	ConnectedAt int64  `json:"connected_at"`
+	RemoteAddr  string `json:"remote_addr"`
+	PendingAcks int    `json:"pending_acks"` // 已推送未确认的消息数，未启用送达跟踪时为 0
+}
+
+// OnlineUser 是在线用户及其设备列表。
+type OnlineUser struct {
+	UserID  string   `json:"user_id"`
+	Devices []string `json:"devices"`
+}
+
+// KickNotice 是断开连接前推送给客户端的原因。
+type KickNotice struct {
+	Reason string `json:"reason"`
+}
+
+// SystemNotice 是管理员下发的系统通知。
+type SystemNotice struct {
+	Content string `json:"content"`
+	SentAt  int64  `json:"sent_at"`
+}
+
+// AdminResult 是踢下线与系统通知的执行结果。
+// 其他节点异步执行，只返回已转发的节点；全量通知转发给全部节点时 Forwarded 为 ["*"]。
+type AdminResult struct {
+	Local     int      `json:"local"`               // 本节点处理的连接数
+	Forwarded []string `json:"forwarded,omitempty"` // 已转发的其他节点
+}
+
+// 运维命令频道为 admin:{node_id}；全部节点共同订阅 admin:*，用于全量系统通知。
+const (
+	adminChannelPrefix = "admin:"
+	adminAllNodes      = "*"
+)
+
+// adminCommand 是经节点总线转发给其他节点执行的运维操作。
+type adminCommand struct {
+	Op       string        `json:"op"`     // kick / notice
+	Origin   string        `json:"origin"` // 发起节点，订阅全量频道时跳过自己发出的命令
+	UserID   string        `json:"user_id,omitempty"`
+	DeviceID string        `json:"device_id,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	Notice   *SystemNotice `json:"notice,omitempty"`
+	UserIDs  []string      `json:"user_ids,omitempty"`
+}
+
+// AdminService 提供连接的运维能力：列出、查看、踢下线与系统通知。
+// 列出与查看只作用于本节点；启用 WithCluster 后，踢下线按路由表转发到用户所在节点，
+// 系统通知转发给目标用户所在节点（未指定用户时转发给全部节点）。
+type AdminService struct {
+	conns   *ConnectionManager
+	tracker *DeliveryTracker // 可选：提供待确认推送数
+
+	routes RouteLookup // 可选：多节点部署时把运维操作转发到其他节点
+	bus    NodeBus
+	nodeID string
+}
+
+func NewAdminService(conns *ConnectionManager) *AdminService {
+	return &AdminService{conns: conns}
+}
+
+// WithDeliveryTracker 注入送达跟踪器，会话信息中展示待确认推送数。
+func (s *AdminService) WithDeliveryTracker(tracker *DeliveryTracker) *AdminService {
+	s.tracker = tracker
+	return s
+}
+
+// WithCluster 启用跨节点运维：与推送共用路由表与节点总线，命令走独立的 admin:{node_id} 频道。
+// 调用 Run 后才会执行其他节点转发来的命令。
+func (s *AdminService) WithCluster(routes RouteLookup, bus NodeBus, nodeID string) *AdminService {
+	s.routes = routes
+	s.bus = bus
+	s.nodeID = nodeID
+	return s
+}
+
+// Run 订阅本节点与全量运维频道并执行收到的命令，直到 ctx 结束。
+func (s *AdminService) Run(ctx context.Context) error {
+	if s.bus == nil {
+		return nil
+	}
+	for _, channel := range []string{adminChannelPrefix + s.nodeID, adminChannelPrefix + adminAllNodes} {
+		data, err := s.bus.Receive(ctx, channel)
+		if err != nil {
+			return err
+		}
+		go func() {
+			for raw := range data {
+				s.handleRemote(raw)
+			}
+		}()
+	}
+	return nil
+}
+
+// ListUsers 列出在线用户及其设备，最多 limit 个；truncated 表示还有未列出的用户。
+func (s *AdminService) ListUsers(limit int) (users []OnlineUser, truncated bool) {
+	byUser := make(map[string]int)
+	s.conns.Range(func(userID string, sess *Session) bool {
+		idx, ok := byUser[userID]
+		if !ok {
+			if len(users) >= limit {
+				truncated = true
+				return false
+			}
+			idx = len(users)
+			byUser[userID] = idx
+			users = append(users, OnlineUser{UserID: userID})
+		}
+		users[idx].Devices = append(users[idx].Devices, sess.DeviceID)
+		return true
+	})
+	if users == nil {
+		users = []OnlineUser{}
+	}
+	return users, truncated
+}
+
+// Sessions 返回用户在本节点的全部连接，按建立时间排序。
+func (s *AdminService) Sessions(userID string) []SessionInfo {
+	sessions := s.conns.Sessions(userID)
+	out := make([]SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		info := SessionInfo{
+			UserID:      sess.UserID,
+			DeviceID:    sess.DeviceID,
+			Transport:   sess.Transport,
+			ConnectedAt: sess.ConnectedAt.UnixMilli(),
+			RemoteAddr:  sess.RemoteAddr,
+		}
+		if s.tracker != nil {
+			info.PendingAcks = s.tracker.PendingCount(sess)
+		}
+		out = append(out, info)
+	}
+	// 同一毫秒内建立的连接按设备 ID 排序，保证输出稳定
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].ConnectedAt != out[j].ConnectedAt {
+			return out[i].ConnectedAt < out[j].ConnectedAt
+		}
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out
+}
+
+// Kick 推送断开原因后关闭用户的连接；deviceID 为空时断开全部设备。
+// 本节点的连接立即断开，用户在其他节点的连接按路由表转发给所在节点断开。
+func (s *AdminService) Kick(ctx context.Context, userID, deviceID, reason string) (AdminResult, error) {
+	result := AdminResult{Local: s.kickLocal(userID, deviceID, reason)}
+	if s.routes == nil {
+		return result, nil
+	}
+	nodes, err := s.routes.Lookup(ctx, []string{userID})
+	if err != nil {
+		return result, err
+	}
+	cmd := adminCommand{Op: "kick", UserID: userID, DeviceID: deviceID, Reason: reason}
+	for node := range nodes {
+		if node == s.nodeID {
+			continue
+		}
+		if err := s.send(ctx, node, cmd); err != nil {
+			return result, err
+		}
+		result.Forwarded = append(result.Forwarded, node)
+	}
+	sort.Strings(result.Forwarded)
+	return result, nil
+}
+
+// kickLocal 断开本节点上的连接，返回断开的连接数。
+// 关闭后读循环退出，按正常断开流程清理连接表、路由与在线状态。
+func (s *AdminService) kickLocal(userID, deviceID, reason string) int {
+	packet := model.OutputPacket{Cmd: model.CmdKick, Payload: KickNotice{Reason: reason}}
+	kicked := 0
+	for _, sess := range s.conns.Sessions(userID) {
+		if deviceID != "" && sess.DeviceID != deviceID {
+			continue
+		}
+		_ = sess.WriteJSON(packet)
+		_ = sess.Close()
+		kicked++
+	}
+	return kicked
+}
+
+// Broadcast 推送系统通知；userIDs 为空时推送给全部连接。
+// 本节点直接写出，其他节点按路由表转发（未指定用户时转发给全部节点）。
+func (s *AdminService) Broadcast(ctx context.Context, content string, userIDs []string) (AdminResult, error) {
+	notice := SystemNotice{Content: content, SentAt: time.Now().UnixMilli()}
+	result := AdminResult{Local: s.noticeLocal(notice, userIDs)}
+	if s.routes == nil {
+		return result, nil
+	}
+	cmd := adminCommand{Op: "notice", Notice: &notice}
+	if len(userIDs) == 0 {
+		if err := s.send(ctx, adminAllNodes, cmd); err != nil {
+			return result, err
+		}
+		result.Forwarded = []string{adminAllNodes}
+		return result, nil
+	}
+	nodes, err := s.routes.Lookup(ctx, userIDs)
+	if err != nil {
+		return result, err
+	}
+	for node, users := range nodes {
+		if node == s.nodeID {
+			continue
+		}
+		cmd.UserIDs = users
+		if err := s.send(ctx, node, cmd); err != nil {
+			return result, err
+		}
+		result.Forwarded = append(result.Forwarded, node)
+	}
+	sort.Strings(result.Forwarded)
+	return result, nil
+}
+
+// noticeLocal 向本节点的连接推送系统通知，userIDs 为空时推送给全部连接。返回成功写出的连接数。
+func (s *AdminService) noticeLocal(notice SystemNotice, userIDs []string) int {
+	packet := model.OutputPacket{Cmd: model.CmdNotice, Payload: notice}
+	sent := 0
+	write := func(sess *Session) {
+		if err := sess.WriteJSON(packet); err == nil {
+			sent++
+		}
+	}
+	if len(userIDs) == 0 {
+		s.conns.Range(func(_ string, sess *Session) bool {
+			write(sess)
+			return true
+		})
+		return sent
+	}
+	for _, userID := range userIDs {
+		for _, sess := range s.conns.Sessions(userID) {
+			write(sess)
+		}
+	}
+	return sent
+}
+
+// send 把运维命令发布到节点的运维频道。
+func (s *AdminService) send(ctx context.Context, node string, cmd adminCommand) error {
+	cmd.Origin = s.nodeID
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	return s.bus.Send(ctx, adminChannelPrefix+node, data)
+}
+
+// handleRemote 执行其他节点转发的运维命令。
+func (s *AdminService) handleRemote(raw []byte) {
+	var cmd adminCommand
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		log.Printf("解析跨节点运维命令失败: %v", err)
+		return
+	}
+	if cmd.Origin == s.nodeID {
+		return
+	}
+	switch cmd.Op {
+	case "kick":
+		n := s.kickLocal(cmd.UserID, cmd.DeviceID, cmd.Reason)
+		log.Printf("执行节点 %s 转发的踢下线 user=%s device=%s kicked=%d", cmd.Origin, cmd.UserID, cmd.DeviceID, n)
+	case "notice":
+		if cmd.Notice != nil {
+			s.noticeLocal(*cmd.Notice, cmd.UserIDs)
+		}
+	default:
+		log.Printf("未知的跨节点运维命令 op=%s", cmd.Op)
+	}
+}
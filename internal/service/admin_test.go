@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go-im/internal/model"
+)
+
+// dialSession 建立一条真实的 WebSocket 连接，返回服务端会话与客户端连接。
+func dialSession(t *testing.T, userID, deviceID string) (*Session, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return NewSession(userID, deviceID, <-accepted), client
+}
+
+func readPacket(t *testing.T, client *websocket.Conn) model.OutputPacket {
+	t.Helper()
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	var packet model.OutputPacket
+	if err := client.ReadJSON(&packet); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return packet
+}
+
+func TestAdminListAndInspectSessions(t *testing.T) {
+	conns := NewConnectionManager()
+	phone, _ := dialSession(t, "u1", "phone")
+	pc, _ := dialSession(t, "u1", "pc")
+	other, _ := dialSession(t, "u2", "")
+	conns.Add("u1", phone)
+	conns.Add("u1", pc)
+	conns.Add("u2", other)
+
+	tracker := NewDeliveryTracker(nil, DeliveryOptions{Timeout: time.Hour})
+	defer tracker.Stop()
+	tracker.Track(pc, "u1", model.TimelineMessage{MsgID: "m1"}, model.OutputPacket{Cmd: model.CmdPush})
+	admin := NewAdminService(conns).WithDeliveryTracker(tracker)
+
+	users, truncated := admin.ListUsers(10)
+	if len(users) != 2 || truncated {
+		t.Fatalf("expected 2 users, got %+v truncated=%v", users, truncated)
+	}
+	if users, truncated = admin.ListUsers(1); len(users) != 1 || !truncated {
+		t.Fatalf("expected truncated list, got %+v truncated=%v", users, truncated)
+	}
+
+	infos := admin.Sessions("u1")
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", infos)
+	}
+	byDevice := make(map[string]SessionInfo, len(infos))
+	for _, info := range infos {
+		byDevice[info.DeviceID] = info
+	}
+	if byDevice["pc"].PendingAcks != 1 || byDevice["phone"].PendingAcks != 0 || byDevice["phone"].RemoteAddr == "" {
+		t.Fatalf("unexpected sessions %+v", infos)
+	}
+}
+
+func TestAdminKickPushesReasonAndCloses(t *testing.T) {
+	conns := NewConnectionManager()
+	phone, phoneClient := dialSession(t, "u1", "phone")
+	pc, pcClient := dialSession(t, "u1", "pc")
+	conns.Add("u1", phone)
+	conns.Add("u1", pc)
+	admin := NewAdminService(conns)
+
+	if res, err := admin.Kick(context.Background(), "u1", "phone", "账号异常"); err != nil || res.Local != 1 {
+		t.Fatalf("expected 1 kicked, got %+v err=%v", res, err)
+	}
+	packet := readPacket(t, phoneClient)
+	if packet.Cmd != model.CmdKick || packet.Payload.(map[string]interface{})["reason"] != "账号异常" {
+		t.Fatalf("unexpected kick packet %+v", packet)
+	}
+	if _, _, err := phoneClient.ReadMessage(); err == nil {
+		t.Fatalf("expected kicked connection to be closed")
+	}
+
+	// 未被踢的设备仍可收到系统通知
+	if res, err := admin.Broadcast(context.Background(), "维护通知", nil); err != nil || res.Local != 1 {
+		t.Fatalf("expected notice sent to 1 session, got %+v err=%v", res, err)
+	}
+	if packet := readPacket(t, pcClient); packet.Cmd != model.CmdNotice {
+		t.Fatalf("unexpected notice packet %+v", packet)
+	}
+}
+
+// chanNodeBus 以进程内 channel 模拟节点间频道。
+type chanNodeBus map[string]chan []byte
+
+func (b chanNodeBus) Send(ctx context.Context, channel string, data []byte) error {
+	if ch, ok := b[channel]; ok {
+		ch <- data
+	}
+	return nil
+}
+
+func (b chanNodeBus) Receive(ctx context.Context, channel string) (<-chan []byte, error) {
+	return b[channel], nil
+}
+
+type adminRoutes map[string][]string // node -> users
+
+func (r adminRoutes) Lookup(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	for node, users := range r {
+		for _, u := range users {
+			if containsUser(userIDs, u) {
+				out[node] = append(out[node], u)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestAdminKickAndNoticeForwardToOwningNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := chanNodeBus{
+		"admin:node-a": make(chan []byte, 4),
+		"admin:node-b": make(chan []byte, 4),
+		"admin:*":      make(chan []byte, 4),
+	}
+	routes := adminRoutes{"node-b": {"u1"}}
+
+	connsB := NewConnectionManager()
+	phone, phoneClient := dialSession(t, "u1", "phone")
+	connsB.Add("u1", phone)
+	adminA := NewAdminService(NewConnectionManager()).WithCluster(routes, bus, "node-a")
+	adminB := NewAdminService(connsB).WithCluster(routes, bus, "node-b")
+	if err := adminB.Run(ctx); err != nil {
+		t.Fatalf("run node-b: %v", err)
+	}
+
+	res, err := adminA.Broadcast(ctx, "维护通知", []string{"u1"})
+	if err != nil || res.Local != 0 || len(res.Forwarded) != 1 || res.Forwarded[0] != "node-b" {
+		t.Fatalf("expected notice forwarded to node-b, got %+v err=%v", res, err)
+	}
+	if packet := readPacket(t, phoneClient); packet.Cmd != model.CmdNotice {
+		t.Fatalf("unexpected notice packet %+v", packet)
+	}
+
+	res, err = adminA.Kick(ctx, "u1", "", "账号异常")
+	if err != nil || res.Local != 0 || len(res.Forwarded) != 1 || res.Forwarded[0] != "node-b" {
+		t.Fatalf("expected kick forwarded to node-b, got %+v err=%v", res, err)
+	}
+	if packet := readPacket(t, phoneClient); packet.Cmd != model.CmdKick {
+		t.Fatalf("unexpected kick packet %+v", packet)
+	}
+	if _, _, err := phoneClient.ReadMessage(); err == nil {
+		t.Fatalf("expected kicked connection to be closed")
+	}
+	if len(bus["admin:node-a"]) != 0 {
+		t.Fatalf("node should not forward to itself")
+	}
+}
+
+func TestAdminNoticeToAllNodesSkipsOrigin(t *testing.T) {
+	bus := chanNodeBus{"admin:*": make(chan []byte, 1)}
+	conns := NewConnectionManager()
+	pc, pcClient := dialSession(t, "u1", "pc")
+	conns.Add("u1", pc)
+	admin := NewAdminService(conns).WithCluster(adminRoutes{}, bus, "node-a")
+
+	res, err := admin.Broadcast(context.Background(), "维护通知", nil)
+	if err != nil || res.Local != 1 || len(res.Forwarded) != 1 || res.Forwarded[0] != "*" {
+		t.Fatalf("expected local write and forward to all nodes, got %+v err=%v", res, err)
+	}
+	if packet := readPacket(t, pcClient); packet.Cmd != model.CmdNotice {
+		t.Fatalf("unexpected notice packet %+v", packet)
+	}
+	// 发起节点同样订阅全量频道，收到自己发出的命令时不能重复写出
+	admin.handleRemote(<-bus["admin:*"])
+	_ = pcClient.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := pcClient.ReadMessage(); err == nil {
+		t.Fatalf("origin node should not deliver its own notice twice")
+	}
+}
@@ -1,60 +1,181 @@
 package service
 
 import (
+	"hash/fnv"
 	"sync"
-
-	"github.com/gorilla/websocket"
+	"sync/atomic"
 )
 
-// ConnectionManager 负责管理所有在线的 WebSocket 连接，使用读写锁保证并发安全。
-type ConnectionManager struct {
+// connShardCount 连接表分片数，取 2 的幂以便按位与取模。
+const connShardCount = 64
+
+// connShard 是连接表的一个分片，持有自己的读写锁。
+type connShard struct {
 	mu    sync.RWMutex
-	conns map[string]*websocket.Conn
+	conns map[string]map[string]*Session // user_id -> device_id -> session
+}
+
+// ConnectionManager 负责管理所有在线的 WebSocket 连接。
+// 连接表按 user_id 哈希分片，每个分片独立加锁，不同用户的上下线互不阻塞；
+// 在线用户数与连接数用原子计数维护，查询为 O(1)。
+// 同一用户可在多个设备同时在线，按 device_id 区分。
+type ConnectionManager struct {
+	shards   [connShardCount]connShard
+	users    atomic.Int64
+	sessions atomic.Int64
 }
 
 // NewConnectionManager 创建一个连接管理器实例。
 func NewConnectionManager() *ConnectionManager {
-	return &ConnectionManager{
-		conns: make(map[string]*websocket.Conn),
+	m := &ConnectionManager{}
+	for i := range m.shards {
+		m.shards[i].conns = make(map[string]map[string]*Session)
 	}
+	return m
+}
+
+func (m *ConnectionManager) shard(userID string) *connShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	return &m.shards[h.Sum32()&(connShardCount-1)]
 }
 
-// Add 注册一个新的连接；如果同一用户已存在旧连接，则先关闭旧连接再覆盖。
-func (m *ConnectionManager) Add(userID string, conn *websocket.Conn) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Add 注册一个新的连接；如果同一用户的同一设备已存在旧连接，则先关闭旧连接再覆盖。
+func (m *ConnectionManager) Add(userID string, sess *Session) {
+	s := m.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if old, ok := m.conns[userID]; ok {
+	devices, ok := s.conns[userID]
+	if !ok {
+		devices = make(map[string]*Session)
+		s.conns[userID] = devices
+		m.users.Add(1)
+	}
+	if old, ok := devices[sess.DeviceID]; ok {
 		_ = old.Close()
+	} else {
+		m.sessions.Add(1)
+	}
+	devices[sess.DeviceID] = sess
+}
+
+// Remove 移除并关闭指定连接；仅当该设备当前登记的正是 sess 时才删除并返回 true，
+// 避免旧连接的读循环退出时误删同一设备的新连接。
+func (m *ConnectionManager) Remove(userID string, sess *Session) bool {
+	s := m.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := false
+	if devices, ok := s.conns[userID]; ok {
+		if cur, ok := devices[sess.DeviceID]; ok && cur == sess {
+			delete(devices, sess.DeviceID)
+			m.sessions.Add(-1)
+			removed = true
+		}
+		if len(devices) == 0 {
+			delete(s.conns, userID)
+			m.users.Add(-1)
+		}
+	}
+	_ = sess.Close()
+	return removed
+}
+
+// Get 返回指定用户全部在线设备的写入器，写入时逐个设备发送；若不在线则返回 nil。实现 ConnLookup。
+func (m *ConnectionManager) Get(userID string) ConnWriter {
+	devices := m.Devices(userID)
+	if len(devices) == 0 {
+		return nil
 	}
-	m.conns[userID] = conn
+	if len(devices) == 1 {
+		return devices[0]
+	}
+	return deviceGroup(devices)
 }
 
-// Remove 移除并关闭指定用户的连接。
-func (m *ConnectionManager) Remove(userID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Devices 返回指定用户当前在线的全部设备连接。实现 DeviceLookup。
+func (m *ConnectionManager) Devices(userID string) []ConnWriter {
+	s := m.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	devices := s.conns[userID]
+	out := make([]ConnWriter, 0, len(devices))
+	for _, sess := range devices {
+		out = append(out, sess)
+	}
+	return out
+}
 
-	if conn, ok := m.conns[userID]; ok {
-		_ = conn.Close()
-		delete(m.conns, userID)
+// Sessions 返回指定用户当前在线的全部会话。
+func (m *ConnectionManager) Sessions(userID string) []*Session {
+	s := m.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Session, 0, len(s.conns[userID]))
+	for _, sess := range s.conns[userID] {
+		out = append(out, sess)
 	}
+	return out
+}
+
+// OnlineUsers 返回当前在线用户数。
+func (m *ConnectionManager) OnlineUsers() int64 {
+	return m.users.Load()
 }
 
-// Get 返回指定用户的连接实例；若不存在则返回 nil。
-func (m *ConnectionManager) Get(userID string) *websocket.Conn {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.conns[userID]
+// OnlineSessions 返回当前连接数（同一用户多设备分别计数）。
+func (m *ConnectionManager) OnlineSessions() int64 {
+	return m.sessions.Load()
 }
 
-// ListIDs 返回当前在线的用户 ID 列表。
+// Range 逐个分片遍历全部连接，fn 返回 false 时停止。
+// 每次只对一个分片做快照，回调在锁外执行，可在回调中调用 Remove 等方法；
+// 遍历期间其他分片照常读写，结果不是全局一致的快照。
+func (m *ConnectionManager) Range(fn func(userID string, sess *Session) bool) {
+	var batch []*Session
+	for i := range m.shards {
+		s := &m.shards[i]
+		batch = batch[:0]
+		s.mu.RLock()
+		for _, devices := range s.conns {
+			for _, sess := range devices {
+				batch = append(batch, sess)
+			}
+		}
+		s.mu.RUnlock()
+		for _, sess := range batch {
+			if !fn(sess.UserID, sess) {
+				return
+			}
+		}
+	}
+}
+
+// ListIDs 返回当前在线的用户 ID 列表，逐分片收集，不阻塞整个连接表。
 func (m *ConnectionManager) ListIDs() []string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	ids := make([]string, 0, len(m.conns))
-	for id := range m.conns {
-		ids = append(ids, id)
+	ids := make([]string, 0, m.users.Load())
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for id := range s.conns {
+			ids = append(ids, id)
+		}
+		s.mu.RUnlock()
 	}
 	return ids
 }
+
+// deviceGroup 将一次写入扇出到同一用户的多个设备，单个设备失败不影响其他设备，返回首个错误。
+type deviceGroup []ConnWriter
+
+func (g deviceGroup) WriteJSON(v interface{}) error {
+	var err error
+	for _, w := range g {
+		if curErr := w.WriteJSON(v); curErr != nil && err == nil {
+			err = curErr
+		}
+	}
+	return err
+}
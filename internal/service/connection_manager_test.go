@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+func TestConnectionManagerCounters(t *testing.T) {
+	m := NewConnectionManager()
+	phone := NewSession("u1", "phone", nil)
+	m.Add("u1", phone)
+	m.Add("u1", NewSession("u1", "pc", nil))
+	m.Add("u2", NewSession("u2", "", nil))
+	if m.OnlineUsers() != 2 || m.OnlineSessions() != 3 {
+		t.Fatalf("expected 2 users / 3 sessions, got %d / %d", m.OnlineUsers(), m.OnlineSessions())
+	}
+
+	// 同一设备重连替换旧连接，连接数不变；旧连接稍后移除不影响新连接
+	newPhone := NewSession("u1", "phone", nil)
+	m.Add("u1", newPhone)
+	if m.Remove("u1", phone) {
+		t.Fatalf("stale session should not be removed")
+	}
+	if m.OnlineSessions() != 3 || len(m.Devices("u1")) != 2 {
+		t.Fatalf("expected 3 sessions after replace, got %d", m.OnlineSessions())
+	}
+
+	m.Remove("u1", newPhone)
+	for _, w := range m.Devices("u1") {
+		m.Remove("u1", w.(*Session))
+	}
+	if m.OnlineUsers() != 1 || m.OnlineSessions() != 1 || m.Get("u1") != nil {
+		t.Fatalf("expected 1 user / 1 session, got %d / %d", m.OnlineUsers(), m.OnlineSessions())
+	}
+}
+
+func TestConnectionManagerRangeAllowsRemove(t *testing.T) {
+	m := NewConnectionManager()
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("u%d", i)
+		m.Add(id, NewSession(id, "", nil))
+	}
+	visited := 0
+	m.Range(func(userID string, sess *Session) bool {
+		visited++
+		m.Remove(userID, sess)
+		return true
+	})
+	if visited != 200 || m.OnlineUsers() != 0 || m.OnlineSessions() != 0 || len(m.ListIDs()) != 0 {
+		t.Fatalf("visited=%d users=%d sessions=%d", visited, m.OnlineUsers(), m.OnlineSessions())
+	}
+
+	m.Add("a", NewSession("a", "", nil))
+	m.Add("b", NewSession("b", "", nil))
+	visited = 0
+	m.Range(func(string, *Session) bool { visited++; return false })
+	if visited != 1 {
+		t.Fatalf("expected Range to stop after first callback, visited %d", visited)
+	}
+}
+
+func TestConnectionManagerConcurrentAddRemove(t *testing.T) {
+	m := NewConnectionManager()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				id := fmt.Sprintf("u%d", i%50)
+				sess := NewSession(id, fmt.Sprintf("d%d-%d", w, i), nil)
+				m.Add(id, sess)
+				m.Devices(id)
+				m.Remove(id, sess)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if m.OnlineUsers() != 0 || m.OnlineSessions() != 0 {
+		t.Fatalf("expected empty manager, got %d users / %d sessions", m.OnlineUsers(), m.OnlineSessions())
+	}
+}
+
+// populateConnections 模拟 n 个在线用户，每人一个连接。
+func populateConnections(n int) (*ConnectionManager, []string) {
+	m := NewConnectionManager()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("user-%d", i)
+		m.Add(ids[i], NewSession(ids[i], "", nil))
+	}
+	return m, ids
+}
+
+// 10 万在线连接下的查找（推送路径）
+func BenchmarkConnectionManagerGet100k(b *testing.B) {
+	m, ids := populateConnections(100000)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Get(ids[i%len(ids)])
+			i++
+		}
+	})
+}
+
+// 10 万在线连接下的上下线与推送查找混合负载
+func BenchmarkConnectionManagerChurn100k(b *testing.B) {
+	m, ids := populateConnections(100000)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := ids[i%len(ids)]
+			if i%10 == 0 {
+				sess := NewSession(id, "bench", nil)
+				m.Add(id, sess)
+				m.Remove(id, sess)
+			} else {
+				m.Devices(id)
+			}
+			i++
+		}
+	})
+}
+
+// 10 万在线连接下的全量遍历
+func BenchmarkConnectionManagerRange100k(b *testing.B) {
+	m, _ := populateConnections(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		m.Range(func(string, *Session) bool { n++; return true })
+	}
+}
+
+type recordingStream struct {
+	writes []interface{}
+	closed bool
+}
+
+func (s *recordingStream) WriteJSON(v interface{}) error {
+	s.writes = append(s.writes, v)
+	return nil
+}
+
+func (s *recordingStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestStreamSessionPushAndReplace(t *testing.T) {
+	m := NewConnectionManager()
+	old := &recordingStream{}
+	m.Add("u1", NewStreamSession("u1", "web", TransportSSE, "10.0.0.1:5000", old))
+
+	push := NewPushService(m)
+	if err := push.Broadcast(context.Background(), model.OutputPacket{Cmd: model.CmdNotice}, []string{"u1"}); err != nil {
+		t.Fatalf("Broadcast returned error: %v", err)
+	}
+	if len(old.writes) != 1 {
+		t.Fatalf("expected push delivered over stream, got %d writes", len(old.writes))
+	}
+
+	// 同一设备改用 SSE 重连时旧通道被关闭
+	m.Add("u1", NewStreamSession("u1", "web", TransportSSE, "10.0.0.1:5001", &recordingStream{}))
+	if !old.closed || m.OnlineSessions() != 1 {
+		t.Fatalf("expected old stream closed and replaced, closed=%v sessions=%d", old.closed, m.OnlineSessions())
+	}
+}
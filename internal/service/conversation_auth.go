@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// ErrForbidden 表示发送者不是会话参与者（单聊）或成员（群聊）。
+var ErrForbidden = errors.New("sender is not a participant of the conversation")
+
+// Authorize 解析会话并校验发送者权限，返回规范化后的会话信息。
+// 配置了注册表时未登记的会话一律拒绝；兼容路径下无法识别的会话保持放行。
+func (s *MessageService) Authorize(ctx context.Context, userID, conversationID string) (ConversationInfo, error) {
+	conv, err := s.participants().Resolve(ctx, conversationID, userID)
+	if err != nil {
+		return ConversationInfo{}, err
+	}
+	if conv.Type == 0 && s.resolver == nil {
+		return conv, nil
+	}
+	if !containsUser(conv.Participants, userID) {
+		return conv, ErrForbidden
+	}
+	return conv, nil
+}
+
+// CachedResolver 在进程内缓存参与者解析结果，避免每条消息都查询 MySQL。
+// 仅缓存已登记且以规范 ID 查询的会话；成员变更最多延迟 ttl 生效。
+type CachedResolver struct {
+	inner      ParticipantResolver
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cachedConversation
+}
+
+type cachedConversation struct {
+	info      ConversationInfo
+	expiresAt time.Time
+}
+
+func NewCachedResolver(inner ParticipantResolver, ttl time.Duration, maxEntries int) *CachedResolver {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &CachedResolver{
+		inner:      inner,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cachedConversation),
+	}
+}
+
+func (c *CachedResolver) Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[conversationID]; ok && now.Before(e.expiresAt) {
+		c.mu.Unlock()
+		return e.info, nil
+	}
+	c.mu.Unlock()
+
+	info, err := c.inner.Resolve(ctx, conversationID, senderID)
+	if err != nil || info.Type == 0 || info.ID != conversationID {
+		return info, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.maxEntries {
+		c.evictExpired(now)
+		if len(c.entries) >= c.maxEntries {
+			// 仍然满：整体清空，简单且足以防止无限增长
+			c.entries = make(map[string]cachedConversation)
+		}
+	}
+	c.entries[conversationID] = cachedConversation{info: info, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return info, nil
+}
+
+// Invalidate 使指定会话的缓存失效，成员变更后调用。
+func (c *CachedResolver) Invalidate(conversationID string) {
+	c.mu.Lock()
+	delete(c.entries, conversationID)
+	c.mu.Unlock()
+}
+
+func (c *CachedResolver) evictExpired(now time.Time) {
+	for id, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// forbiddenPacket 是越权发送时返回给客户端的回包。
+func forbiddenPacket(msgID string) model.OutputPacket {
+	return model.OutputPacket{Cmd: model.CmdChat, Code: 403, MsgId: msgID, Payload: "无权在该会话发送消息"}
+}
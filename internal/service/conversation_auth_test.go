@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+type countingResolver struct {
+	info  ConversationInfo
+	calls int
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	r.calls++
+	return r.info, nil
+}
+
+func TestHandleChatRejectsNonParticipantBeforeSeq(t *testing.T) {
+	store := newStubConvStore()
+	seqGen := &stubSeqGen{}
+	repo := newStubMsgRepo()
+	svc := NewMessageServiceWithSeq(repo, seqGen).WithConversationRegistry(NewConversationRegistry(store, store))
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "private_u1_u2", MsgId: "f-1"}
+	out, err := svc.HandleChat(context.Background(), "u3", packet, ChatPayload{Content: "hi"})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if out.Code != 403 {
+		t.Fatalf("expected Code=403, got %d", out.Code)
+	}
+	if seqGen.seq != 0 || len(repo.store) != 0 {
+		t.Fatalf("forbidden message must not allocate seq or persist, seq=%d saved=%d", seqGen.seq, len(repo.store))
+	}
+}
+
+func TestAuthorizeGroupMembership(t *testing.T) {
+	store := newStubConvStore()
+	store.members["group_1"] = []string{"u1", "u2"}
+	svc := NewMessageService(newStubMsgRepo()).WithConversationRegistry(NewConversationRegistry(store, store))
+
+	if _, err := svc.Authorize(context.Background(), "u2", "group_1"); err != nil {
+		t.Fatalf("member should be allowed, got %v", err)
+	}
+	if _, err := svc.Authorize(context.Background(), "u9", "group_1"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("non-member should be forbidden, got %v", err)
+	}
+	// 配置注册表后，未登记且无法推断的会话一律拒绝
+	if _, err := svc.Authorize(context.Background(), "u1", "conv-unknown"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unknown conversation should be forbidden, got %v", err)
+	}
+}
+
+func TestCachedResolverServesRepeatedLookups(t *testing.T) {
+	inner := &countingResolver{info: ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1"}}}
+	cache := NewCachedResolver(inner, time.Minute, 10)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Resolve(context.Background(), "group_1", "u1"); err != nil {
+			t.Fatalf("Resolve returned error: %v", err)
+		}
+	}
+	if inner.calls != 1 {
+		t.Fatalf("expected 1 upstream lookup, got %d", inner.calls)
+	}
+	cache.Invalidate("group_1")
+	_, _ = cache.Resolve(context.Background(), "group_1", "u1")
+	if inner.calls != 2 {
+		t.Fatalf("expected lookup after invalidate, got %d", inner.calls)
+	}
+
+	// 旧格式 ID（解析结果 ID 不同）不缓存
+	inner.info.ID = "private_u1_u2"
+	_, _ = cache.Resolve(context.Background(), "private_u2_u1", "u1")
+	_, _ = cache.Resolve(context.Background(), "private_u2_u1", "u1")
+	if inner.calls != 4 {
+		t.Fatalf("legacy ids should not be cached, calls=%d", inner.calls)
+	}
+}
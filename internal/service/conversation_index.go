@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConversationIndex 维护“我的会话”索引：每个用户参与的会话按最后活跃时间排序。
+// 读扩散大群不逐个刷新成员索引，只记录群的活跃时间（TouchGroup），列表读取时按成员所在的群合并。
+type ConversationIndex interface {
+	Touch(ctx context.Context, conversationID string, activeAt int64, userIDs []string) error
+	List(ctx context.Context, userID string, after ConversationEntry, limit int) ([]ConversationEntry, error)
+	TouchGroup(ctx context.Context, conversationID string, activeAt int64) error
+	GroupActiveAt(ctx context.Context, conversationIDs []string) (map[string]int64, error)
+}
+
+// ConversationEntry 是会话索引中的一项。
+type ConversationEntry struct {
+	ConversationID string
+	LastActiveAt   int64 // 毫秒
+}
+
+// RedisConversationIndex 使用 Sorted Set 实现会话索引。
+// Key：{prefix}{user_id}，Score：最后活跃时间（毫秒），Member：conversation_id。
+// 读扩散群的活跃时间记录在单独的 groupKey（Member：conversation_id）。
+type RedisConversationIndex struct {
+	client    *redis.Client
+	keyPrefix string
+	groupKey  string
+	maxLen    int64 // 单个用户保留的会话数上限，<=0 表示不限制
+}
+
+func NewRedisConversationIndex(client *redis.Client, prefix, groupKey string, maxLen int64) *RedisConversationIndex {
+	return &RedisConversationIndex{client: client, keyPrefix: prefix, groupKey: groupKey, maxLen: maxLen}
+}
+
+// Touch 刷新会话在这些用户索引中的活跃时间。
+func (x *RedisConversationIndex) Touch(ctx context.Context, conversationID string, activeAt int64, userIDs []string) error {
+	if x.client == nil || len(userIDs) == 0 {
+		return nil
+	}
+	pipe := x.client.Pipeline()
+	for _, uid := range userIDs {
+		if uid == "" {
+			continue
+		}
+		key := x.keyPrefix + uid
+		// GT：乱序到达的旧消息不会把会话的活跃时间往回拨
+		pipe.ZAddGT(ctx, key, redis.Z{Score: float64(activeAt), Member: conversationID})
+		if x.maxLen > 0 {
+			pipe.ZRemRangeByRank(ctx, key, 0, -x.maxLen-1)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TouchGroup 刷新读扩散群的活跃时间，每条消息一次 ZADD，与群成员数无关。
+func (x *RedisConversationIndex) TouchGroup(ctx context.Context, conversationID string, activeAt int64) error {
+	if x.client == nil {
+		return nil
+	}
+	return x.client.ZAddGT(ctx, x.groupKey, redis.Z{Score: float64(activeAt), Member: conversationID}).Err()
+}
+
+// GroupActiveAt 批量查询群的活跃时间，未记录过（非读扩散群）的会话不出现在结果中。
+func (x *RedisConversationIndex) GroupActiveAt(ctx context.Context, conversationIDs []string) (map[string]int64, error) {
+	out := make(map[string]int64)
+	if x.client == nil || len(conversationIDs) == 0 {
+		return out, nil
+	}
+	scores, err := x.client.ZMScore(ctx, x.groupKey, conversationIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, score := range scores {
+		if score > 0 {
+			out[conversationIDs[i]] = int64(score)
+		}
+	}
+	return out, nil
+}
+
+// List 按 (活跃时间, conversation_id) 倒序返回排在 after 之后的会话；after 为上一页最后一项，零值表示从最新开始。
+// 活跃时间相同的会话按 conversation_id 逆字典序排列（与 ZREVRANGEBYSCORE 一致），翻页时不会遗漏同分会话。
+func (x *RedisConversationIndex) List(ctx context.Context, userID string, after ConversationEntry, limit int) ([]ConversationEntry, error) {
+	if x.client == nil {
+		return nil, nil
+	}
+	key := x.keyPrefix + userID
+	max := "+inf"
+	count := int64(limit)
+	if after.LastActiveAt > 0 {
+		// 包含与游标同分的会话，多取同分的条数，再在内存中过滤掉游标及之前的部分
+		max = strconv.FormatInt(after.LastActiveAt, 10)
+		ties, err := x.client.ZCount(ctx, key, max, max).Result()
+		if err != nil {
+			return nil, err
+		}
+		count += ties
+	}
+	zs, err := x.client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   max,
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ConversationEntry, 0, limit)
+	for _, z := range zs {
+		entry := ConversationEntry{LastActiveAt: int64(z.Score)}
+		entry.ConversationID, _ = z.Member.(string)
+		if !after.before(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// before 判断 e 是否排在游标 c 之后；零值游标表示从最新开始，所有会话都在其后。
+func (c ConversationEntry) before(e ConversationEntry) bool {
+	if c.LastActiveAt <= 0 {
+		return true
+	}
+	if e.LastActiveAt != c.LastActiveAt {
+		return e.LastActiveAt < c.LastActiveAt
+	}
+	return e.ConversationID < c.ConversationID
+}
@@ -0,0 +1,470 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	privateConvPrefix = "private_"
+	groupConvPrefix   = "group_"
+	maxConvIDLen      = 64
+
+	maxCanonicalAliases = 100000 // CanonicalID 进程内缓存的条目上限
+)
+
+// ErrConversationNotFound 表示会话未在 conversation 表中登记，且无法从旧格式 ID 推断。
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationInfo 是参与者解析的结果，ID 为规范化后的会话 ID。
+type ConversationInfo struct {
+	ID           string
+	Type         int8 // model.ConversationTypePrivate / model.ConversationTypeGroup，0 表示未知会话
+	Participants []string
+}
+
+// ParticipantResolver 解析会话的规范 ID、类型与参与者，由 ConversationRegistry 实现。
+type ParticipantResolver interface {
+	Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error)
+}
+
+// ConversationStore 抽象 conversation 表的读写，便于测试替换。
+type ConversationStore interface {
+	FindConversation(ctx context.Context, conversationID string) (*model.Conversation, error)
+	CreateConversation(ctx context.Context, conv *model.Conversation) (*model.Conversation, error)
+	AddGroupMembers(ctx context.Context, members []model.GroupMember) error
+	RemoveGroupMembers(ctx context.Context, groupID string, userIDs []string) error
+	FindPrivateConversation(ctx context.Context, peerA, peerB string) (*model.Conversation, error)
+	HasMessages(ctx context.Context, conversationID string) (bool, error)
+}
+
+// ConversationRegistry 是会话元数据与参与者解析的唯一入口：
+// 单聊参与者存放在 conversation 表，群聊成员来自 group_member。
+// 未登记的旧格式会话（private_a_b / group_x）在首次解析时自动登记；
+// 旧格式单聊 ID 下已有消息时沿用旧 ID 登记，Timeline、seq、Inbox 与缓存无需迁移。
+type ConversationRegistry struct {
+	store       ConversationStore
+	members     GroupMemberSource
+	roles       GroupRoleSource         // 可选：为 nil 时不支持增删成员
+	invalidator ConversationInvalidator // 可选：成员变更后使参与者缓存失效
+
+	aliases    sync.Map // 客户端传入的单聊 ID -> 已登记的会话 ID
+	aliasCount atomic.Int64
+}
+
+// ConversationInvalidator 在会话成员变更后使参与者缓存失效，由 CachedResolver 实现。
+type ConversationInvalidator interface {
+	Invalidate(conversationID string)
+}
+
+func NewConversationRegistry(store ConversationStore, members GroupMemberSource) *ConversationRegistry {
+	return &ConversationRegistry{store: store, members: members}
+}
+
+// WithGroupRoles 注入群成员角色，启用 AddMembers / RemoveMembers。
+func (r *ConversationRegistry) WithGroupRoles(roles GroupRoleSource) *ConversationRegistry {
+	r.roles = roles
+	return r
+}
+
+// WithInvalidator 注入参与者缓存，建群与增删成员后立即失效，而不必等 TTL 过期。
+// 缓存是进程内的，其他节点仍按 TTL 生效。
+func (r *ConversationRegistry) WithInvalidator(inv ConversationInvalidator) *ConversationRegistry {
+	r.invalidator = inv
+	return r
+}
+
+// CanonicalPrivateID 返回两名用户单聊的规范会话 ID，与参数顺序无关。
+// 双方 ID 都不含下划线且长度允许时沿用可读的 private_{小}_{大}；
+// 否则使用 private_{sha256 前 40 位}，该形式前缀之后不含下划线，不会与可读形式冲突。
+func CanonicalPrivateID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	id := privateConvPrefix + a + "_" + b
+	if !strings.Contains(a, "_") && !strings.Contains(b, "_") && len(id) <= maxConvIDLen {
+		return id
+	}
+	sum := sha256.Sum256([]byte(a + "\x00" + b))
+	return privateConvPrefix + hex.EncodeToString(sum[:])[:40]
+}
+
+// CanonicalConversationID 将客户端传入的旧格式单聊 ID 规范化，userID 用于在含下划线时切分；
+// 无法识别的 ID 原样返回。只用于推算新会话的 ID，已登记会话请使用 ConversationRegistry.CanonicalID。
+func CanonicalConversationID(conversationID, userID string) string {
+	a, b, ok := splitLegacyPrivateID(conversationID, userID)
+	if !ok {
+		return conversationID
+	}
+	return CanonicalPrivateID(a, b)
+}
+
+// splitLegacyPrivateID 解析 private_{a}_{b}。优先按发送者 ID 切分，以支持含下划线的用户 ID；
+// 不含发送者时只接受恰好两段的形式。
+func splitLegacyPrivateID(conversationID, senderID string) (string, string, bool) {
+	if !strings.HasPrefix(conversationID, privateConvPrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(conversationID, privateConvPrefix)
+	if senderID != "" {
+		if peer, ok := strings.CutPrefix(rest, senderID+"_"); ok && peer != "" {
+			return senderID, peer, true
+		}
+		if peer, ok := strings.CutSuffix(rest, "_"+senderID); ok && peer != "" {
+			return peer, senderID, true
+		}
+	}
+	parts := strings.Split(rest, "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Get 查询会话元数据。
+func (r *ConversationRegistry) Get(ctx context.Context, conversationID string) (*model.Conversation, error) {
+	conv, err := r.store.FindConversation(ctx, conversationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConversationNotFound
+	}
+	return conv, err
+}
+
+// CanonicalID 返回客户端传入的会话 ID 实际对应的会话 ID：
+// 已登记的 ID 原样返回；单聊 ID 返回这两人已登记的会话（可能是沿用的旧 ID）；
+// 尚未登记时，旧 ID 下已有消息则返回旧 ID，否则返回规范 ID。非单聊 ID 不查库。
+// 登记后的映射不再变化，命中后缓存在进程内。
+func (r *ConversationRegistry) CanonicalID(ctx context.Context, conversationID, userID string) (string, error) {
+	a, b, ok := splitLegacyPrivateID(conversationID, userID)
+	if !ok || a == b {
+		return conversationID, nil
+	}
+	if id, ok := r.aliases.Load(conversationID); ok {
+		return id.(string), nil
+	}
+	if _, err := r.store.FindConversation(ctx, conversationID); err == nil {
+		r.remember(conversationID, conversationID)
+		return conversationID, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	peerA, peerB := sortedPair(a, b)
+	conv, err := r.store.FindPrivateConversation(ctx, peerA, peerB)
+	if err == nil {
+		r.remember(conversationID, conv.ConversationID)
+		return conv.ConversationID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	return r.privateIDFor(ctx, conversationID, a, b)
+}
+
+// remember 缓存 ID 映射；条目过多时整体清空，避免无界增长。
+func (r *ConversationRegistry) remember(conversationID, registeredID string) {
+	if r.aliasCount.Add(1) > maxCanonicalAliases {
+		r.aliases.Range(func(k, _ interface{}) bool {
+			r.aliases.Delete(k)
+			return true
+		})
+		r.aliasCount.Store(1)
+	}
+	r.aliases.Store(conversationID, registeredID)
+}
+
+// privateIDFor 决定未登记单聊的会话 ID：旧 ID 下已有消息时沿用旧 ID，否则使用规范 ID。
+func (r *ConversationRegistry) privateIDFor(ctx context.Context, legacyID, a, b string) (string, error) {
+	id := CanonicalPrivateID(a, b)
+	if legacyID == "" || legacyID == id {
+		return id, nil
+	}
+	has, err := r.store.HasMessages(ctx, legacyID)
+	if err != nil {
+		return "", err
+	}
+	if has {
+		return legacyID, nil
+	}
+	return id, nil
+}
+
+// EnsurePrivate 返回两名用户的单聊会话，不存在时以规范 ID 创建。
+func (r *ConversationRegistry) EnsurePrivate(ctx context.Context, userA, userB, creatorID string) (*model.Conversation, error) {
+	return r.ensurePrivate(ctx, "", userA, userB, creatorID)
+}
+
+// ensurePrivate 返回两人已登记的单聊；不存在时按 privateIDFor 选择 ID 登记。
+func (r *ConversationRegistry) ensurePrivate(ctx context.Context, legacyID, userA, userB, creatorID string) (*model.Conversation, error) {
+	if userA == "" || userB == "" || userA == userB {
+		return nil, errors.New("单聊需要两个不同的用户")
+	}
+	userA, userB = sortedPair(userA, userB)
+	conv, err := r.store.FindPrivateConversation(ctx, userA, userB)
+	if err == nil {
+		return conv, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	id, err := r.privateIDFor(ctx, legacyID, userA, userB)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.CreateConversation(ctx, &model.Conversation{
+		ConversationID: id,
+		Type:           model.ConversationTypePrivate,
+		CreatorID:      creatorID,
+		PeerA:          userA,
+		PeerB:          userB,
+	})
+}
+
+func sortedPair(a, b string) (string, string) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// GroupSpec 描述创建群聊所需的元数据。
+type GroupSpec struct {
+	ConversationID string   `json:"conversation_id"`
+	Title          string   `json:"title"`
+	Avatar         string   `json:"avatar"`
+	CreatorID      string   `json:"creator_id"`
+	Settings       string   `json:"settings"`
+	Members        []string `json:"members"`
+}
+
+// CreateGroup 登记群聊并写入初始成员，创建者为群主。
+func (r *ConversationRegistry) CreateGroup(ctx context.Context, spec GroupSpec) (*model.Conversation, error) {
+	if spec.ConversationID == "" || spec.CreatorID == "" {
+		return nil, errors.New("conversation_id 与 creator_id 不能为空")
+	}
+	if strings.HasPrefix(spec.ConversationID, privateConvPrefix) {
+		return nil, errors.New("群聊 ID 不能使用 private_ 前缀")
+	}
+	conv, err := r.store.CreateConversation(ctx, &model.Conversation{
+		ConversationID: spec.ConversationID,
+		Type:           model.ConversationTypeGroup,
+		Title:          spec.Title,
+		Avatar:         spec.Avatar,
+		CreatorID:      spec.CreatorID,
+		Settings:       spec.Settings,
+	})
+	if err != nil {
+		return nil, err
+	}
+	joinTime := time.Now().UnixMilli()
+	members := []model.GroupMember{{GroupID: conv.ConversationID, UserID: spec.CreatorID, JoinTime: joinTime, Role: model.GroupRoleOwner}}
+	for _, uid := range spec.Members {
+		if uid != "" && uid != spec.CreatorID {
+			members = append(members, model.GroupMember{GroupID: conv.ConversationID, UserID: uid, JoinTime: joinTime})
+		}
+	}
+	if err := r.store.AddGroupMembers(ctx, members); err != nil {
+		return nil, err
+	}
+	// 同 ID 的群可能已按旧格式解析并缓存
+	r.invalidate(conv.ConversationID)
+	return conv, nil
+}
+
+// AddMembers 向已登记的群聊加入成员，operatorID 须为群主或管理员；已在群内的成员保持不变。
+func (r *ConversationRegistry) AddMembers(ctx context.Context, groupID, operatorID string, userIDs []string) error {
+	if err := r.checkGroupAdmin(ctx, groupID, operatorID); err != nil {
+		return err
+	}
+	joinTime := time.Now().UnixMilli()
+	members := make([]model.GroupMember, 0, len(userIDs))
+	for _, uid := range userIDs {
+		if uid != "" {
+			members = append(members, model.GroupMember{GroupID: groupID, UserID: uid, JoinTime: joinTime})
+		}
+	}
+	if err := r.store.AddGroupMembers(ctx, members); err != nil {
+		return err
+	}
+	r.invalidate(groupID)
+	return nil
+}
+
+// RemoveMembers 移除群成员：群主或管理员可移除他人，普通成员只能移除自己（退群）；群主不能被移除。
+func (r *ConversationRegistry) RemoveMembers(ctx context.Context, groupID, operatorID string, userIDs []string) error {
+	self := len(userIDs) == 1 && userIDs[0] == operatorID
+	if !self {
+		if err := r.checkGroupAdmin(ctx, groupID, operatorID); err != nil {
+			return err
+		}
+	} else if _, err := r.groupConversation(ctx, groupID); err != nil {
+		return err
+	}
+	for _, uid := range userIDs {
+		role, err := r.roles.GetRole(ctx, groupID, uid)
+		if err == nil && role == model.GroupRoleOwner {
+			return ErrForbidden
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	if err := r.store.RemoveGroupMembers(ctx, groupID, userIDs); err != nil {
+		return err
+	}
+	r.invalidate(groupID)
+	return nil
+}
+
+// checkGroupAdmin 校验会话是已登记的群聊且 operatorID 为群主或管理员。
+func (r *ConversationRegistry) checkGroupAdmin(ctx context.Context, groupID, operatorID string) error {
+	if _, err := r.groupConversation(ctx, groupID); err != nil {
+		return err
+	}
+	role, err := r.roles.GetRole(ctx, groupID, operatorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if role != model.GroupRoleOwner && role != model.GroupRoleAdmin {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// groupConversation 返回已登记的群聊；不存在或不是群聊时返回 ErrConversationNotFound。
+func (r *ConversationRegistry) groupConversation(ctx context.Context, groupID string) (*model.Conversation, error) {
+	if r.roles == nil {
+		return nil, errors.New("group roles not configured")
+	}
+	conv, err := r.Get(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.Type != model.ConversationTypeGroup {
+		return nil, ErrConversationNotFound
+	}
+	return conv, nil
+}
+
+func (r *ConversationRegistry) invalidate(conversationID string) {
+	if r.invalidator != nil {
+		r.invalidator.Invalidate(conversationID)
+	}
+}
+
+// Resolve 返回会话的规范 ID、类型与参与者。
+// 未登记的会话：旧格式单聊按 ID 切分后登记，group_ 前缀且有成员的群聊自动登记，
+// 其余返回 Type=0 的空结果（只落 Timeline，不扩散）。
+func (r *ConversationRegistry) Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	return r.resolve(ctx, conversationID, senderID, true)
+}
+
+// Lookup 与 Resolve 的解析规则相同，但未登记的会话只推断参与者、不写 conversation 表，
+// 供离线工具（如 inbox-rebuild -dry-run）只读使用。
+func (r *ConversationRegistry) Lookup(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	return r.resolve(ctx, conversationID, senderID, false)
+}
+
+// ReadOnly 返回以 Lookup 实现的 ParticipantResolver。
+func (r *ConversationRegistry) ReadOnly() ParticipantResolver {
+	return readOnlyRegistry{r}
+}
+
+type readOnlyRegistry struct {
+	registry *ConversationRegistry
+}
+
+func (r readOnlyRegistry) Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	return r.registry.Lookup(ctx, conversationID, senderID)
+}
+
+// resolve 是 Resolve / Lookup 的共同实现，register 为 false 时不登记未知会话。
+func (r *ConversationRegistry) resolve(ctx context.Context, conversationID, senderID string, register bool) (ConversationInfo, error) {
+	conv, err := r.store.FindConversation(ctx, conversationID)
+	if err == nil {
+		return r.infoOf(ctx, conv)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ConversationInfo{}, err
+	}
+
+	if a, b, ok := splitLegacyPrivateID(conversationID, senderID); ok && a != b {
+		if !register || (senderID != a && senderID != b) {
+			// 先校验再登记：非参与者不能以自己为创建者登记他人的单聊，由 Authorize 拒绝；只读查询同样不登记
+			return ConversationInfo{ID: conversationID, Type: model.ConversationTypePrivate, Participants: []string{a, b}}, nil
+		}
+		conv, err := r.ensurePrivate(ctx, conversationID, a, b, senderID)
+		if err != nil {
+			return ConversationInfo{}, err
+		}
+		return r.infoOf(ctx, conv)
+	}
+	if strings.HasPrefix(conversationID, groupConvPrefix) && r.members != nil {
+		members, err := r.members.ListMembers(ctx, conversationID)
+		if err != nil {
+			return ConversationInfo{}, err
+		}
+		if len(members) > 0 {
+			if register {
+				if _, err := r.store.CreateConversation(ctx, &model.Conversation{
+					ConversationID: conversationID,
+					Type:           model.ConversationTypeGroup,
+				}); err != nil {
+					return ConversationInfo{}, err
+				}
+			}
+			// 登记前按未知会话（Type=0）解析的结果不会被缓存，这里无需失效
+			return ConversationInfo{ID: conversationID, Type: model.ConversationTypeGroup, Participants: members}, nil
+		}
+	}
+	return ConversationInfo{ID: conversationID}, nil
+}
+
+func (r *ConversationRegistry) infoOf(ctx context.Context, conv *model.Conversation) (ConversationInfo, error) {
+	info := ConversationInfo{ID: conv.ConversationID, Type: conv.Type}
+	switch conv.Type {
+	case model.ConversationTypePrivate:
+		info.Participants = []string{conv.PeerA, conv.PeerB}
+	case model.ConversationTypeGroup:
+		if r.members != nil {
+			members, err := r.members.ListMembers(ctx, conv.ConversationID)
+			if err != nil {
+				return ConversationInfo{}, err
+			}
+			info.Participants = members
+		}
+	}
+	return info, nil
+}
+
+// legacyResolver 在未配置 ConversationRegistry 时按 ID 前缀推断参与者，保持旧行为。
+type legacyResolver struct {
+	members GroupMemberSource
+}
+
+func (r legacyResolver) Resolve(ctx context.Context, conversationID, senderID string) (ConversationInfo, error) {
+	// 不追加发送者，参与者仅来自会话 ID 本身，便于权限校验
+	if users := parsePrivateParticipants(conversationID, ""); len(users) > 0 {
+		return ConversationInfo{ID: conversationID, Type: model.ConversationTypePrivate, Participants: users}, nil
+	}
+	if r.members == nil || !strings.HasPrefix(conversationID, groupConvPrefix) {
+		return ConversationInfo{ID: conversationID}, nil
+	}
+	members, err := r.members.ListMembers(ctx, conversationID)
+	if err != nil {
+		return ConversationInfo{}, err
+	}
+	return ConversationInfo{ID: conversationID, Type: model.ConversationTypeGroup, Participants: members}, nil
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type stubConvStore struct {
+	convs    map[string]model.Conversation
+	members  map[string][]string
+	roles    map[string]int8 // group_id + "/" + user_id -> 角色
+	messages map[string]bool // 已有消息的会话 ID
+}
+
+func newStubConvStore() *stubConvStore {
+	return &stubConvStore{
+		convs:    make(map[string]model.Conversation),
+		members:  make(map[string][]string),
+		roles:    make(map[string]int8),
+		messages: make(map[string]bool),
+	}
+}
+
+func (s *stubConvStore) FindConversation(ctx context.Context, conversationID string) (*model.Conversation, error) {
+	conv, ok := s.convs[conversationID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &conv, nil
+}
+
+func (s *stubConvStore) CreateConversation(ctx context.Context, conv *model.Conversation) (*model.Conversation, error) {
+	if _, ok := s.convs[conv.ConversationID]; !ok {
+		s.convs[conv.ConversationID] = *conv
+	}
+	return s.FindConversation(ctx, conv.ConversationID)
+}
+
+func (s *stubConvStore) FindPrivateConversation(ctx context.Context, peerA, peerB string) (*model.Conversation, error) {
+	for _, conv := range s.convs {
+		if conv.Type == model.ConversationTypePrivate && conv.PeerA == peerA && conv.PeerB == peerB {
+			return &conv, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *stubConvStore) HasMessages(ctx context.Context, conversationID string) (bool, error) {
+	return s.messages[conversationID], nil
+}
+
+func (s *stubConvStore) AddGroupMembers(ctx context.Context, members []model.GroupMember) error {
+	for _, m := range members {
+		if _, ok := s.roles[m.GroupID+"/"+m.UserID]; ok {
+			continue
+		}
+		s.members[m.GroupID] = append(s.members[m.GroupID], m.UserID)
+		s.roles[m.GroupID+"/"+m.UserID] = m.Role
+	}
+	return nil
+}
+
+func (s *stubConvStore) RemoveGroupMembers(ctx context.Context, groupID string, userIDs []string) error {
+	for _, uid := range userIDs {
+		delete(s.roles, groupID+"/"+uid)
+		kept := s.members[groupID][:0]
+		for _, m := range s.members[groupID] {
+			if m != uid {
+				kept = append(kept, m)
+			}
+		}
+		s.members[groupID] = kept
+	}
+	return nil
+}
+
+func (s *stubConvStore) GetRole(ctx context.Context, groupID, userID string) (int8, error) {
+	role, ok := s.roles[groupID+"/"+userID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return role, nil
+}
+
+func (s *stubConvStore) ListMembers(ctx context.Context, groupID string) ([]string, error) {
+	return s.members[groupID], nil
+}
+
+func TestCanonicalPrivateID(t *testing.T) {
+	if a, b := CanonicalPrivateID("u2", "u1"), CanonicalPrivateID("u1", "u2"); a != b || a != "private_u1_u2" {
+		t.Fatalf("expected order-independent readable id, got %s / %s", a, b)
+	}
+	// 含下划线的两组用户拼接后相同，规范 ID 必须不同
+	x, y := CanonicalPrivateID("a_b", "c"), CanonicalPrivateID("a", "b_c")
+	if x == y {
+		t.Fatalf("ambiguous pairs collided: %s", x)
+	}
+	if strings.Contains(strings.TrimPrefix(x, "private_"), "_") || len(x) > 64 {
+		t.Fatalf("hashed id should not contain underscore after prefix: %s", x)
+	}
+}
+
+func TestRegistryResolvesLegacyPrivateIDWithUnderscores(t *testing.T) {
+	store := newStubConvStore()
+	reg := NewConversationRegistry(store, store)
+
+	info, err := reg.Resolve(context.Background(), "private_john_doe_bob", "john_doe")
+	if err != nil {
+		t.Fatalf("Resolve returned error: %v", err)
+	}
+	if info.ID != CanonicalPrivateID("bob", "john_doe") || info.Type != model.ConversationTypePrivate {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if len(info.Participants) != 2 || !containsUser(info.Participants, "john_doe") || !containsUser(info.Participants, "bob") {
+		t.Fatalf("unexpected participants: %v", info.Participants)
+	}
+	if _, ok := store.convs[info.ID]; !ok {
+		t.Fatalf("legacy conversation should be registered")
+	}
+
+	// 已登记的规范 ID 直接命中
+	again, err := reg.Resolve(context.Background(), info.ID, "bob")
+	if err != nil || again.ID != info.ID || len(again.Participants) != 2 {
+		t.Fatalf("expected registered lookup, got %+v err=%v", again, err)
+	}
+}
+
+func TestRegistryKeepsLegacyPrivateIDWithExistingMessages(t *testing.T) {
+	store := newStubConvStore()
+	store.messages["private_user_2_user_1"] = true
+	reg := NewConversationRegistry(store, store)
+	ctx := context.Background()
+
+	// 旧 ID 下已有消息：规范化结果仍是旧 ID，首次解析以旧 ID 登记
+	id, err := reg.CanonicalID(ctx, "private_user_2_user_1", "user_1")
+	if err != nil || id != "private_user_2_user_1" {
+		t.Fatalf("expected legacy id to be kept, got %s err=%v", id, err)
+	}
+	info, err := reg.Resolve(ctx, id, "user_1")
+	if err != nil || info.ID != "private_user_2_user_1" || len(info.Participants) != 2 {
+		t.Fatalf("unexpected info: %+v err=%v", info, err)
+	}
+
+	// 同一对用户的另一种写法也映射到已登记的旧 ID
+	if id, err := reg.CanonicalID(ctx, "private_user_1_user_2", "user_2"); err != nil || id != "private_user_2_user_1" {
+		t.Fatalf("expected reversed id to map to legacy id, got %s err=%v", id, err)
+	}
+	if info, err := reg.Resolve(ctx, "private_user_1_user_2", "user_2"); err != nil || info.ID != "private_user_2_user_1" {
+		t.Fatalf("expected reversed id to resolve to legacy id, got %+v err=%v", info, err)
+	}
+	conv, err := reg.EnsurePrivate(ctx, "user_1", "user_2", "user_1")
+	if err != nil || conv.ConversationID != "private_user_2_user_1" {
+		t.Fatalf("EnsurePrivate should return the registered legacy conversation, got %+v err=%v", conv, err)
+	}
+	if len(store.convs) != 1 {
+		t.Fatalf("expected a single registration, got %d", len(store.convs))
+	}
+
+	// 没有历史消息的新会话使用规范 ID
+	if id, err := reg.CanonicalID(ctx, "private_u2_u1", "u1"); err != nil || id != "private_u1_u2" {
+		t.Fatalf("expected canonical id for new pair, got %s err=%v", id, err)
+	}
+}
+
+func TestRegistryDoesNotRegisterLegacyPrivateForOutsider(t *testing.T) {
+	store := newStubConvStore()
+	svc := NewMessageService(newStubMsgRepo()).WithConversationRegistry(NewConversationRegistry(store, store))
+
+	if _, err := svc.Authorize(context.Background(), "u3", "private_u1_u2"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("outsider should be forbidden, got %v", err)
+	}
+	if len(store.convs) != 0 {
+		t.Fatalf("outsider must not register the conversation, got %+v", store.convs)
+	}
+	if _, err := svc.Authorize(context.Background(), "u2", "private_u1_u2"); err != nil {
+		t.Fatalf("participant should be allowed, got %v", err)
+	}
+	if conv := store.convs["private_u1_u2"]; conv.CreatorID != "u2" {
+		t.Fatalf("expected participant as creator, got %+v", conv)
+	}
+}
+
+func TestRegistryLookupDoesNotRegister(t *testing.T) {
+	store := newStubConvStore()
+	store.members["group_1"] = []string{"u1", "u2", "u3"}
+	resolver := NewConversationRegistry(store, store).ReadOnly()
+
+	info, err := resolver.Resolve(context.Background(), "private_u1_u2", "u1")
+	if err != nil || info.Type != model.ConversationTypePrivate || len(info.Participants) != 2 {
+		t.Fatalf("expected legacy private participants, got %+v err=%v", info, err)
+	}
+	info, err = resolver.Resolve(context.Background(), "group_1", "u1")
+	if err != nil || info.Type != model.ConversationTypeGroup || len(info.Participants) != 3 {
+		t.Fatalf("expected group members, got %+v err=%v", info, err)
+	}
+	if len(store.convs) != 0 {
+		t.Fatalf("read-only lookup must not register conversations, got %+v", store.convs)
+	}
+}
+
+func TestRegistryMemberChangesInvalidateCache(t *testing.T) {
+	store := newStubConvStore()
+	reg := NewConversationRegistry(store, store).WithGroupRoles(store)
+	cache := NewCachedResolver(reg, time.Minute, 10)
+	reg.WithInvalidator(cache)
+	ctx := context.Background()
+
+	if _, err := reg.CreateGroup(ctx, GroupSpec{ConversationID: "group_x", CreatorID: "owner", Members: []string{"u1"}}); err != nil {
+		t.Fatalf("CreateGroup returned error: %v", err)
+	}
+	if info, _ := cache.Resolve(ctx, "group_x", "u1"); len(info.Participants) != 2 {
+		t.Fatalf("unexpected participants: %+v", info)
+	}
+
+	if err := reg.AddMembers(ctx, "group_x", "u1", []string{"u2"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("plain member should not add members, got %v", err)
+	}
+	if err := reg.AddMembers(ctx, "group_x", "owner", []string{"u2"}); err != nil {
+		t.Fatalf("AddMembers returned error: %v", err)
+	}
+	if info, _ := cache.Resolve(ctx, "group_x", "u2"); !containsUser(info.Participants, "u2") {
+		t.Fatalf("cache should see the new member immediately: %+v", info)
+	}
+
+	// 成员可以退群，但不能移除他人；群主不能被移除
+	if err := reg.RemoveMembers(ctx, "group_x", "u2", []string{"u1"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("plain member should not remove others, got %v", err)
+	}
+	if err := reg.RemoveMembers(ctx, "group_x", "u1", []string{"u1"}); err != nil {
+		t.Fatalf("member should be able to leave, got %v", err)
+	}
+	if info, _ := cache.Resolve(ctx, "group_x", "u2"); containsUser(info.Participants, "u1") {
+		t.Fatalf("cache should drop the removed member immediately: %+v", info)
+	}
+	if err := reg.RemoveMembers(ctx, "group_x", "owner", []string{"owner"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("owner should not be removable, got %v", err)
+	}
+	if err := reg.AddMembers(ctx, "group_missing", "owner", []string{"u2"}); !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestRegistryCreateGroupIncludesCreator(t *testing.T) {
+	store := newStubConvStore()
+	reg := NewConversationRegistry(store, store)
+
+	conv, err := reg.CreateGroup(context.Background(), GroupSpec{ConversationID: "group_x", Title: "x", CreatorID: "u1", Members: []string{"u2"}})
+	if err != nil {
+		t.Fatalf("CreateGroup returned error: %v", err)
+	}
+	info, err := reg.Resolve(context.Background(), conv.ConversationID, "u2")
+	if err != nil {
+		t.Fatalf("Resolve returned error: %v", err)
+	}
+	if info.Type != model.ConversationTypeGroup || len(info.Participants) != 2 {
+		t.Fatalf("unexpected group info: %+v", info)
+	}
+	if _, err := reg.CreateGroup(context.Background(), GroupSpec{ConversationID: "private_a_b", CreatorID: "a"}); err == nil {
+		t.Fatalf("group id with private_ prefix should be rejected")
+	}
+}
+
+func TestHandleChatStoresUnderCanonicalID(t *testing.T) {
+	store := newStubConvStore()
+	repo := newStubMsgRepo()
+	inbox := &stubInbox{}
+	svc := NewMessageServiceWithSeq(repo, &stubSeqGen{}).WithInbox(inbox).
+		WithConversationRegistry(NewConversationRegistry(store, store))
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "private_u2_u1", MsgId: "c-1"}
+	out, err := svc.HandleChat(context.Background(), "u2", packet, ChatPayload{Content: "hi"})
+	if err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if got := repo.store["c-1"].ConversationID; got != "private_u1_u2" {
+		t.Fatalf("expected canonical conversation id, got %s", got)
+	}
+	if payload, ok := out.Payload.(map[string]string); !ok || payload["conversation_id"] != "private_u1_u2" {
+		t.Fatalf("expected canonical id in ack payload, got %#v", out.Payload)
+	}
+	if len(inbox.appends) != 1 || len(inbox.appends[0].userIDs) != 2 {
+		t.Fatalf("expected inbox fan-out to both peers, got %+v", inbox.appends)
+	}
+}
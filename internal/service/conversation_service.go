@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"go-im/internal/model"
+)
+
+// ConversationStateStore 提供会话列表所需的最新消息与 ACK 位点查询。
+type ConversationStateStore interface {
+	ListLatestMessages(ctx context.Context, conversationIDs []string) ([]model.TimelineMessage, error)
+	ListAcks(ctx context.Context, userID string) ([]model.UserConversationState, error)
+	CountUnread(ctx context.Context, userID string, afterSeqs map[string]int64) (map[string]int64, error)
+}
+
+// UserGroupSource 返回用户所在的群，由 GroupRepository 实现。
+type UserGroupSource interface {
+	ListUserGroups(ctx context.Context, userID string) ([]string, error)
+}
+
+// ConversationSummary 是会话列表中的一项。
+type ConversationSummary struct {
+	ConversationID string                 `json:"conversation_id"`
+	LastActiveAt   int64                  `json:"last_active_at"`
+	LatestSeq      int64                  `json:"latest_seq"`
+	LastAckSeq     int64                  `json:"last_ack_seq"`
+	UnreadCount    int64                  `json:"unread_count"`
+	MentionUnread  int64                  `json:"mention_unread"` // 未读消息中 @我 的条数
+	LastMessage    *model.TimelineMessage `json:"last_message,omitempty"`
+}
+
+// ConversationPage 是会话列表的一页，NextCursor 与 NextCursorID 一起传回 List 以继续翻页。
+type ConversationPage struct {
+	Conversations []ConversationSummary `json:"conversations"`
+	NextCursor    int64                 `json:"next_cursor"`
+	NextCursorID  string                `json:"next_cursor_id"` // 本页最后一个会话的 ID，区分活跃时间相同的会话
+	HasMore       bool                  `json:"has_more"`
+}
+
+// ConversationService 提供“我的会话”列表。
+type ConversationService struct {
+	index    ConversationIndex
+	store    ConversationStateStore
+	mentions MentionCounter  // 可选：为 nil 时不返回未读提及数
+	groups   UserGroupSource // 可选：合并读扩散群的活跃时间，为 nil 时只读用户自己的索引
+}
+
+func NewConversationService(index ConversationIndex, store ConversationStateStore) *ConversationService {
+	return &ConversationService{index: index, store: store}
+}
+
+// WithMentionCounter 可选注入提及统计，会话列表附带未读提及数。
+func (s *ConversationService) WithMentionCounter(counter MentionCounter) *ConversationService {
+	s.mentions = counter
+	return s
+}
+
+// WithUserGroups 注入用户所在群的查询；读扩散群不刷新成员索引，列表需按群合并。
+func (s *ConversationService) WithUserGroups(groups UserGroupSource) *ConversationService {
+	s.groups = groups
+	return s
+}
+
+// List 按最后活跃时间倒序返回用户的会话，附带最后一条消息与未读数。
+// 未读数为 last_ack_seq 之后他人发送的普通消息数，不含自己的消息与系统事件；
+// cursor / cursorID 为上一页的 NextCursor / NextCursorID，首页传 0 与空串。
+func (s *ConversationService) List(ctx context.Context, userID string, cursor int64, cursorID string, limit int) (ConversationPage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > maxPullLimit {
+		limit = maxPullLimit
+	}
+	entries, err := s.listEntries(ctx, userID, ConversationEntry{ConversationID: cursorID, LastActiveAt: cursor}, limit+1)
+	if err != nil {
+		return ConversationPage{}, err
+	}
+	page := ConversationPage{Conversations: []ConversationSummary{}, NextCursor: cursor, NextCursorID: cursorID}
+	if len(entries) == 0 {
+		return page, nil
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		page.HasMore = true
+	}
+
+	convIDs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		convIDs = append(convIDs, e.ConversationID)
+	}
+	latest, err := s.store.ListLatestMessages(ctx, convIDs)
+	if err != nil {
+		return ConversationPage{}, err
+	}
+	latestByConv := make(map[string]model.TimelineMessage, len(latest))
+	for _, msg := range latest {
+		latestByConv[msg.ConversationID] = msg
+	}
+	acks, err := s.store.ListAcks(ctx, userID)
+	if err != nil {
+		return ConversationPage{}, err
+	}
+	ackByConv := make(map[string]int64, len(acks))
+	for _, st := range acks {
+		ackByConv[st.ConversationID] = st.LastAckSeq
+	}
+	// 只统计最新 seq 超过 ack 的会话
+	afterSeqs := make(map[string]int64)
+	for _, convID := range convIDs {
+		if last, ok := latestByConv[convID]; ok && int64(last.Seq) > ackByConv[convID] {
+			afterSeqs[convID] = ackByConv[convID]
+		}
+	}
+	unreadByConv, err := s.store.CountUnread(ctx, userID, afterSeqs)
+	if err != nil {
+		return ConversationPage{}, err
+	}
+
+	var mentionByConv map[string]int64
+	if s.mentions != nil {
+		if mentionByConv, err = s.mentions.CountUnreadMentions(ctx, userID, convIDs); err != nil {
+			return ConversationPage{}, err
+		}
+	}
+
+	for _, e := range entries {
+		item := ConversationSummary{
+			ConversationID: e.ConversationID,
+			LastActiveAt:   e.LastActiveAt,
+			LastAckSeq:     ackByConv[e.ConversationID],
+			UnreadCount:    unreadByConv[e.ConversationID],
+			MentionUnread:  mentionByConv[e.ConversationID],
+		}
+		if last, ok := latestByConv[e.ConversationID]; ok {
+			item.LastMessage = &last
+			item.LatestSeq = int64(last.Seq)
+		}
+		page.Conversations = append(page.Conversations, item)
+	}
+	last := entries[len(entries)-1]
+	page.NextCursor = last.LastActiveAt
+	page.NextCursorID = last.ConversationID
+	return page, nil
+}
+
+// RecentConversationIDs 按最后活跃时间倒序返回用户最近的 limit 个会话 ID（含读扩散群），供批量同步补齐未 ACK 过的会话。
+func (s *ConversationService) RecentConversationIDs(ctx context.Context, userID string, limit int) ([]string, error) {
+	entries, err := s.listEntries(ctx, userID, ConversationEntry{}, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ConversationID)
+	}
+	return ids, nil
+}
+
+// listEntries 合并用户索引与所在读扩散群的活跃时间，返回排在 after 之后的前 limit 项。
+// 同一会话取两处中较大的活跃时间；读扩散群在用户索引中可能留有较旧的分数（如本人发言），
+// 因此多取这些群的条数，保证按较大分数过滤后仍能凑满一页。
+func (s *ConversationService) listEntries(ctx context.Context, userID string, after ConversationEntry, limit int) ([]ConversationEntry, error) {
+	var groupAt map[string]int64
+	if s.groups != nil {
+		groupIDs, err := s.groups.ListUserGroups(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if groupAt, err = s.index.GroupActiveAt(ctx, groupIDs); err != nil {
+			return nil, err
+		}
+	}
+	if len(groupAt) == 0 {
+		return s.index.List(ctx, userID, after, limit)
+	}
+
+	own, err := s.index.List(ctx, userID, after, limit+len(groupAt))
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]int64, len(own)+len(groupAt))
+	for convID, at := range groupAt {
+		merged[convID] = at
+	}
+	for _, e := range own {
+		if e.LastActiveAt > merged[e.ConversationID] {
+			merged[e.ConversationID] = e.LastActiveAt
+		}
+	}
+	entries := make([]ConversationEntry, 0, len(merged))
+	for convID, at := range merged {
+		if e := (ConversationEntry{ConversationID: convID, LastActiveAt: at}); after.before(e) {
+			entries = append(entries, e)
+		}
+	}
+	// 与 Redis 索引一致：活跃时间倒序，同分按 conversation_id 逆字典序
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].LastActiveAt != entries[j].LastActiveAt {
+			return entries[i].LastActiveAt > entries[j].LastActiveAt
+		}
+		return entries[i].ConversationID > entries[j].ConversationID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
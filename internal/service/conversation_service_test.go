@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+type stubConvIndex struct {
+	scores map[string]map[string]int64 // user -> conv -> activeAt
+	groups map[string]int64            // 读扩散群 -> activeAt
+}
+
+func newStubConvIndex() *stubConvIndex {
+	return &stubConvIndex{scores: make(map[string]map[string]int64), groups: make(map[string]int64)}
+}
+
+func (x *stubConvIndex) TouchGroup(ctx context.Context, conversationID string, activeAt int64) error {
+	if activeAt > x.groups[conversationID] {
+		x.groups[conversationID] = activeAt
+	}
+	return nil
+}
+
+func (x *stubConvIndex) GroupActiveAt(ctx context.Context, conversationIDs []string) (map[string]int64, error) {
+	out := make(map[string]int64)
+	for _, id := range conversationIDs {
+		if at, ok := x.groups[id]; ok {
+			out[id] = at
+		}
+	}
+	return out, nil
+}
+
+type stubUserGroups map[string][]string
+
+func (g stubUserGroups) ListUserGroups(ctx context.Context, userID string) ([]string, error) {
+	return g[userID], nil
+}
+
+func (x *stubConvIndex) Touch(ctx context.Context, conversationID string, activeAt int64, userIDs []string) error {
+	for _, uid := range userIDs {
+		if x.scores[uid] == nil {
+			x.scores[uid] = make(map[string]int64)
+		}
+		if activeAt > x.scores[uid][conversationID] {
+			x.scores[uid][conversationID] = activeAt
+		}
+	}
+	return nil
+}
+
+func (x *stubConvIndex) List(ctx context.Context, userID string, after ConversationEntry, limit int) ([]ConversationEntry, error) {
+	var entries []ConversationEntry
+	for conv, at := range x.scores[userID] {
+		if e := (ConversationEntry{ConversationID: conv, LastActiveAt: at}); after.before(e) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].before(entries[j]) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func TestConversationListUnreadAndPaging(t *testing.T) {
+	index := newStubConvIndex()
+	_ = index.Touch(context.Background(), "a", 100, []string{"u1"})
+	_ = index.Touch(context.Background(), "b", 300, []string{"u1"})
+	_ = index.Touch(context.Background(), "c", 200, []string{"u1"})
+	store := &stubPullStore{
+		msgs: append(append(convMessages("a", 1, 2, 3), convMessages("b", 1, 2)...), convMessages("c", 1)...),
+		acks: []model.UserConversationState{
+			{UserID: "u1", ConversationID: "a", LastAckSeq: 1},
+			{UserID: "u1", ConversationID: "b", LastAckSeq: 2},
+		},
+	}
+	svc := NewConversationService(index, store)
+
+	first, err := svc.List(context.Background(), "u1", 0, "", 2)
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(first.Conversations) != 2 || !first.HasMore || first.NextCursor != 200 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	b, c := first.Conversations[0], first.Conversations[1]
+	if b.ConversationID != "b" || b.UnreadCount != 0 || b.LastMessage == nil || b.LastMessage.Seq != 2 {
+		t.Fatalf("unexpected summary for b: %+v", b)
+	}
+	if c.ConversationID != "c" || c.UnreadCount != 1 {
+		t.Fatalf("conversation without ack should count all messages as unread: %+v", c)
+	}
+
+	second, err := svc.List(context.Background(), "u1", first.NextCursor, first.NextCursorID, 2)
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(second.Conversations) != 1 || second.HasMore || second.Conversations[0].UnreadCount != 2 {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+}
+
+func TestConversationListPagesThroughTiesAndSkipsOwnAndSystemMessages(t *testing.T) {
+	index := newStubConvIndex()
+	for _, conv := range []string{"a", "b", "c"} {
+		_ = index.Touch(context.Background(), conv, 100, []string{"u1"})
+	}
+	msgs := convMessages("a", 1, 2, 3, 4)
+	msgs[1].SenderID = "u1"                 // 自己发送的消息
+	msgs[2].MsgType = model.MsgTypeRecall   // 系统事件
+	msgs[3].MsgType = model.MsgTypeReaction // 系统事件
+	store := &stubPullStore{msgs: msgs}
+	svc := NewConversationService(index, store)
+
+	var seen []string
+	cursor, cursorID := int64(0), ""
+	for i := 0; i < 3; i++ {
+		page, err := svc.List(context.Background(), "u1", cursor, cursorID, 1)
+		if err != nil {
+			t.Fatalf("List error: %v", err)
+		}
+		for _, c := range page.Conversations {
+			seen = append(seen, c.ConversationID)
+			if c.ConversationID == "a" && c.UnreadCount != 1 {
+				t.Fatalf("own messages and system events should not count as unread: %+v", c)
+			}
+		}
+		cursor, cursorID = page.NextCursor, page.NextCursorID
+	}
+	if len(seen) != 3 || seen[0] != "c" || seen[1] != "b" || seen[2] != "a" {
+		t.Fatalf("expected all tied conversations across pages, got %v", seen)
+	}
+}
+
+func TestHandleChatTouchesConversationIndex(t *testing.T) {
+	index := newStubConvIndex()
+	svc := NewMessageServiceWithSeq(newStubMsgRepo(), &stubSeqGen{}).WithConversationIndex(index)
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "private_u1_u2", MsgId: "idx-1"}
+	if _, err := svc.HandleChat(context.Background(), "u1", packet, ChatPayload{Content: "hi"}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	for _, uid := range []string{"u1", "u2"} {
+		if _, ok := index.scores[uid]["private_u1_u2"]; !ok {
+			t.Fatalf("expected conversation index touched for %s", uid)
+		}
+	}
+
+	// 无法解析参与者的会话至少刷新发送者自己的索引
+	packet = model.InputPacket{Cmd: model.CmdChat, ConversationId: "group_unknown", MsgId: "idx-2"}
+	if _, err := svc.HandleChat(context.Background(), "u3", packet, ChatPayload{Content: "hi"}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if _, ok := index.scores["u3"]["group_unknown"]; !ok {
+		t.Fatalf("expected sender index touched")
+	}
+}
+
+func TestReadDiffusionTouchesOnlySenderAndGroup(t *testing.T) {
+	index := newStubConvIndex()
+	members := []string{"u1", "u2", "u3"}
+	conv := ConversationInfo{ID: "group_big", Type: model.ConversationTypeGroup, Participants: members}
+	svc := NewMessageServiceWithSeq(newStubMsgRepo(), &stubSeqGen{}).
+		WithConversationRegistry(&countingResolver{info: conv}).
+		WithConversationIndex(index).
+		WithReadDiffusionThreshold(2)
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: conv.ID, MsgId: "big-1"}
+	if _, err := svc.HandleChat(context.Background(), "u1", packet, ChatPayload{Content: "hi"}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if _, ok := index.scores["u1"][conv.ID]; !ok {
+		t.Fatalf("sender index should be touched")
+	}
+	if len(index.scores["u2"]) != 0 || len(index.scores["u3"]) != 0 {
+		t.Fatalf("read-diffusion group must not touch every member, got %+v", index.scores)
+	}
+	if index.groups[conv.ID] == 0 {
+		t.Fatalf("group activity should be recorded")
+	}
+}
+
+func TestConversationListMergesReadDiffusionGroups(t *testing.T) {
+	index := newStubConvIndex()
+	_ = index.Touch(context.Background(), "a", 100, []string{"u2"})
+	_ = index.Touch(context.Background(), "c", 300, []string{"u2"})
+	_ = index.Touch(context.Background(), "g", 50, []string{"u2"}) // 本人早先在群里发言留下的旧分数
+	_ = index.TouchGroup(context.Background(), "g", 200)
+	_ = index.TouchGroup(context.Background(), "other", 400) // u2 不在该群
+	store := &stubPullStore{msgs: append(append(convMessages("a", 1), convMessages("c", 1)...), convMessages("g", 1)...)}
+	svc := NewConversationService(index, store).WithUserGroups(stubUserGroups{"u2": {"g"}})
+
+	var seen []string
+	cursor, cursorID := int64(0), ""
+	for i := 0; i < 4; i++ {
+		page, err := svc.List(context.Background(), "u2", cursor, cursorID, 1)
+		if err != nil {
+			t.Fatalf("List error: %v", err)
+		}
+		for _, c := range page.Conversations {
+			seen = append(seen, c.ConversationID)
+		}
+		cursor, cursorID = page.NextCursor, page.NextCursorID
+		if !page.HasMore {
+			break
+		}
+	}
+	if len(seen) != 3 || seen[0] != "c" || seen[1] != "g" || seen[2] != "a" {
+		t.Fatalf("expected group merged by its latest activity exactly once, got %v", seen)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// deliveryStats 暴露在 /admin/debug/vars 的送达确认指标。
+var deliveryStats = expvar.NewMap("im_delivery")
+
+// DeliveryStore 记录消息已送达，由 MessageRepository 实现。
+type DeliveryStore interface {
+	MarkDelivered(ctx context.Context, msgID string) error
+}
+
+// DeliveryNotice 是推送给发送者的送达通知。
+type DeliveryNotice struct {
+	ConversationID string `json:"conversation_id"`
+	MsgID          string `json:"msg_id"`
+	Seq            uint64 `json:"seq"`
+	ReceiverID     string `json:"receiver_id"`
+	DeliveredAt    int64  `json:"delivered_at"`
+}
+
+type DeliveryOptions struct {
+	Timeout    time.Duration // 推送后多久未确认即重发
+	MaxRetries int           // 最多重发次数，超过后放弃（客户端重连时通过拉取补齐）
+	MaxPending int           // 单个连接最多跟踪的未确认消息数，超过后新消息不再跟踪
+}
+
+type pendingPush struct {
+	receiverID string
+	msg        model.TimelineMessage
+	packet     model.OutputPacket
+	retries    int
+	deadline   time.Time
+}
+
+// DeliveryTracker 按连接跟踪已推送但未确认的消息，超时重发，客户端按 msg_id 确认后
+// 更新消息状态并通知发送者。重启后跟踪状态丢失，由客户端拉取兜底。
+type DeliveryTracker struct {
+	store  DeliveryStore // 可选：为 nil 时不更新消息状态
+	pusher Pusher        // 可选：为 nil 时不通知发送者
+
+	timeout    time.Duration
+	maxRetries int
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[ConnWriter]map[string]*pendingPush // 连接 -> msg_id -> 待确认推送
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewDeliveryTracker(store DeliveryStore, opts DeliveryOptions) *DeliveryTracker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 1000
+	}
+	t := &DeliveryTracker{
+		store:      store,
+		timeout:    opts.Timeout,
+		maxRetries: opts.MaxRetries,
+		maxPending: opts.MaxPending,
+		pending:    make(map[ConnWriter]map[string]*pendingPush),
+		stop:       make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.loop()
+	return t
+}
+
+// WithPusher 注入在线推送，用于向发送者发送送达通知。
+func (t *DeliveryTracker) WithPusher(pusher Pusher) *DeliveryTracker {
+	t.pusher = pusher
+	return t
+}
+
+// closer 由 Session 实现，用于识别已关闭的连接。
+type closer interface {
+	Closed() bool
+}
+
+// Track 登记一次已写出的推送，等待 conn 对应的设备确认。
+// 已关闭的连接不再登记：其 Forget 可能已执行，登记后将无人清理。
+func (t *DeliveryTracker) Track(conn ConnWriter, receiverID string, msg model.TimelineMessage, packet model.OutputPacket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := conn.(closer); ok && c.Closed() {
+		deliveryStats.Add("untracked", 1)
+		return
+	}
+	msgs, ok := t.pending[conn]
+	if !ok {
+		msgs = make(map[string]*pendingPush)
+		t.pending[conn] = msgs
+	}
+	if len(msgs) >= t.maxPending {
+		deliveryStats.Add("untracked", 1)
+		return
+	}
+	msgs[msg.MsgID] = &pendingPush{
+		receiverID: receiverID,
+		msg:        msg,
+		packet:     packet,
+		deadline:   time.Now().Add(t.timeout),
+	}
+	deliveryStats.Add("tracked", 1)
+}
+
+// Ack 处理设备对 msgID 的送达确认；未在跟踪中（重复确认或已放弃）时返回 false。
+func (t *DeliveryTracker) Ack(ctx context.Context, conn ConnWriter, msgID string) bool {
+	t.mu.Lock()
+	p, ok := t.pending[conn][msgID]
+	if ok {
+		t.remove(conn, msgID)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+	deliveryStats.Add("acked", 1)
+
+	if t.store != nil {
+		if err := t.store.MarkDelivered(ctx, msgID); err != nil {
+			log.Printf("更新消息送达状态失败 msg_id=%s: %v", msgID, err)
+		}
+	}
+	if t.pusher != nil && p.msg.SenderID != "" {
+		notice := DeliveryNotice{
+			ConversationID: p.msg.ConversationID,
+			MsgID:          msgID,
+			Seq:            p.msg.Seq,
+			ReceiverID:     p.receiverID,
+			DeliveredAt:    time.Now().UnixMilli(),
+		}
+		packet := model.OutputPacket{Cmd: model.CmdDelivered, MsgId: msgID, Seq: int64(p.msg.Seq), Payload: notice}
+		if err := t.pusher.Broadcast(ctx, packet, []string{p.msg.SenderID}); err != nil {
+			log.Printf("推送送达通知失败 msg_id=%s: %v", msgID, err)
+		}
+	}
+	return true
+}
+
+// remove 删除一条待确认推送，连接上已无待确认推送时一并删除外层条目。调用方需持有 mu。
+func (t *DeliveryTracker) remove(conn ConnWriter, msgID string) {
+	msgs := t.pending[conn]
+	delete(msgs, msgID)
+	if len(msgs) == 0 {
+		delete(t.pending, conn)
+	}
+}
+
+// Forget 丢弃连接上的全部待确认推送，连接关闭后调用。
+func (t *DeliveryTracker) Forget(conn ConnWriter) {
+	t.mu.Lock()
+	delete(t.pending, conn)
+	t.mu.Unlock()
+}
+
+// PendingCount 返回连接上等待确认的推送数。
+func (t *DeliveryTracker) PendingCount(conn ConnWriter) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending[conn])
+}
+
+// Stop 停止后台重发循环。
+func (t *DeliveryTracker) Stop() {
+	close(t.stop)
+	t.wg.Wait()
+}
+
+func (t *DeliveryTracker) loop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			t.retransmit(now)
+		}
+	}
+}
+
+type retransmission struct {
+	conn   ConnWriter
+	packet model.OutputPacket
+}
+
+// retransmit 重发已超时的推送；超过 maxRetries 的放弃跟踪。写连接在锁外进行。
+func (t *DeliveryTracker) retransmit(now time.Time) {
+	var due []retransmission
+	t.mu.Lock()
+	for conn, msgs := range t.pending {
+		for msgID, p := range msgs {
+			if now.Before(p.deadline) {
+				continue
+			}
+			if p.retries >= t.maxRetries {
+				t.remove(conn, msgID)
+				deliveryStats.Add("dropped", 1)
+				log.Printf("推送未确认，放弃重发 receiver=%s msg_id=%s", p.receiverID, msgID)
+				continue
+			}
+			p.retries++
+			p.deadline = now.Add(t.timeout)
+			due = append(due, retransmission{conn: conn, packet: p.packet})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, r := range due {
+		deliveryStats.Add("retransmits", 1)
+		if err := r.conn.WriteJSON(r.packet); err != nil {
+			log.Printf("重发推送失败 msg_id=%s: %v", r.packet.MsgId, err)
+		}
+	}
+}
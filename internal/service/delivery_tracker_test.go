@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+type recordingConn struct {
+	writes []interface{}
+}
+
+func (c *recordingConn) WriteJSON(v interface{}) error {
+	c.writes = append(c.writes, v)
+	return nil
+}
+
+type stubDevices map[string][]ConnWriter
+
+func (d stubDevices) Devices(userID string) []ConnWriter { return d[userID] }
+
+type stubDeliveryStore struct {
+	delivered []string
+}
+
+func (s *stubDeliveryStore) MarkDelivered(ctx context.Context, msgID string) error {
+	s.delivered = append(s.delivered, msgID)
+	return nil
+}
+
+func TestPushTracksEachDeviceAndAckNotifiesSender(t *testing.T) {
+	phone, laptop := &recordingConn{}, &recordingConn{}
+	store := &stubDeliveryStore{}
+	notifier := &stubPusher{}
+	tracker := NewDeliveryTracker(store, DeliveryOptions{Timeout: time.Hour})
+	defer tracker.Stop()
+	tracker.WithPusher(notifier)
+	push := NewPushService(nil).WithDeliveryTracker(tracker, stubDevices{"u2": {phone, laptop}})
+
+	msg := model.TimelineMessage{MsgID: "m1", ConversationID: "private_u1_u2", Seq: 7, SenderID: "u1"}
+	if err := push.Broadcast(context.Background(), model.OutputPacket{Cmd: model.CmdPush, MsgId: "m1", Payload: msg}, []string{"u2"}); err != nil {
+		t.Fatalf("Broadcast returned error: %v", err)
+	}
+	if len(phone.writes) != 1 || len(laptop.writes) != 1 {
+		t.Fatalf("expected push to both devices, got %d/%d", len(phone.writes), len(laptop.writes))
+	}
+
+	if !tracker.Ack(context.Background(), phone, "m1") {
+		t.Fatalf("expected tracked ack")
+	}
+	if tracker.Ack(context.Background(), phone, "m1") {
+		t.Fatalf("duplicate ack should be ignored")
+	}
+	if len(store.delivered) != 1 || store.delivered[0] != "m1" {
+		t.Fatalf("expected status update, got %v", store.delivered)
+	}
+	if len(notifier.packets) != 1 || notifier.packets[0].Cmd != model.CmdDelivered || notifier.targets[0][0] != "u1" {
+		t.Fatalf("expected delivered notice to sender, got %+v %v", notifier.packets, notifier.targets)
+	}
+	if notice := notifier.packets[0].Payload.(DeliveryNotice); notice.ReceiverID != "u2" || notice.Seq != 7 {
+		t.Fatalf("unexpected notice: %+v", notice)
+	}
+}
+
+func TestTrackerRetransmitsUntilBound(t *testing.T) {
+	conn := &recordingConn{}
+	tracker := NewDeliveryTracker(nil, DeliveryOptions{Timeout: time.Hour, MaxRetries: 2})
+	defer tracker.Stop()
+
+	msg := model.TimelineMessage{MsgID: "m2", SenderID: "u1"}
+	tracker.Track(conn, "u2", msg, model.OutputPacket{Cmd: model.CmdPush, MsgId: "m2", Payload: msg})
+
+	now := time.Now()
+	tracker.retransmit(now) // 未超时
+	for i := 1; i <= 3; i++ {
+		tracker.retransmit(now.Add(time.Duration(i) * 2 * time.Hour))
+	}
+	if len(conn.writes) != 2 {
+		t.Fatalf("expected 2 retransmits, got %d", len(conn.writes))
+	}
+	if tracker.Ack(context.Background(), conn, "m2") {
+		t.Fatalf("push should be dropped after max retries")
+	}
+	if len(tracker.pending) != 0 {
+		t.Fatalf("expected empty connection entry to be removed, got %d", len(tracker.pending))
+	}
+}
+
+func TestTrackerForgetOnDisconnect(t *testing.T) {
+	conn := &recordingConn{}
+	tracker := NewDeliveryTracker(nil, DeliveryOptions{Timeout: time.Hour})
+	defer tracker.Stop()
+
+	msg := model.TimelineMessage{MsgID: "m3"}
+	tracker.Track(conn, "u2", msg, model.OutputPacket{Cmd: model.CmdPush, Payload: msg})
+	tracker.Forget(conn)
+	tracker.retransmit(time.Now().Add(2 * time.Hour))
+	if len(conn.writes) != 0 || tracker.Ack(context.Background(), conn, "m3") {
+		t.Fatalf("forgotten connection should not be retransmitted or acked")
+	}
+}
+
+func TestTrackerSkipsClosedSession(t *testing.T) {
+	sess := NewStreamSession("u2", "phone", TransportSSE, "", &recordingStream{})
+	tracker := NewDeliveryTracker(nil, DeliveryOptions{Timeout: time.Hour})
+	defer tracker.Stop()
+
+	_ = sess.Close()
+	tracker.Forget(sess)
+	msg := model.TimelineMessage{MsgID: "m4"}
+	tracker.Track(sess, "u2", msg, model.OutputPacket{Cmd: model.CmdPush, Payload: msg})
+	if tracker.PendingCount(sess) != 0 || len(tracker.pending) != 0 {
+		t.Fatalf("closed session should not be tracked")
+	}
+}
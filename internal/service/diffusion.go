@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+
+	"go-im/internal/model"
+)
+
+// DefaultReadDiffusionThreshold 群成员数超过该值时切换为读扩散。
+const DefaultReadDiffusionThreshold = 500
+
+// GroupMemberSource 提供群成员列表，群会话 ID 即 group_member.group_id。
+type GroupMemberSource interface {
+	ListMembers(ctx context.Context, groupID string) ([]string, error)
+}
+
+// Pusher 抽象在线推送能力，由 PushService 实现。
+type Pusher interface {
+	Broadcast(ctx context.Context, packet model.OutputPacket, targets []string) error
+}
+
+// diffusionMode 描述一条消息的投递方式。
+type diffusionMode int
+
+const (
+	diffusionNone  diffusionMode = iota // 无法识别参与者：只落 Timeline
+	diffusionWrite                      // 写扩散：写每个参与者的 Inbox 并推送完整消息
+	diffusionRead                       // 读扩散：不写 Inbox，仅推送轻量的会话更新通知
+)
+
+// ConversationUpdate 是读扩散会话推送给在线成员的轻量通知，客户端据此发起 CmdPull。
+type ConversationUpdate struct {
+	ConversationID string `json:"conversation_id"`
+	Seq            uint64 `json:"seq"`
+	SenderID       string `json:"sender_id"`
+	SendTime       int64  `json:"send_time"`
+}
+
+// resolveDelivery 根据已解析的会话计算投递对象与扩散方式：
+// 单聊写扩散；群聊成员数不超过阈值时写扩散，否则读扩散；未知会话不扩散。
+func (s *MessageService) resolveDelivery(conv ConversationInfo) ([]string, diffusionMode) {
+	if len(conv.Participants) == 0 {
+		return nil, diffusionNone
+	}
+	if conv.Type == model.ConversationTypeGroup && len(conv.Participants) > s.readThreshold {
+		return conv.Participants, diffusionRead
+	}
+	return conv.Participants, diffusionWrite
+}
+
+// excludeUser 返回去掉指定用户后的列表，用于推送时跳过发送者本人。
+func excludeUser(userIDs []string, userID string) []string {
+	out := make([]string, 0, len(userIDs))
+	for _, uid := range userIDs {
+		if uid != userID {
+			out = append(out, uid)
+		}
+	}
+	return out
+}
+
+func containsUser(userIDs []string, userID string) bool {
+	for _, uid := range userIDs {
+		if uid == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+type stubMembers struct {
+	groups map[string][]string
+}
+
+func (m *stubMembers) ListMembers(ctx context.Context, groupID string) ([]string, error) {
+	return m.groups[groupID], nil
+}
+
+type stubPusher struct {
+	packets []model.OutputPacket
+	targets [][]string
+}
+
+func (p *stubPusher) Broadcast(ctx context.Context, packet model.OutputPacket, targets []string) error {
+	p.packets = append(p.packets, packet)
+	p.targets = append(p.targets, targets)
+	return nil
+}
+
+func groupOf(n int) []string {
+	users := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		users = append(users, fmt.Sprintf("u%d", i))
+	}
+	return users
+}
+
+func TestHandleChatSmallGroupUsesWriteDiffusion(t *testing.T) {
+	inbox := &stubInbox{}
+	pusher := &stubPusher{}
+	members := &stubMembers{groups: map[string][]string{"group_small": groupOf(3)}}
+	svc := NewMessageServiceWithSeq(newStubMsgRepo(), &stubSeqGen{}).
+		WithInbox(inbox).WithGroupMembers(members).WithPusher(pusher).WithReadDiffusionThreshold(3)
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "group_small", MsgId: "g-1"}
+	if _, err := svc.HandleChat(context.Background(), "u1", packet, ChatPayload{Content: "hi"}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if len(inbox.appends) != 1 || len(inbox.appends[0].userIDs) != 3 {
+		t.Fatalf("expected inbox fan-out to 3 members, got %+v", inbox.appends)
+	}
+	if len(pusher.packets) != 1 || pusher.packets[0].Cmd != model.CmdPush {
+		t.Fatalf("expected full message push, got %+v", pusher.packets)
+	}
+	if got := pusher.targets[0]; len(got) != 2 || contains(got, "u1") {
+		t.Fatalf("push should skip sender, got %v", got)
+	}
+}
+
+func TestHandleChatLargeGroupUsesReadDiffusion(t *testing.T) {
+	inbox := &stubInbox{}
+	pusher := &stubPusher{}
+	members := &stubMembers{groups: map[string][]string{"group_big": groupOf(4)}}
+	svc := NewMessageServiceWithSeq(newStubMsgRepo(), &stubSeqGen{}).
+		WithInbox(inbox).WithGroupMembers(members).WithPusher(pusher).WithReadDiffusionThreshold(3)
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "group_big", MsgId: "g-2"}
+	out, err := svc.HandleChat(context.Background(), "u1", packet, ChatPayload{Content: "hi"})
+	if err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if len(inbox.appends) != 0 {
+		t.Fatalf("read diffusion should not write inbox, got %d appends", len(inbox.appends))
+	}
+	if len(pusher.packets) != 1 || pusher.packets[0].Cmd != model.CmdConvUpdate {
+		t.Fatalf("expected conversation update notification, got %+v", pusher.packets)
+	}
+	update, ok := pusher.packets[0].Payload.(ConversationUpdate)
+	if !ok || update.Seq != uint64(out.Seq) || update.ConversationID != "group_big" {
+		t.Fatalf("unexpected notification payload: %+v", pusher.packets[0].Payload)
+	}
+	if len(pusher.targets[0]) != 3 {
+		t.Fatalf("expected 3 notified members, got %v", pusher.targets[0])
+	}
+}
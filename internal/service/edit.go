@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"go-im/internal/model"
+	"go-im/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// MaxContentLength 与 timeline_message.content 列宽一致。
+const MaxContentLength = 4096
+
+var ErrContentTooLong = errors.New("content too long")
+
+// EditStore 保存编辑版本并更新消息可见内容，由 MessageRepository 实现。
+type EditStore interface {
+	ApplyEdit(ctx context.Context, msgID, editorID, content string) (*model.TimelineMessage, error)
+	ListVersions(ctx context.Context, msgID string) ([]model.MessageEdit, error)
+}
+
+// EditEvent 是编辑事件（msg_type=101）的正文，客户端据此得知消息已变更。
+// 事件不携带编辑后的正文：事件行不随撤回清空，正文需经拉取原消息或历史版本获取，二者都会校验撤回状态。
+type EditEvent struct {
+	MsgID    string `json:"msg_id"`
+	Seq      uint64 `json:"seq"`
+	Version  int    `json:"version"`
+	EditorID string `json:"editor_id"`
+	EditedAt int64  `json:"edited_at"`
+}
+
+// WithEditStore 启用消息编辑与历史版本查询。
+func (s *MessageService) WithEditStore(store EditStore) *MessageService {
+	s.editStore = store
+	return s
+}
+
+// Edit 修改自己发送的消息：保存新版本、更新原消息正文，并在 Timeline 追加编辑事件，
+// 已同步过原消息的客户端通过新 seq 感知变更。
+func (s *MessageService) Edit(ctx context.Context, editorID, conversationID, msgID, content string) (*model.TimelineMessage, error) {
+	if s.editStore == nil {
+		return nil, errors.New("edit not enabled")
+	}
+	if utf8.RuneCountInString(content) > MaxContentLength {
+		return nil, ErrContentTooLong
+	}
+	conv, orig, err := s.findTarget(ctx, editorID, conversationID, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if orig.SenderID != editorID {
+		return nil, ErrForbidden
+	}
+
+	// 以事务内读到的最新行回写缓存，findTarget 读到的 orig 可能已被并发的编辑、表情回应等改动
+	edited, err := s.editStore.ApplyEdit(ctx, msgID, editorID, content)
+	if errors.Is(err, repository.ErrMessageRecalled) {
+		return nil, ErrAlreadyRecalled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.recent != nil {
+		if err := s.recent.Put(ctx, *edited); err != nil {
+			log.Printf("更新最近消息缓存失败 conv=%s msg_id=%s: %v", conv.ID, msgID, err)
+		}
+	}
+
+	return s.appendEvent(ctx, conv, editorID, model.MsgTypeEdit, EditEvent{
+		MsgID:    edited.MsgID,
+		Seq:      edited.Seq,
+		Version:  edited.Version,
+		EditorID: editorID,
+		EditedAt: time.Now().UnixMilli(),
+	})
+}
+
+// ListVersions 返回消息的历史版本（version 0 为原始内容），未编辑过的消息返回空列表。
+func (s *MessageService) ListVersions(ctx context.Context, userID, conversationID, msgID string) ([]model.MessageEdit, error) {
+	if s.editStore == nil {
+		return nil, errors.New("edit not enabled")
+	}
+	if _, _, err := s.findTarget(ctx, userID, conversationID, msgID); err != nil {
+		return nil, err
+	}
+	return s.editStore.ListVersions(ctx, msgID)
+}
+
+// findTarget 校验会话权限并加载属于该会话的普通消息（编辑、表情回应的目标），已撤回时返回 ErrAlreadyRecalled。
+func (s *MessageService) findTarget(ctx context.Context, userID, conversationID, msgID string) (ConversationInfo, *model.TimelineMessage, error) {
+	conv, err := s.Authorize(ctx, userID, conversationID)
+	if err != nil {
+		return conv, nil, err
+	}
+	msg, err := s.msgRepo.FindByMsgID(ctx, msgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return conv, nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return conv, nil, err
+	}
+	if msg.ConversationID != conv.ID || msg.MsgType >= model.MsgTypeRecall {
+		return conv, nil, ErrMessageNotFound
+	}
+	if msg.Status == model.MessageStatusRecalled {
+		return conv, nil, ErrAlreadyRecalled
+	}
+	return conv, msg, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+	"go-im/internal/repository"
+)
+
+// stubEditStore 在 stubMsgRepo 上模拟 ApplyEdit 的版本逻辑。
+type stubEditStore struct {
+	repo   *stubMsgRepo
+	edits  map[string][]model.MessageEdit
+	before func(msg *model.TimelineMessage) // 可选：模拟读取目标消息后、加锁前的并发修改
+}
+
+func (s *stubEditStore) ApplyEdit(ctx context.Context, msgID, editorID, content string) (*model.TimelineMessage, error) {
+	msg := s.repo.store[msgID]
+	if s.before != nil {
+		s.before(msg)
+	}
+	if msg.Status == model.MessageStatusRecalled {
+		return nil, repository.ErrMessageRecalled
+	}
+	if msg.Version == 0 {
+		s.edits[msgID] = append(s.edits[msgID], model.MessageEdit{MsgID: msgID, Version: 0, Content: msg.Content, EditorID: msg.SenderID})
+	}
+	msg.Version++
+	msg.Content = content
+	s.edits[msgID] = append(s.edits[msgID], model.MessageEdit{MsgID: msgID, Version: msg.Version, Content: content, EditorID: editorID})
+	edited := *msg
+	return &edited, nil
+}
+
+func (s *stubEditStore) ListVersions(ctx context.Context, msgID string) ([]model.MessageEdit, error) {
+	return s.edits[msgID], nil
+}
+
+func TestEditAppendsEventAndKeepsHistory(t *testing.T) {
+	conv := ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}
+	svc, repo, cache, pusher := newMessageFixture(conv, time.Hour)
+	store := &stubEditStore{repo: repo, edits: make(map[string][]model.MessageEdit)}
+	svc.WithEditStore(store)
+
+	event, err := svc.Edit(context.Background(), "u1", conv.ID, "m1", "fixed")
+	if err != nil {
+		t.Fatalf("Edit returned error: %v", err)
+	}
+	if event.Seq != 2 || event.MsgType != model.MsgTypeEdit {
+		t.Fatalf("expected edit event at seq 2, got %+v", event)
+	}
+	var payload EditEvent
+	if err := json.Unmarshal([]byte(event.Content), &payload); err != nil || payload.MsgID != "m1" || payload.Version != 1 {
+		t.Fatalf("unexpected event content %q: %v", event.Content, err)
+	}
+	if cached := cache.msgs[1]; cached.Content != "fixed" || cached.Version != 1 {
+		t.Fatalf("recent cache should hold edited original, got %+v", cached)
+	}
+	if len(pusher.targets) != 1 || pusher.targets[0][0] != "u2" {
+		t.Fatalf("expected event pushed to peer, got %v", pusher.targets)
+	}
+
+	versions, err := svc.ListVersions(context.Background(), "u2", conv.ID, "m1")
+	if err != nil || len(versions) != 2 || versions[0].Content != "oops" || versions[1].Content != "fixed" {
+		t.Fatalf("unexpected versions %+v err=%v", versions, err)
+	}
+}
+
+func TestEditRejectsOthersAndRecalled(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2"}}
+	svc, repo, _, _ := newMessageFixture(conv, 0)
+	svc.WithEditStore(&stubEditStore{repo: repo, edits: make(map[string][]model.MessageEdit)})
+
+	if _, err := svc.Edit(context.Background(), "u2", conv.ID, "m1", "hijack"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("non-sender should be forbidden, got %v", err)
+	}
+	if _, err := svc.Edit(context.Background(), "u1", conv.ID, "m1", strings.Repeat("x", MaxContentLength+1)); !errors.Is(err, ErrContentTooLong) {
+		t.Fatalf("expected ErrContentTooLong, got %v", err)
+	}
+	repo.store["m1"].Status = model.MessageStatusRecalled
+	if _, err := svc.Edit(context.Background(), "u1", conv.ID, "m1", "late"); !errors.Is(err, ErrAlreadyRecalled) {
+		t.Fatalf("recalled message should not be editable, got %v", err)
+	}
+}
+
+func TestEditCachesLatestRow(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2"}}
+	svc, repo, cache, _ := newMessageFixture(conv, 0)
+	store := &stubEditStore{repo: repo, edits: make(map[string][]model.MessageEdit)}
+	// 编辑期间有人在话题里回复，reply_count 已更新
+	store.before = func(msg *model.TimelineMessage) { msg.ReplyCount = 3 }
+	svc.WithEditStore(store)
+
+	if _, err := svc.Edit(context.Background(), "u1", conv.ID, "m1", "fixed"); err != nil {
+		t.Fatalf("Edit returned error: %v", err)
+	}
+	if cached := cache.msgs[1]; cached.Content != "fixed" || cached.ReplyCount != 3 {
+		t.Fatalf("recent cache should hold the row as updated by ApplyEdit, got %+v", cached)
+	}
+}
+
+func TestRecallAfterEditLeavesNoContent(t *testing.T) {
+	conv := ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}
+	svc, repo, _, _ := newMessageFixture(conv, 0)
+	svc.WithEditStore(&stubEditStore{repo: repo, edits: make(map[string][]model.MessageEdit)})
+	ctx := context.Background()
+
+	if _, err := svc.Edit(ctx, "u1", conv.ID, "m1", "secret edit"); err != nil {
+		t.Fatalf("Edit returned error: %v", err)
+	}
+	if _, err := svc.Recall(ctx, "u1", conv.ID, "m1"); err != nil {
+		t.Fatalf("Recall returned error: %v", err)
+	}
+	// 撤回后 Timeline 中任何一行（原消息与编辑、撤回事件）都不能再带出编辑后的正文
+	for _, msg := range repo.store {
+		if strings.Contains(msg.Content, "secret edit") {
+			t.Fatalf("recalled content still readable from %+v", msg)
+		}
+	}
+	if _, err := svc.ListVersions(ctx, "u2", conv.ID, "m1"); !errors.Is(err, ErrAlreadyRecalled) {
+		t.Fatalf("versions of recalled message should be hidden, got %v", err)
+	}
+}
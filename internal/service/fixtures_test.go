@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// stubRecallStore 直接修改 stubMsgRepo 中的记录。
+type stubRecallStore struct {
+	repo *stubMsgRepo
+}
+
+func (s stubRecallStore) MarkRecalled(ctx context.Context, msgID string) (bool, error) {
+	msg, ok := s.repo.store[msgID]
+	if !ok || msg.Status == model.MessageStatusRecalled {
+		return false, nil
+	}
+	msg.Status = model.MessageStatusRecalled
+	msg.Content = ""
+	return true, nil
+}
+
+type stubRoles map[string]int8
+
+func (r stubRoles) GetRole(ctx context.Context, groupID, userID string) (int8, error) {
+	role, ok := r[userID]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return role, nil
+}
+
+// newMessageFixture 构造启用撤回的 MessageService，并预置 u1 发送的 m1（seq=1、sentAgo 前发送）；
+// 撤回、编辑、表情回应、话题、@ 等测试共用。
+func newMessageFixture(conv ConversationInfo, sentAgo time.Duration) (*MessageService, *stubMsgRepo, *stubRecentCache, *stubPusher) {
+	repo := newStubMsgRepo()
+	repo.store["m1"] = &model.TimelineMessage{
+		MsgID: "m1", ConversationID: conv.ID, Seq: 1, SenderID: "u1", Content: "oops",
+		MsgType: model.MsgTypeText, CreatedAt: time.Now().Add(-sentAgo),
+	}
+	cache := &stubRecentCache{}
+	pusher := &stubPusher{}
+	svc := NewMessageServiceWithSeq(repo, &stubSeqGen{seq: 1}).
+		WithConversationRegistry(&countingResolver{info: conv}).
+		WithRecentCache(cache).WithPusher(pusher).
+		WithRecall(stubRecallStore{repo: repo}, time.Minute)
+	return svc, repo, cache, pusher
+}
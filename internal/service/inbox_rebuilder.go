@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-im/internal/model"
+	"go-im/internal/repository"
+)
+
+// MessageScanner 抽象按 id 分批扫描 Timeline 的能力，便于测试替换。
+type MessageScanner interface {
+	ScanMessages(ctx context.Context, filter repository.MessageScanFilter, afterID uint64, limit int) ([]model.TimelineMessage, error)
+}
+
+// RebuildProgress 记录重建进度，LastID 为已处理的最大 timeline_message.id。
+// Filter 记录产生该进度的过滤条件，续跑时必须一致。
+type RebuildProgress struct {
+	Filter  string `json:"filter"`
+	LastID  uint64 `json:"last_id"`
+	Scanned int64  `json:"scanned"`
+	Written int64  `json:"written"`
+}
+
+// RebuildProgressStore 持久化重建进度，用于中断后续跑；全部完成后 Clear。
+type RebuildProgressStore interface {
+	Load() (RebuildProgress, error)
+	Save(p RebuildProgress) error
+	Clear() error
+}
+
+// ErrProgressMismatch 表示进度文件由不同的过滤条件产生，不能续跑。
+var ErrProgressMismatch = errors.New("rebuild progress was saved with a different filter")
+
+// progressKey 标识过滤条件；时间窗口按相对时间计算、每次运行都会变化，不计入。
+func progressKey(filter repository.MessageScanFilter) string {
+	return fmt.Sprintf("conv=%s;user=%s", filter.ConversationID, filter.UserID)
+}
+
+type InboxRebuildOptions struct {
+	BatchSize int           // 单次扫描条数
+	Interval  time.Duration // 两次 MySQL 查询的最小间隔，用于限流
+	DryRun    bool          // 只扫描统计，不写 Redis
+
+	// ReadDiffusionThreshold 与在线写入的读扩散阈值一致：成员数不超过该值的群聊同样回写 Inbox，
+	// <=0 时取 DefaultReadDiffusionThreshold。
+	ReadDiffusionThreshold int
+}
+
+// InboxRebuilder 从 MySQL Timeline 回放消息，重建 Redis Inbox（例如 Redis 被清空后）。
+type InboxRebuilder struct {
+	scanner  MessageScanner
+	inbox    InboxWriter
+	progress RebuildProgressStore // 可选，为 nil 时不支持续跑
+	resolver ParticipantResolver  // 可选的会话注册表，为 nil 时按会话 ID 前缀推断参与者
+
+	batchSize     int
+	interval      time.Duration
+	dryRun        bool
+	readThreshold int
+}
+
+func NewInboxRebuilder(scanner MessageScanner, inbox InboxWriter, opts InboxRebuildOptions) *InboxRebuilder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.ReadDiffusionThreshold <= 0 {
+		opts.ReadDiffusionThreshold = DefaultReadDiffusionThreshold
+	}
+	return &InboxRebuilder{
+		scanner:       scanner,
+		inbox:         inbox,
+		batchSize:     opts.BatchSize,
+		interval:      opts.Interval,
+		dryRun:        opts.DryRun,
+		readThreshold: opts.ReadDiffusionThreshold,
+	}
+}
+
+// WithProgressStore 可选注入进度存储，启用断点续跑。
+func (r *InboxRebuilder) WithProgressStore(store RebuildProgressStore) *InboxRebuilder {
+	r.progress = store
+	return r
+}
+
+// WithResolver 可选注入会话注册表，与在线写入使用同一套参与者解析。
+func (r *InboxRebuilder) WithResolver(resolver ParticipantResolver) *InboxRebuilder {
+	r.resolver = resolver
+	return r
+}
+
+// Run 按过滤条件扫描并重建 Inbox，返回最终进度。
+// 指定 UserID 时只写该用户自己的 Inbox，否则写入会话全部参与者。
+func (r *InboxRebuilder) Run(ctx context.Context, filter repository.MessageScanFilter) (RebuildProgress, error) {
+	if r.inbox == nil && !r.dryRun {
+		return RebuildProgress{}, errors.New("inbox writer is nil")
+	}
+
+	key := progressKey(filter)
+	progress := RebuildProgress{Filter: key}
+	if r.progress != nil {
+		loaded, err := r.progress.Load()
+		if err != nil {
+			return progress, err
+		}
+		if loaded.LastID > 0 && loaded.Filter != key {
+			return progress, fmt.Errorf("%w: saved %q, current %q", ErrProgressMismatch, loaded.Filter, key)
+		}
+		if loaded.LastID > 0 {
+			progress = loaded
+		}
+		if progress.LastID > 0 {
+			log.Printf("从断点继续重建 Inbox last_id=%d scanned=%d written=%d", progress.LastID, progress.Scanned, progress.Written)
+		}
+	}
+
+	var lastQuery time.Time
+	for {
+		if err := r.wait(ctx, lastQuery); err != nil {
+			return progress, err
+		}
+		lastQuery = time.Now()
+
+		msgs, err := r.scanner.ScanMessages(ctx, filter, progress.LastID, r.batchSize)
+		if err != nil {
+			return progress, err
+		}
+		if len(msgs) == 0 {
+			return progress, r.finish()
+		}
+
+		for _, msg := range msgs {
+			targets, err := r.rebuildTargets(ctx, msg, filter.UserID)
+			if err != nil {
+				return progress, err
+			}
+			if len(targets) > 0 {
+				if !r.dryRun {
+					if err := r.inbox.Append(ctx, msg, targets); err != nil {
+						return progress, err
+					}
+				}
+				progress.Written += int64(len(targets))
+			}
+			progress.Scanned++
+			progress.LastID = msg.ID
+		}
+
+		if r.progress != nil && !r.dryRun {
+			if err := r.progress.Save(progress); err != nil {
+				return progress, err
+			}
+		}
+		if len(msgs) < r.batchSize {
+			return progress, r.finish()
+		}
+	}
+}
+
+// finish 全部扫描完成后清除进度，下次运行从头开始。
+func (r *InboxRebuilder) finish() error {
+	if r.progress == nil || r.dryRun {
+		return nil
+	}
+	return r.progress.Clear()
+}
+
+// wait 保证两次查询之间至少间隔 interval，ctx 取消时立即返回。
+func (r *InboxRebuilder) wait(ctx context.Context, last time.Time) error {
+	if r.interval <= 0 || last.IsZero() {
+		return ctx.Err()
+	}
+	delay := r.interval - time.Since(last)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rebuildTargets 计算消息需要回写的 Inbox 用户：单聊双方，以及按当前成员数仍走写扩散的群聊成员；
+// 读扩散的大群不写 Inbox。未注入 resolver 时无法获取群成员，只处理单聊。userID 非空时仅保留该用户。
+func (r *InboxRebuilder) rebuildTargets(ctx context.Context, msg model.TimelineMessage, userID string) ([]string, error) {
+	var targets []string
+	if r.resolver != nil {
+		conv, err := r.resolver.Resolve(ctx, msg.ConversationID, msg.SenderID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case conv.Type == model.ConversationTypePrivate:
+			targets = conv.Participants
+		case conv.Type == model.ConversationTypeGroup && len(conv.Participants) <= r.readThreshold:
+			targets = conv.Participants
+		}
+	} else {
+		targets = parsePrivateParticipants(msg.ConversationID, msg.SenderID)
+	}
+	if userID == "" {
+		return targets, nil
+	}
+	if containsUser(targets, userID) {
+		return []string{userID}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-im/internal/model"
+	"go-im/internal/repository"
+)
+
+type stubScanner struct {
+	msgs  []model.TimelineMessage
+	calls int
+}
+
+func (s *stubScanner) ScanMessages(ctx context.Context, filter repository.MessageScanFilter, afterID uint64, limit int) ([]model.TimelineMessage, error) {
+	s.calls++
+	var out []model.TimelineMessage
+	for _, m := range s.msgs {
+		if m.ID > afterID && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+type memProgressStore struct {
+	p       RebuildProgress
+	saves   int
+	cleared bool
+}
+
+func (m *memProgressStore) Load() (RebuildProgress, error) { return m.p, nil }
+func (m *memProgressStore) Save(p RebuildProgress) error {
+	m.p = p
+	m.saves++
+	return nil
+}
+func (m *memProgressStore) Clear() error {
+	m.p = RebuildProgress{}
+	m.cleared = true
+	return nil
+}
+
+func rebuildFixture() []model.TimelineMessage {
+	return []model.TimelineMessage{
+		{ID: 1, ConversationID: "private_u1_u2", Seq: 1, SenderID: "u1"},
+		{ID: 2, ConversationID: "group_1", Seq: 1, SenderID: "u1"},
+		{ID: 3, ConversationID: "private_u1_u3", Seq: 1, SenderID: "u3"},
+	}
+}
+
+func TestInboxRebuilderWritesAllParticipants(t *testing.T) {
+	scanner := &stubScanner{msgs: rebuildFixture()}
+	inbox := &stubInbox{}
+	store := &memProgressStore{}
+	rebuilder := NewInboxRebuilder(scanner, inbox, InboxRebuildOptions{BatchSize: 2}).WithProgressStore(store)
+
+	progress, err := rebuilder.Run(context.Background(), repository.MessageScanFilter{})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if progress.Scanned != 3 || progress.Written != 4 || progress.LastID != 3 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	// 群聊消息不写 Inbox
+	if len(inbox.appends) != 2 {
+		t.Fatalf("expected 2 inbox appends, got %d", len(inbox.appends))
+	}
+	if store.saves != 2 || !store.cleared {
+		t.Fatalf("expected progress saved per batch and cleared on completion, saves=%d cleared=%v", store.saves, store.cleared)
+	}
+}
+
+func TestInboxRebuilderUserFilterAndResume(t *testing.T) {
+	scanner := &stubScanner{msgs: rebuildFixture()}
+	inbox := &stubInbox{}
+	store := &memProgressStore{p: RebuildProgress{Filter: "conv=;user=u3", LastID: 1, Scanned: 1}}
+	rebuilder := NewInboxRebuilder(scanner, inbox, InboxRebuildOptions{}).WithProgressStore(store)
+
+	progress, err := rebuilder.Run(context.Background(), repository.MessageScanFilter{UserID: "u3"})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if progress.Scanned != 3 || progress.LastID != 3 {
+		t.Fatalf("expected resume from last_id=1, got %+v", progress)
+	}
+	if len(inbox.appends) != 1 {
+		t.Fatalf("expected 1 inbox append, got %d", len(inbox.appends))
+	}
+	if got := inbox.appends[0].userIDs; len(got) != 1 || got[0] != "u3" {
+		t.Fatalf("expected only u3 inbox, got %v", got)
+	}
+}
+
+func TestInboxRebuilderRejectsProgressFromOtherFilter(t *testing.T) {
+	scanner := &stubScanner{msgs: rebuildFixture()}
+	inbox := &stubInbox{}
+	store := &memProgressStore{p: RebuildProgress{Filter: "conv=;user=u3", LastID: 1, Scanned: 1}}
+	rebuilder := NewInboxRebuilder(scanner, inbox, InboxRebuildOptions{}).WithProgressStore(store)
+
+	if _, err := rebuilder.Run(context.Background(), repository.MessageScanFilter{UserID: "u2"}); !errors.Is(err, ErrProgressMismatch) {
+		t.Fatalf("expected ErrProgressMismatch, got %v", err)
+	}
+	if len(inbox.appends) != 0 || store.p.LastID != 1 {
+		t.Fatalf("mismatched run should not write or overwrite progress, appends=%d progress=%+v", len(inbox.appends), store.p)
+	}
+}
+
+func TestInboxRebuilderDryRun(t *testing.T) {
+	scanner := &stubScanner{msgs: rebuildFixture()}
+	inbox := &stubInbox{}
+	store := &memProgressStore{}
+	rebuilder := NewInboxRebuilder(scanner, inbox, InboxRebuildOptions{DryRun: true}).WithProgressStore(store)
+
+	progress, err := rebuilder.Run(context.Background(), repository.MessageScanFilter{})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if progress.Written != 4 {
+		t.Fatalf("dry-run should still count writes, got %d", progress.Written)
+	}
+	if len(inbox.appends) != 0 || store.saves != 0 {
+		t.Fatalf("dry-run should not touch redis or progress, appends=%d saves=%d", len(inbox.appends), store.saves)
+	}
+}
+
+func TestInboxRebuilderWritesWriteDiffusionGroups(t *testing.T) {
+	msgs := append(rebuildFixture(), model.TimelineMessage{ID: 4, ConversationID: "group_big", Seq: 1, SenderID: "u1"})
+	scanner := &stubScanner{msgs: msgs}
+	inbox := &stubInbox{}
+	members := &stubMembers{groups: map[string][]string{
+		"group_1":   {"u1", "u2", "u3"},
+		"group_big": groupOf(4),
+	}}
+	rebuilder := NewInboxRebuilder(scanner, inbox, InboxRebuildOptions{ReadDiffusionThreshold: 3}).
+		WithResolver(legacyResolver{members: members})
+
+	progress, err := rebuilder.Run(context.Background(), repository.MessageScanFilter{})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	// 两条单聊各 2 个，group_1 未超过阈值写 3 个，group_big 走读扩散不写
+	if progress.Scanned != 4 || progress.Written != 7 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	for _, a := range inbox.appends {
+		if a.msg.ConversationID == "group_big" {
+			t.Fatalf("read-diffused group should not be written to inbox: %+v", a)
+		}
+	}
+}
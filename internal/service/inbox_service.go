@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -15,11 +16,19 @@ type InboxWriter interface {
 	Append(ctx context.Context, msg model.TimelineMessage, userIDs []string) error
 }
 
+// InboxReader 定义按会话读取用户 Inbox 的接口，返回的是消息引用，内容需另行回填。
+type InboxReader interface {
+	ListConversation(ctx context.Context, userID, conversationID string, afterSeq int64, limit int) ([]InboxRef, error)
+}
+
 // RedisInboxWriter 使用 Redis Sorted Set 实现单聊 Inbox 写扩散。
+// 每个用户的每个会话一个 key：{prefix}{user_id}:{conversation_id}，Score 为会话内 seq，
+// 拉取时按 seq 区间读取，只触及本会话且条数有上限。
 type RedisInboxWriter struct {
 	client    *redis.Client
 	keyPrefix string
 	ttl       time.Duration
+	maxLen    int64 // 单个会话 Inbox 的最大条目数，<=0 表示不限制
 }
 
 func NewRedisInboxWriter(client *redis.Client, prefix string, ttl time.Duration) *RedisInboxWriter {
@@ -30,35 +39,38 @@ func NewRedisInboxWriter(client *redis.Client, prefix string, ttl time.Duration)
 	}
 }
 
-// Append 将消息元信息写入指定用户的 Inbox。
+// WithMaxLen 设置单个会话 Inbox 的最大长度，超出部分在写入时按 seq 从旧到新裁剪。
+// 被裁剪的区间由拉取侧回源 MySQL Timeline 补齐。
+func (w *RedisInboxWriter) WithMaxLen(n int64) *RedisInboxWriter {
+	w.maxLen = n
+	return w
+}
+
+// Append 将消息引用写入指定用户的 Inbox（不含正文，正文由 RecentCache / MySQL 回填）。
+// 写入、裁剪与续期在同一个 MULTI/EXEC 中执行，保证长度上限的原子性。
 func (w *RedisInboxWriter) Append(ctx context.Context, msg model.TimelineMessage, userIDs []string) error {
 	if w.client == nil {
 		return nil
 	}
-	payload := inboxPayload{
-		MsgID:          msg.MsgID,
-		ConversationID: msg.ConversationID,
-		Seq:            msg.Seq,
-		SenderID:       msg.SenderID,
-		Content:        msg.Content,
-		MsgType:        msg.MsgType,
-		SendTime:       msg.SendTime,
-	}
-	data, err := json.Marshal(payload)
+	data, err := json.Marshal(newInboxRef(msg))
 	if err != nil {
 		return err
 	}
 
-	pipe := w.client.Pipeline()
+	pipe := w.client.TxPipeline()
 	for _, uid := range userIDs {
 		if uid == "" {
 			continue
 		}
-		key := w.keyPrefix + uid
+		key := w.key(uid, msg.ConversationID)
 		pipe.ZAdd(ctx, key, redis.Z{
 			Score:  float64(msg.Seq),
 			Member: data,
 		})
+		if w.maxLen > 0 {
+			// 仅保留 seq 最大（最新）的 maxLen 条
+			pipe.ZRemRangeByRank(ctx, key, 0, -w.maxLen-1)
+		}
 		if w.ttl > 0 {
 			pipe.Expire(ctx, key, w.ttl)
 		}
@@ -67,13 +79,49 @@ func (w *RedisInboxWriter) Append(ctx context.Context, msg model.TimelineMessage
 	return err
 }
 
-// inboxPayload 是存入 Inbox 的精简消息元信息。
-type inboxPayload struct {
-	MsgID          string `json:"msg_id"`
+// ListConversation 读取用户 Inbox 中指定会话 seq > afterSeq 的引用，按 seq 升序返回至多 limit 条。
+func (w *RedisInboxWriter) ListConversation(ctx context.Context, userID, conversationID string, afterSeq int64, limit int) ([]InboxRef, error) {
+	if w.client == nil {
+		return nil, nil
+	}
+	members, err := w.client.ZRangeByScore(ctx, w.key(userID, conversationID), &redis.ZRangeBy{
+		Min:   "(" + strconv.FormatInt(afterSeq, 10),
+		Max:   "+inf",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]InboxRef, 0, len(members))
+	for _, member := range members {
+		var ref InboxRef
+		if err := json.Unmarshal([]byte(member), &ref); err != nil {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func (w *RedisInboxWriter) key(userID, conversationID string) string {
+	return w.keyPrefix + userID + ":" + conversationID
+}
+
+// InboxRef 是存入 Inbox 的消息引用，只包含定位与展示摘要所需的字段。
+type InboxRef struct {
 	ConversationID string `json:"conversation_id"`
 	Seq            uint64 `json:"seq"`
+	MsgID          string `json:"msg_id"`
 	SenderID       string `json:"sender_id"`
-	Content        string `json:"content"`
 	MsgType        int8   `json:"msg_type"`
-	SendTime       int64  `json:"send_time"`
+}
+
+func newInboxRef(msg model.TimelineMessage) InboxRef {
+	return InboxRef{
+		ConversationID: msg.ConversationID,
+		Seq:            msg.Seq,
+		MsgID:          msg.MsgID,
+		SenderID:       msg.SenderID,
+		MsgType:        msg.MsgType,
+	}
 }
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-im/internal/infra"
+	"go-im/internal/model"
+)
+
+func TestRedisInboxTrimIntegration(t *testing.T) {
+	ctx := context.Background()
+	rdb := infra.NewRedisClient()
+	if err := infra.PingRedis(ctx, rdb); err != nil {
+		t.Skipf("skip: Redis not reachable: %v", err)
+	}
+
+	prefix := fmt.Sprintf("test:im:inbox:trim:%d:", time.Now().UnixNano())
+	inbox := NewRedisInboxWriter(rdb, prefix, time.Minute).WithMaxLen(3)
+	defer rdb.Del(ctx, prefix+"u1", prefix+"u2")
+
+	base := time.Now()
+	for i := 1; i <= 5; i++ {
+		msg := model.TimelineMessage{
+			MsgID:          fmt.Sprintf("trim-%d", i),
+			ConversationID: "private_u1_u2",
+			Seq:            uint64(i),
+			SenderID:       "u1",
+			CreatedAt:      base.Add(time.Duration(i) * time.Millisecond),
+		}
+		if err := inbox.Append(ctx, msg, []string{"u1", "u2"}); err != nil {
+			t.Fatalf("append seq=%d: %v", i, err)
+		}
+	}
+
+	if n, err := rdb.ZCard(ctx, prefix+"u1").Result(); err != nil || n != 3 {
+		t.Fatalf("expected inbox trimmed to 3, got %d (err=%v)", n, err)
+	}
+	msgs, err := inbox.ListConversation(ctx, "u1", "private_u1_u2", 0, 10)
+	if err != nil {
+		t.Fatalf("ListConversation: %v", err)
+	}
+	if len(msgs) != 3 || msgs[0].Seq != 3 || msgs[2].Seq != 5 {
+		t.Fatalf("expected seq 3..5 retained, got %+v", msgs)
+	}
+}
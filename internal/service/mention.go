@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// MaxMentions 单条消息最多提及的用户数，超出部分忽略。
+const MaxMentions = 50
+
+// MentionWriter 写入提及记录，由 MentionRepository 实现；需对 (msg_id, user_id) 幂等。
+type MentionWriter interface {
+	SaveMentions(ctx context.Context, mentions []model.MessageMention) error
+}
+
+// MentionCounter 统计用户在各会话中的未读提及数。
+type MentionCounter interface {
+	CountUnreadMentions(ctx context.Context, userID string, conversationIDs []string) (map[string]int64, error)
+}
+
+// MentionStore 提供“@我的”查询所需的读接口。
+type MentionStore interface {
+	ListMentions(ctx context.Context, userID string, beforeID uint64, limit int) ([]model.MessageMention, error)
+	FindMessages(ctx context.Context, msgIDs []string) ([]model.TimelineMessage, error)
+}
+
+// WithMentions 启用 @提及记录，用于“@我的”未读数与查询。
+func (s *MessageService) WithMentions(store MentionWriter) *MessageService {
+	s.mentions = store
+	return s
+}
+
+// attachMentions 校验并填充提及列表：只保留会话参与者（不含发送者；兼容路径未知参与者时不过滤），
+// @所有人 仅群聊可用，且需要群管理员或群主权限。
+func (s *MessageService) attachMentions(ctx context.Context, conv ConversationInfo, msg *model.TimelineMessage, payload ChatPayload) error {
+	if payload.MentionAll && conv.Type == model.ConversationTypeGroup {
+		if err := s.CanMentionAll(ctx, conv, msg.SenderID); err != nil {
+			return err
+		}
+		msg.MentionAll = true
+	}
+
+	seen := make(map[string]struct{}, len(payload.Mentions))
+	for _, uid := range payload.Mentions {
+		if len(msg.Mentions) >= MaxMentions {
+			break
+		}
+		if _, ok := seen[uid]; ok || uid == msg.SenderID || (len(conv.Participants) > 0 && !containsUser(conv.Participants, uid)) {
+			continue
+		}
+		seen[uid] = struct{}{}
+		msg.Mentions = append(msg.Mentions, uid)
+	}
+	return nil
+}
+
+// CanMentionAll 校验用户能否在群聊中 @所有人：需要群管理员或群主，未配置角色来源时一律拒绝。
+func (s *MessageService) CanMentionAll(ctx context.Context, conv ConversationInfo, userID string) error {
+	if s.roles == nil {
+		return ErrForbidden
+	}
+	role, err := s.roles.GetRole(ctx, conv.ID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if role < model.GroupRoleAdmin {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// recordMentions 落库后写入提及记录；@所有人 只写一行 MentionAllUserID（已包含单独提及的成员），
+// 由读取方按群成员解析，避免大群每条消息写入上万行。失败只记录日志。
+func (s *MessageService) recordMentions(ctx context.Context, msg *model.TimelineMessage) {
+	if s.mentions == nil || (len(msg.Mentions) == 0 && !msg.MentionAll) {
+		return
+	}
+	users := msg.Mentions
+	if msg.MentionAll {
+		users = []string{model.MentionAllUserID}
+	}
+	records := make([]model.MessageMention, 0, len(users))
+	for _, uid := range users {
+		records = append(records, model.MessageMention{
+			MsgID:          msg.MsgID,
+			ConversationID: msg.ConversationID,
+			Seq:            msg.Seq,
+			UserID:         uid,
+			SenderID:       msg.SenderID,
+			MentionAll:     msg.MentionAll,
+		})
+	}
+	if err := s.mentions.SaveMentions(ctx, records); err != nil {
+		log.Printf("写入提及记录失败 conv=%s msg_id=%s: %v", msg.ConversationID, msg.MsgID, err)
+	}
+}
+
+// MentionItem 是“@我的”列表中的一项，Message 为被提及的消息（已被删除时为空）。
+type MentionItem struct {
+	ID             uint64                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Seq            uint64                 `json:"seq"`
+	SenderID       string                 `json:"sender_id"`
+	MentionAll     bool                   `json:"mention_all"`
+	Message        *model.TimelineMessage `json:"message,omitempty"`
+}
+
+// MentionPage 是“@我的”列表的一页，NextCursor 传回 List 以继续翻页。
+type MentionPage struct {
+	Mentions   []MentionItem `json:"mentions"`
+	NextCursor uint64        `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// MentionService 提供跨会话的“@我的”消息查询。
+type MentionService struct {
+	store MentionStore
+}
+
+func NewMentionService(store MentionStore) *MentionService {
+	return &MentionService{store: store}
+}
+
+// List 按时间倒序返回提及用户的消息；cursor 为上一页的 NextCursor，首页传 0。
+func (s *MentionService) List(ctx context.Context, userID string, cursor uint64, limit int) (MentionPage, error) {
+	limit = normalizeLimit(limit)
+	rows, err := s.store.ListMentions(ctx, userID, cursor, limit+1)
+	if err != nil {
+		return MentionPage{}, err
+	}
+	page := MentionPage{Mentions: []MentionItem{}, NextCursor: cursor}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.HasMore = true
+	}
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	msgIDs := make([]string, 0, len(rows))
+	for _, r := range rows {
+		msgIDs = append(msgIDs, r.MsgID)
+	}
+	msgs, err := s.store.FindMessages(ctx, msgIDs)
+	if err != nil {
+		return MentionPage{}, err
+	}
+	byID := make(map[string]model.TimelineMessage, len(msgs))
+	for _, m := range msgs {
+		byID[m.MsgID] = m
+	}
+	for _, r := range rows {
+		item := MentionItem{ID: r.ID, ConversationID: r.ConversationID, Seq: r.Seq, SenderID: r.SenderID, MentionAll: r.MentionAll}
+		if m, ok := byID[r.MsgID]; ok {
+			item.Message = &m
+		}
+		page.Mentions = append(page.Mentions, item)
+	}
+	page.NextCursor = rows[len(rows)-1].ID
+	return page, nil
+}
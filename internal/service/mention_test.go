@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+type stubMentionStore struct {
+	rows    []model.MessageMention
+	msgs    []model.TimelineMessage
+	members map[string][]string // 群成员，用于解析 @所有人 记录
+}
+
+func (s *stubMentionStore) SaveMentions(ctx context.Context, mentions []model.MessageMention) error {
+	for _, m := range mentions {
+		m.ID = uint64(len(s.rows) + 1)
+		s.rows = append(s.rows, m)
+	}
+	return nil
+}
+
+func (s *stubMentionStore) ListMentions(ctx context.Context, userID string, beforeID uint64, limit int) ([]model.MessageMention, error) {
+	var out []model.MessageMention
+	for i := len(s.rows) - 1; i >= 0 && len(out) < limit; i-- {
+		r := s.rows[i]
+		mentioned := r.UserID == userID ||
+			(r.UserID == model.MentionAllUserID && r.SenderID != userID && containsUser(s.members[r.ConversationID], userID))
+		if mentioned && (beforeID == 0 || r.ID < beforeID) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubMentionStore) FindMessages(ctx context.Context, msgIDs []string) ([]model.TimelineMessage, error) {
+	var out []model.TimelineMessage
+	for _, m := range s.msgs {
+		if containsUser(msgIDs, m.MsgID) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func TestHandleChatRecordsMentions(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2", "u3"}}
+	svc, repo, _, _ := newMessageFixture(conv, 0)
+	store := &stubMentionStore{members: map[string][]string{conv.ID: conv.Participants}}
+	svc.WithMentions(store).WithGroupRoles(stubRoles{"u1": model.GroupRoleOwner, "u2": model.GroupRoleMember})
+	ctx := context.Background()
+
+	// 非成员、发送者自己与重复项被过滤
+	payload := ChatPayload{Content: "@u3 @u3 @u2 @x", Mentions: []string{"u3", "u3", "u2", "x"}}
+	if _, err := svc.HandleChat(ctx, "u2", model.InputPacket{ConversationId: conv.ID, MsgId: "a"}, payload); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	if got := repo.store["a"].Mentions; len(got) != 1 || got[0] != "u3" {
+		t.Fatalf("unexpected persisted mentions %v", got)
+	}
+
+	out, err := svc.HandleChat(ctx, "u2", model.InputPacket{ConversationId: conv.ID, MsgId: "b"}, ChatPayload{Content: "@all", MentionAll: true})
+	if !errors.Is(err, ErrForbidden) || out.Code != 403 {
+		t.Fatalf("member @all should be forbidden, got code=%d err=%v", out.Code, err)
+	}
+	if _, err := svc.HandleChat(ctx, "u1", model.InputPacket{ConversationId: conv.ID, MsgId: "c"}, ChatPayload{Content: "@all", MentionAll: true}); err != nil {
+		t.Fatalf("owner @all returned error: %v", err)
+	}
+
+	// @所有人 只写一行，不按成员展开
+	if len(store.rows) != 2 || store.rows[0].UserID != "u3" || store.rows[1].UserID != model.MentionAllUserID || !store.rows[1].MentionAll {
+		t.Fatalf("unexpected mention rows %+v", store.rows)
+	}
+	for user, want := range map[string]int{"u1": 0, "u2": 1, "u3": 2} {
+		rows, _ := store.ListMentions(ctx, user, 0, 10)
+		if len(rows) != want {
+			t.Fatalf("expected %d mentions for %s, got %+v", want, user, rows)
+		}
+	}
+}
+
+func TestMentionServiceListPages(t *testing.T) {
+	store := &stubMentionStore{msgs: []model.TimelineMessage{{MsgID: "a", Content: "hi"}, {MsgID: "b", Content: "yo"}}}
+	_ = store.SaveMentions(context.Background(), []model.MessageMention{
+		{MsgID: "a", ConversationID: "c1", Seq: 1, UserID: "u1"},
+		{MsgID: "b", ConversationID: "c2", Seq: 7, UserID: "u1", MentionAll: true},
+	})
+	svc := NewMentionService(store)
+
+	page, err := svc.List(context.Background(), "u1", 0, 1)
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(page.Mentions) != 1 || !page.HasMore || page.Mentions[0].Message == nil || page.Mentions[0].Message.Content != "yo" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	page, err = svc.List(context.Background(), "u1", page.NextCursor, 1)
+	if err != nil || len(page.Mentions) != 1 || page.Mentions[0].ConversationID != "c1" || page.HasMore {
+		t.Fatalf("unexpected second page %+v err=%v", page, err)
+	}
+}
+
+type stubMentionCounter map[string]int64
+
+func (c stubMentionCounter) CountUnreadMentions(ctx context.Context, userID string, conversationIDs []string) (map[string]int64, error) {
+	return c, nil
+}
+
+func TestConversationListIncludesMentionUnread(t *testing.T) {
+	index := newStubConvIndex()
+	_ = index.Touch(context.Background(), "a", 100, []string{"u1"})
+	_ = index.Touch(context.Background(), "b", 200, []string{"u1"})
+	store := &stubPullStore{msgs: append(convMessages("a", 1, 2), convMessages("b", 1)...)}
+	svc := NewConversationService(index, store).WithMentionCounter(stubMentionCounter{"a": 2})
+
+	page, err := svc.List(context.Background(), "u1", 0, "", 10)
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if b, a := page.Conversations[0], page.Conversations[1]; b.MentionUnread != 0 || a.MentionUnread != 2 || a.UnreadCount != 2 {
+		t.Fatalf("unexpected summaries %+v", page.Conversations)
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
@@ -74,12 +75,28 @@ func (c *MessageConsumer) handleDelivery(parentCtx context.Context, msg amqp.Del
 		Content:  evt.Content,
 		MsgType:  evt.MsgType,
 		SendTime: evt.SendTime,
+
+		ReplyToMsgID: evt.ReplyToMsgID,
+		InThread:     evt.InThread,
+
+		Mentions:   evt.Mentions,
+		MentionAll: evt.MentionAll,
 	}
 
 	ctx, cancel := context.WithTimeout(parentCtx, 5*time.Second)
 	defer cancel()
 
 	if _, err := c.svc.HandleChat(ctx, evt.SenderID, packet, payload); err != nil {
+		if errors.Is(err, ErrForbidden) {
+			log.Printf("丢弃越权消息 msg_id=%s sender=%s conv=%s", evt.MsgID, evt.SenderID, evt.ConversationID)
+			_ = msg.Nack(false, false) // 重试也不会成功
+			return
+		}
+		if errors.Is(err, ErrMessageNotFound) {
+			log.Printf("丢弃回复目标不存在的消息 msg_id=%s reply_to=%s", evt.MsgID, evt.ReplyToMsgID)
+			_ = msg.Nack(false, false)
+			return
+		}
 		log.Printf("消费消息失败 msg_id=%s: %v", evt.MsgID, err)
 		_ = msg.Nack(false, true) // 失败可重试
 		return
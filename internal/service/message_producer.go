@@ -10,12 +10,16 @@ import (
 
 // ChatEvent 代表发送到 MQ 的聊天事件。
 type ChatEvent struct {
-	MsgID          string `json:"msg_id"`
-	ConversationID string `json:"conversation_id"`
-	SenderID       string `json:"sender_id"`
-	Content        string `json:"content"`
-	MsgType        int8   `json:"msg_type"`
-	SendTime       int64  `json:"send_time"`
+	MsgID          string   `json:"msg_id"`
+	ConversationID string   `json:"conversation_id"`
+	SenderID       string   `json:"sender_id"`
+	Content        string   `json:"content"`
+	MsgType        int8     `json:"msg_type"`
+	SendTime       int64    `json:"send_time"`
+	ReplyToMsgID   string   `json:"reply_to_msg_id,omitempty"`
+	InThread       bool     `json:"in_thread,omitempty"`
+	Mentions       []string `json:"mentions,omitempty"`
+	MentionAll     bool     `json:"mention_all,omitempty"`
 }
 
 // MessageProducer 负责将事件发布到 RabbitMQ。
@@ -11,29 +11,50 @@ import (
 	"go-im/internal/repository"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // MessageService 封装消息写库逻辑。
 type MessageService struct {
-	msgRepo MessageSaver
-	seqGen  SeqGenerator // 可选的 seq 生成器（例如 Redis），为 nil 时走仓储默认逻辑
-	inbox   InboxWriter  // 可选的 Inbox 写入器（Redis），为 nil 时不写
-	retry   InboxRetryer // 可选的 Inbox 重试器，用于“最终一致”补偿
+	msgRepo  MessageSaver
+	seqGen   SeqGenerator        // 可选的 seq 生成器（例如 Redis），为 nil 时走仓储默认逻辑
+	inbox    InboxWriter         // 可选的 Inbox 写入器（Redis），为 nil 时不写
+	retry    InboxRetryer        // 可选的 Inbox 重试器，用于“最终一致”补偿
+	recent   RecentCache         // 可选的会话最近消息缓存，Inbox 只存引用，正文从这里回填
+	members  GroupMemberSource   // 可选的群成员来源，为 nil 时群聊只落 Timeline（仅在未配置 resolver 时使用）
+	resolver ParticipantResolver // 可选的会话注册表，配置后作为参与者解析的唯一来源
+	pusher   Pusher              // 可选的在线推送
+	convIdx  ConversationIndex   // 可选的“我的会话”索引
+
+	readThreshold int // 群成员数超过该值时走读扩散
+
+	recallStore  RecallStore     // 可选：为 nil 时不支持撤回
+	recallWindow time.Duration   // 发送者可撤回的时限
+	roles        GroupRoleSource // 可选：群成员角色，管理员可随时撤回
+
+	editStore EditStore     // 可选：为 nil 时不支持编辑
+	reactions ReactionStore // 可选：为 nil 时不支持表情回应
+	mentions  MentionWriter // 可选：为 nil 时只在消息上保存提及列表，不维护“@我的”
+}
+
+// MessageFinder 按 msg_id 查询单条消息，未找到时返回 gorm.ErrRecordNotFound。
+type MessageFinder interface {
+	FindByMsgID(ctx context.Context, msgID string) (*model.TimelineMessage, error)
 }
 
 // MessageSaver 描述消息持久化需要实现的接口，便于测试替换。
 type MessageSaver interface {
 	SaveMessage(ctx context.Context, msg *model.TimelineMessage) error
-	FindByMsgID(ctx context.Context, msgID string) (*model.TimelineMessage, error)
+	MessageFinder
 }
 
 func NewMessageService(msgRepo MessageSaver) *MessageService {
-	return &MessageService{msgRepo: msgRepo}
+	return &MessageService{msgRepo: msgRepo, readThreshold: DefaultReadDiffusionThreshold}
 }
 
 // NewMessageServiceWithSeq 允许注入自定义的 seq 生成器（如 Redis）。
 func NewMessageServiceWithSeq(msgRepo MessageSaver, seqGen SeqGenerator) *MessageService {
-	return &MessageService{msgRepo: msgRepo, seqGen: seqGen}
+	return &MessageService{msgRepo: msgRepo, seqGen: seqGen, readThreshold: DefaultReadDiffusionThreshold}
 }
 
 // WithSeqGenerator 可选注入自定义 seq 生成器。
@@ -54,17 +75,62 @@ func (s *MessageService) WithInboxRetryer(retry InboxRetryer) *MessageService {
 	return s
 }
 
+// WithRecentCache 可选注入会话最近消息缓存。
+func (s *MessageService) WithRecentCache(cache RecentCache) *MessageService {
+	s.recent = cache
+	return s
+}
+
+// WithGroupMembers 可选注入群成员来源，启用群聊的写/读扩散。
+func (s *MessageService) WithGroupMembers(members GroupMemberSource) *MessageService {
+	s.members = members
+	return s
+}
+
+// WithConversationRegistry 注入会话注册表，由其规范化会话 ID 并解析参与者。
+func (s *MessageService) WithConversationRegistry(resolver ParticipantResolver) *MessageService {
+	s.resolver = resolver
+	return s
+}
+
+// WithPusher 可选注入在线推送。
+func (s *MessageService) WithPusher(pusher Pusher) *MessageService {
+	s.pusher = pusher
+	return s
+}
+
+// WithConversationIndex 可选注入会话索引，每条消息刷新参与者的会话活跃时间。
+func (s *MessageService) WithConversationIndex(index ConversationIndex) *MessageService {
+	s.convIdx = index
+	return s
+}
+
+// WithReadDiffusionThreshold 设置群聊切换为读扩散的成员数阈值。
+func (s *MessageService) WithReadDiffusionThreshold(n int) *MessageService {
+	if n > 0 {
+		s.readThreshold = n
+	}
+	return s
+}
+
 // ChatPayload 表示聊天消息的负载体。
 type ChatPayload struct {
 	Content  string `json:"content"`
 	MsgType  int8   `json:"msg_type"`  // 1: 文本，2: 图片
 	SendTime int64  `json:"send_time"` // 可选：外部指定发送时间（ms）
+
+	ReplyToMsgID string `json:"reply_to_msg_id,omitempty"` // 可选：引用/回复的消息
+	InThread     bool   `json:"in_thread,omitempty"`       // 为 true 时作为话题回复，计入根消息的回复数
+
+	Mentions   []string `json:"mentions,omitempty"`    // 可选：被 @ 的用户 ID
+	MentionAll bool     `json:"mention_all,omitempty"` // 可选：@所有人（仅群聊，需要管理员权限）
 }
 
 // HandleChat 保存消息并返回写入后的 seq。
 func (s *MessageService) HandleChat(ctx context.Context, userID string, packet model.InputPacket, payload ChatPayload) (model.OutputPacket, error) {
 	// TODO: 生成 msg_id（若缺省）、填充默认 msg_type，调用仓储写库并处理幂等/错误，返回 seq
 	msg_id := packet.MsgId
+	retry := msg_id != "" // 只有客户端指定的 msg_id 可能是重试
 	if msg_id == "" {
 		msg_id = uuid.NewString()
 	}
@@ -77,26 +143,60 @@ func (s *MessageService) HandleChat(ctx context.Context, userID string, packet m
 		sendTime = time.Now().UnixMilli()
 	}
 
+	// 先解析会话并校验发送者权限：规范化单聊 ID（seq 按规范 ID 分配），越权请求不消耗 seq
+	conv, err := s.Authorize(ctx, userID, packet.ConversationId)
+	if errors.Is(err, ErrForbidden) {
+		return forbiddenPacket(msg_id), err
+	}
+	if err != nil {
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msg_id, Payload: "resolve conversation failed"}, err
+	}
+
 	msg := &model.TimelineMessage{
 		MsgID:          msg_id,
-		ConversationID: packet.ConversationId,
+		ConversationID: conv.ID,
 		SenderID:       userID,
 		Content:        payload.Content,
 		MsgType:        payload.MsgType,
-		Status:         1,
+		Status:         model.MessageStatusSending, // 设备确认送达后推进为已送达
 		SendTime:       sendTime,
 	}
+	if err := s.attachReply(ctx, conv, msg, payload); err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 404, MsgId: msg_id, Payload: "回复的消息不存在"}, err
+		}
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msg_id}, err
+	}
+	if err := s.attachMentions(ctx, conv, msg, payload); err != nil {
+		if errors.Is(err, ErrForbidden) {
+			return model.OutputPacket{Cmd: model.CmdChat, Code: 403, MsgId: msg_id, Payload: "无权 @所有人"}, err
+		}
+		return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msg_id}, err
+	}
+
+	// 客户端重试时消息已落库：直接走幂等路径，不再分配 seq。否则每次重试都在 seq 上留下空洞，
+	// 最近消息缓存与 Inbox 的连续性校验会一直失败，该会话的拉取永久回源 MySQL
+	if retry {
+		existing, findErr := s.msgRepo.FindByMsgID(ctx, msg_id)
+		if findErr == nil {
+			log.Printf("重复消息 msg_id=%s，返回幂等结果", msg_id)
+			return s.finishChat(ctx, packet, existing, conv), nil
+		}
+		if !errors.Is(findErr, gorm.ErrRecordNotFound) {
+			log.Printf("查询消息是否已存在失败 msg_id=%s: %v", msg_id, findErr)
+		}
+	}
 
 	// 如果有外部 seq 生成器（这里是 Redis），优先获取 seq 后写库
 	if s.seqGen != nil {
-		seq, seqErr := s.seqGen.NextSeq(ctx, packet.ConversationId)
+		seq, seqErr := s.seqGen.NextSeq(ctx, conv.ID)
 		if seqErr != nil {
 			return model.OutputPacket{Cmd: model.CmdChat, Code: 1, MsgId: msg_id, Payload: "generate seq failed"}, seqErr
 		}
 		msg.Seq = seq
 	}
 
-	err := s.msgRepo.SaveMessage(ctx, msg)
+	err = s.msgRepo.SaveMessage(ctx, msg)
 	if err != nil {
 		if errors.Is(err, repository.ErrDuplicateMsgID) {
 			log.Printf("重复消息 msg_id=%s，返回幂等结果", msg_id)
@@ -112,28 +212,71 @@ func (s *MessageService) HandleChat(ctx context.Context, userID string, packet m
 		}
 	}
 
-	// 写入 Inbox（仅在配置了 Redis 时，假设会话 ID 形如 private_userA_userB）
-	if s.inbox != nil {
-		targets := parsePrivateParticipants(packet.ConversationId, userID)
-		if len(targets) > 0 {
+	return s.finishChat(ctx, packet, msg, conv), nil
+}
+
+// finishChat 落库（或命中幂等）之后投递消息并构造回包。幂等路径同样投递，
+// 不能提前返回，否则会跳过 Inbox 补偿逻辑（导致 Timeline 有但 Inbox 缺失无法自愈）。
+func (s *MessageService) finishChat(ctx context.Context, packet model.InputPacket, msg *model.TimelineMessage, conv ConversationInfo) model.OutputPacket {
+	s.deliver(ctx, msg, conv)
+	s.touchThreadRoot(ctx, msg)
+	s.recordMentions(ctx, msg)
+
+	out := model.OutputPacket{
+		Cmd:   model.CmdChat,
+		Code:  0,
+		MsgId: msg.MsgID,
+		Seq:   int64(msg.Seq),
+	}
+	if conv.ID != packet.ConversationId {
+		// 告知客户端规范化后的会话 ID，后续拉取与 ACK 应使用该 ID
+		out.Payload = map[string]string{"conversation_id": conv.ID}
+	}
+	return out
+}
+
+// deliver 落库之后的投递流程：写最近消息缓存、刷新会话索引、按扩散方式写 Inbox 并推送。
+// 聊天消息与撤回、编辑等系统事件共用此流程，保证同步中的客户端按 seq 看到一致的 Timeline。
+func (s *MessageService) deliver(ctx context.Context, msg *model.TimelineMessage, conv ConversationInfo) {
+	// 先写会话最近消息缓存，保证读者拿到 Inbox 引用时能回填正文；失败时读侧回源 MySQL
+	if s.recent != nil {
+		if err := s.recent.Put(ctx, *msg); err != nil {
+			log.Printf("写入最近消息缓存失败 conv=%s msg_id=%s: %v", msg.ConversationID, msg.MsgID, err)
+		}
+	}
+
+	targets, mode := s.resolveDelivery(conv)
+	s.touchConversation(ctx, msg, targets, mode)
+
+	switch mode {
+	case diffusionWrite:
+		// 写扩散：写入参与者 Inbox（仅在配置了 Redis 时），并推送完整消息
+		if s.inbox != nil {
 			if err := s.inbox.Append(ctx, *msg, targets); err != nil {
-				log.Printf("写入 Inbox 失败（将进入补偿队列） conv=%s msg_id=%s: %v", packet.ConversationId, msg_id, err)
+				log.Printf("写入 Inbox 失败（将进入补偿队列） conv=%s msg_id=%s: %v", msg.ConversationID, msg.MsgID, err)
 				if s.retry != nil {
 					s.retry.Enqueue(*msg, targets)
 				}
 			}
 		}
+		s.push(ctx, model.OutputPacket{Cmd: model.CmdPush, MsgId: msg.MsgID, Seq: int64(msg.Seq), Payload: *msg}, excludeUser(targets, msg.SenderID))
+	case diffusionRead:
+		// 读扩散：成员从会话 Timeline 拉取，这里只通知在线成员会话有更新
+		update := ConversationUpdate{ConversationID: msg.ConversationID, Seq: msg.Seq, SenderID: msg.SenderID, SendTime: msg.SendTime}
+		s.push(ctx, model.OutputPacket{Cmd: model.CmdConvUpdate, Seq: int64(msg.Seq), Payload: update}, excludeUser(targets, msg.SenderID))
 	}
+}
 
-	return model.OutputPacket{
-		Cmd:   model.CmdChat,
-		Code:  0,
-		MsgId: msg_id,
-		Seq:   int64(msg.Seq),
-	}, nil
+// participants 返回参与者解析器；未注入注册表时退回按 ID 前缀推断的旧逻辑。
+func (s *MessageService) participants() ParticipantResolver {
+	if s.resolver != nil {
+		return s.resolver
+	}
+	return legacyResolver{members: s.members}
 }
 
 // parsePrivateParticipants 会话 ID 形如 "private_u1_u2"，返回需要投递 Inbox 的用户列表。
+// 仅用于未配置 ConversationRegistry 时的兼容路径，用户 ID 含下划线时结果不可靠。
 func parsePrivateParticipants(conversationID, senderID string) []string {
 	const prefix = "private_"
 	if !strings.HasPrefix(conversationID, prefix) {
@@ -163,3 +306,38 @@ func parsePrivateParticipants(conversationID, senderID string) []string {
 	}
 	return users
 }
+
+// touchConversation 刷新参与者（至少包含发送者）的会话索引，失败只记录日志。
+// 读扩散群只刷新发送者与群活跃时间，其他成员的列表在读取时按群成员合并，避免按成员数写放大。
+func (s *MessageService) touchConversation(ctx context.Context, msg *model.TimelineMessage, targets []string, mode diffusionMode) {
+	if s.convIdx == nil {
+		return
+	}
+	activeAt := time.Now().UnixMilli()
+	if !msg.CreatedAt.IsZero() {
+		activeAt = msg.CreatedAt.UnixMilli()
+	}
+	users := targets
+	if mode == diffusionRead {
+		if err := s.convIdx.TouchGroup(ctx, msg.ConversationID, activeAt); err != nil {
+			log.Printf("刷新群活跃时间失败 conv=%s msg_id=%s: %v", msg.ConversationID, msg.MsgID, err)
+		}
+		users = nil
+	}
+	if !containsUser(users, msg.SenderID) {
+		users = append(append([]string(nil), users...), msg.SenderID)
+	}
+	if err := s.convIdx.Touch(ctx, msg.ConversationID, activeAt, users); err != nil {
+		log.Printf("刷新会话索引失败 conv=%s msg_id=%s: %v", msg.ConversationID, msg.MsgID, err)
+	}
+}
+
+// push 最佳努力推送给在线用户，失败只记录日志。
+func (s *MessageService) push(ctx context.Context, packet model.OutputPacket, targets []string) {
+	if s.pusher == nil || len(targets) == 0 {
+		return
+	}
+	if err := s.pusher.Broadcast(ctx, packet, targets); err != nil {
+		log.Printf("推送失败 cmd=%d msg_id=%s: %v", packet.Cmd, packet.MsgId, err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"go-im/internal/model"
 	"go-im/internal/repository"
+
+	"gorm.io/gorm"
 )
 
 type stubSeqGen struct {
@@ -53,6 +55,10 @@ func (r *stubMsgRepo) SaveMessage(ctx context.Context, msg *model.TimelineMessag
 	if msg.Seq == 0 {
 		msg.Seq = uint64(len(r.store) + 1)
 	}
+	if root, ok := r.store[msg.ThreadRootID]; ok {
+		root.ReplyCount++
+		msg.ThreadSeq = uint64(root.ReplyCount)
+	}
 	cp := *msg
 	r.store[msg.MsgID] = &cp
 	return nil
@@ -63,7 +69,7 @@ func (r *stubMsgRepo) FindByMsgID(ctx context.Context, msgID string) (*model.Tim
 		cp := *v
 		return &cp, nil
 	}
-	return nil, errors.New("not found")
+	return nil, gorm.ErrRecordNotFound
 }
 
 func TestHandleChatUsesSeqGenAndInbox(t *testing.T) {
@@ -134,6 +140,34 @@ func TestHandleChatIdempotentDuplicate(t *testing.T) {
 	if first.Seq != second.Seq {
 		t.Fatalf("duplicate msg_id should return same seq, got %d and %d", first.Seq, second.Seq)
 	}
+	// 重试不消耗 seq，下一条消息紧接着分配，不留空洞
+	if seqGen.seq != 1 {
+		t.Fatalf("retry should not allocate a seq, generator at %d", seqGen.seq)
+	}
+	next, err := svc.HandleChat(context.Background(), "u1", model.InputPacket{Cmd: model.CmdChat, ConversationId: "private_u1_u2", MsgId: "mid-next"}, payload)
+	if err != nil || next.Seq != first.Seq+1 {
+		t.Fatalf("expected contiguous seq %d, got %d err=%v", first.Seq+1, next.Seq, err)
+	}
+}
+
+func TestHandleChatWritesRecentCacheBeforeInbox(t *testing.T) {
+	repo := newStubMsgRepo()
+	cache := &stubRecentCache{}
+	inbox := &stubInbox{}
+	svc := NewMessageServiceWithSeq(repo, &stubSeqGen{}).WithInbox(inbox).WithRecentCache(cache)
+
+	packet := model.InputPacket{Cmd: model.CmdChat, ConversationId: "private_u1_u2", MsgId: "mid-cache"}
+	out, err := svc.HandleChat(context.Background(), "u1", packet, ChatPayload{Content: "cached"})
+	if err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	cached, ok := cache.msgs[uint64(out.Seq)]
+	if !ok || cached.Content != "cached" {
+		t.Fatalf("expected message content in recent cache, got %+v", cache.msgs)
+	}
+	if len(inbox.appends) != 1 {
+		t.Fatalf("expected inbox append once, got %d", len(inbox.appends))
+	}
 }
 
 func contains(arr []string, target string) bool {
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go-im/internal/model"
+)
+
+var ErrTooManySubscriptions = errors.New("too many presence subscriptions")
+
+// PresenceStatus 是用户的在线状态；LastSeen 为最后下线时间（毫秒），在线时为 0。
+type PresenceStatus struct {
+	UserID   string `json:"user_id"`
+	Online   bool   `json:"online"`
+	LastSeen int64  `json:"last_seen,omitempty"`
+}
+
+// PresenceStore 记录各连接的在线情况，由 RedisPresenceStore 实现，多个网关节点共享。
+type PresenceStore interface {
+	SetOnline(ctx context.Context, userID, connID string, now int64) (wasOnline bool, err error)
+	Refresh(ctx context.Context, userID, connID string, now int64) error
+	SetOffline(ctx context.Context, userID, connID string, now int64) (stillOnline bool, err error)
+	Get(ctx context.Context, userIDs []string, now int64) ([]PresenceStatus, error)
+}
+
+// PresenceBus 在节点间广播状态变化，由 RedisPresenceStore 实现；为 nil 时只通知本节点订阅者。
+type PresenceBus interface {
+	Publish(ctx context.Context, status PresenceStatus) error
+	Subscribe(ctx context.Context) (<-chan PresenceStatus, error)
+}
+
+type PresenceOptions struct {
+	Grace            time.Duration // 断开后延迟多久判定下线，期间重连不产生状态变化
+	MaxSubscriptions int           // 单个用户最多订阅的联系人数
+}
+
+// PresenceService 维护用户在线状态：连接建立/断开时更新共享存储，状态真正变化时广播，
+// 各节点把变化推送给本地订阅了该用户的连接。断开有宽限期，抖动的连接不会反复通知。
+type PresenceService struct {
+	store   PresenceStore
+	bus     PresenceBus // 可选
+	pusher  Pusher      // 可选：为 nil 时不推送变化
+	devices DeviceLookup
+	nodeID  string
+
+	grace   time.Duration
+	maxSubs int
+
+	mu       sync.Mutex
+	watchers map[string]map[string]struct{} // 被订阅者 -> 本节点订阅者
+	watching map[string]map[string]struct{} // 订阅者 -> 被订阅者
+	pending  map[string]*time.Timer         // 连接 ID -> 延迟下线
+}
+
+func NewPresenceService(store PresenceStore, devices DeviceLookup, nodeID string, opts PresenceOptions) *PresenceService {
+	if opts.Grace <= 0 {
+		opts.Grace = 5 * time.Second
+	}
+	if opts.MaxSubscriptions <= 0 {
+		opts.MaxSubscriptions = 500
+	}
+	return &PresenceService{
+		store:    store,
+		devices:  devices,
+		nodeID:   nodeID,
+		grace:    opts.Grace,
+		maxSubs:  opts.MaxSubscriptions,
+		watchers: make(map[string]map[string]struct{}),
+		watching: make(map[string]map[string]struct{}),
+		pending:  make(map[string]*time.Timer),
+	}
+}
+
+// WithPusher 注入在线推送，用于向订阅者推送状态变化。
+func (p *PresenceService) WithPusher(pusher Pusher) *PresenceService {
+	p.pusher = pusher
+	return p
+}
+
+// WithBus 注入跨节点广播。调用 Run 后才会接收其他节点的变化。
+func (p *PresenceService) WithBus(bus PresenceBus) *PresenceService {
+	p.bus = bus
+	return p
+}
+
+// Run 接收跨节点的状态变化并通知本地订阅者，直到 ctx 结束。
+func (p *PresenceService) Run(ctx context.Context) error {
+	if p.bus == nil {
+		return nil
+	}
+	events, err := p.bus.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for status := range events {
+			p.notify(ctx, status)
+		}
+	}()
+	return nil
+}
+
+func (p *PresenceService) connID(deviceID string) string {
+	return p.nodeID + "/" + deviceID
+}
+
+// Connect 登记设备上线；宽限期内的重连只取消延迟下线，不广播。
+func (p *PresenceService) Connect(ctx context.Context, userID, deviceID string) {
+	connID := p.connID(deviceID)
+	p.mu.Lock()
+	timer, flapping := p.pending[userID+"\x00"+connID]
+	if flapping {
+		timer.Stop()
+		delete(p.pending, userID+"\x00"+connID)
+	}
+	p.mu.Unlock()
+
+	wasOnline, err := p.store.SetOnline(ctx, userID, connID, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("登记在线状态失败 user=%s conn=%s: %v", userID, connID, err)
+		return
+	}
+	if !wasOnline && !flapping {
+		p.publish(ctx, PresenceStatus{UserID: userID, Online: true})
+	}
+}
+
+// Heartbeat 刷新连接心跳，防止长连接被判定为过期。
+func (p *PresenceService) Heartbeat(ctx context.Context, userID, deviceID string) {
+	if err := p.store.Refresh(ctx, userID, p.connID(deviceID), time.Now().UnixMilli()); err != nil {
+		log.Printf("刷新在线状态失败 user=%s: %v", userID, err)
+	}
+}
+
+// Disconnect 在宽限期后判定设备下线；宽限期内重连的设备保留订阅，不必重新订阅。
+func (p *PresenceService) Disconnect(userID, deviceID string) {
+	key := userID + "\x00" + p.connID(deviceID)
+	p.mu.Lock()
+	if old, ok := p.pending[key]; ok {
+		old.Stop()
+	}
+	p.pending[key] = time.AfterFunc(p.grace, func() { p.expire(key, userID, deviceID) })
+	p.mu.Unlock()
+}
+
+// expire 宽限期结束仍未重连时真正下线；用户在本节点已无连接时同时清理其订阅。
+func (p *PresenceService) expire(key, userID, deviceID string) {
+	p.mu.Lock()
+	if _, ok := p.pending[key]; !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.pending, key)
+	p.mu.Unlock()
+	if p.devices != nil && len(p.devices.Devices(userID)) == 0 {
+		p.Unsubscribe(userID, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	now := time.Now().UnixMilli()
+	stillOnline, err := p.store.SetOffline(ctx, userID, p.connID(deviceID), now)
+	if err != nil {
+		log.Printf("登记下线失败 user=%s: %v", userID, err)
+		return
+	}
+	if !stillOnline {
+		p.publish(ctx, PresenceStatus{UserID: userID, Online: false, LastSeen: now})
+	}
+}
+
+// Subscribe 订阅联系人的状态变化，返回这些联系人的当前状态。
+func (p *PresenceService) Subscribe(ctx context.Context, watcherID string, targets []string) ([]PresenceStatus, error) {
+	p.mu.Lock()
+	set := p.watching[watcherID]
+	if set == nil {
+		set = make(map[string]struct{})
+	}
+	added := 0
+	for _, t := range targets {
+		if _, ok := set[t]; !ok && t != watcherID {
+			added++
+		}
+	}
+	if len(set)+added > p.maxSubs {
+		p.mu.Unlock()
+		return nil, ErrTooManySubscriptions
+	}
+	p.watching[watcherID] = set
+	for _, t := range targets {
+		if t == watcherID {
+			continue
+		}
+		set[t] = struct{}{}
+		if p.watchers[t] == nil {
+			p.watchers[t] = make(map[string]struct{})
+		}
+		p.watchers[t][watcherID] = struct{}{}
+	}
+	p.mu.Unlock()
+	return p.Get(ctx, targets)
+}
+
+// Unsubscribe 取消订阅；targets 为空时取消该用户的全部订阅。
+func (p *PresenceService) Unsubscribe(watcherID string, targets []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	set := p.watching[watcherID]
+	if len(targets) == 0 {
+		for t := range set {
+			targets = append(targets, t)
+		}
+	}
+	for _, t := range targets {
+		delete(set, t)
+		if w := p.watchers[t]; w != nil {
+			delete(w, watcherID)
+			if len(w) == 0 {
+				delete(p.watchers, t)
+			}
+		}
+	}
+	if len(set) == 0 {
+		delete(p.watching, watcherID)
+	}
+}
+
+// Get 查询用户的在线状态。
+func (p *PresenceService) Get(ctx context.Context, userIDs []string) ([]PresenceStatus, error) {
+	if len(userIDs) == 0 {
+		return []PresenceStatus{}, nil
+	}
+	return p.store.Get(ctx, userIDs, time.Now().UnixMilli())
+}
+
+// publish 广播状态变化；未配置跨节点广播时直接通知本节点订阅者。
+func (p *PresenceService) publish(ctx context.Context, status PresenceStatus) {
+	if p.bus == nil {
+		p.notify(ctx, status)
+		return
+	}
+	if err := p.bus.Publish(ctx, status); err != nil {
+		log.Printf("广播在线状态失败 user=%s: %v", status.UserID, err)
+	}
+}
+
+// notify 推送给本节点订阅了该用户的连接。
+func (p *PresenceService) notify(ctx context.Context, status PresenceStatus) {
+	if p.pusher == nil {
+		return
+	}
+	p.mu.Lock()
+	watchers := make([]string, 0, len(p.watchers[status.UserID]))
+	for w := range p.watchers[status.UserID] {
+		watchers = append(watchers, w)
+	}
+	p.mu.Unlock()
+	if len(watchers) == 0 {
+		return
+	}
+	if err := p.pusher.Broadcast(ctx, model.OutputPacket{Cmd: model.CmdPresence, Payload: status}, watchers); err != nil {
+		log.Printf("推送在线状态失败 user=%s: %v", status.UserID, err)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	presenceConnPrefix = "c:"        // 连接字段前缀，值为最近一次心跳时间（毫秒）
+	presenceLastSeen   = "last_seen" // 最后一次下线时间（毫秒）
+)
+
+// presenceHasOnline 是上下线脚本共用的 Lua 片段：判断 key 中除 except 外是否还有未过期的连接，
+// 与 evaluate 的判定规则一致。
+const presenceHasOnline = `
+local function has_online(key, except, now, stale)
+	local fields = redis.call('HGETALL', key)
+	for i = 1, #fields, 2 do
+		local field = fields[i]
+		if field ~= except and string.sub(field, 1, 2) == 'c:' then
+			local ts = tonumber(fields[i + 1])
+			if ts and now - ts <= stale then
+				return 1
+			end
+		end
+	end
+	return 0
+end
+`
+
+// setOnlineScript 原子地判断是否已有其他在线连接并登记新连接，避免多端同时上线时都判定为“首个上线”。
+// KEYS[1]=用户 key；ARGV: 连接字段、当前时间(ms)、staleAfter(ms)、key 过期时间(s)。
+var setOnlineScript = redis.NewScript(presenceHasOnline + `
+local was = has_online(KEYS[1], ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]))
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return was
+`)
+
+// setOfflineScript 原子地移除连接、记录 last_seen 并判断是否仍有其他在线连接。参数同 setOnlineScript。
+var setOfflineScript = redis.NewScript(presenceHasOnline + `
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[1], 'last_seen', ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return has_online(KEYS[1], ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]))
+`)
+
+// RedisPresenceStore 在 Redis Hash 中记录每个用户的在线连接，多个网关节点共享。
+// Key：{prefix}{user_id}，Field：c:{node_id}/{device_id} -> 心跳时间，last_seen -> 下线时间。
+// 心跳超过 staleAfter 的连接视为已断开（节点宕机时无法主动下线）。
+type RedisPresenceStore struct {
+	client     *redis.Client
+	keyPrefix  string
+	channel    string
+	staleAfter time.Duration
+	keyTTL     time.Duration // last_seen 的保留时间
+}
+
+func NewRedisPresenceStore(client *redis.Client, prefix, channel string, staleAfter time.Duration) *RedisPresenceStore {
+	return &RedisPresenceStore{client: client, keyPrefix: prefix, channel: channel, staleAfter: staleAfter, keyTTL: 30 * 24 * time.Hour}
+}
+
+// SetOnline 登记连接上线，返回登记前该用户是否已有其他在线连接。
+func (s *RedisPresenceStore) SetOnline(ctx context.Context, userID, connID string, now int64) (bool, error) {
+	return s.runScript(ctx, setOnlineScript, userID, connID, now)
+}
+
+// Refresh 刷新连接的心跳时间并续期 key，避免长连接的 key 在 keyTTL 后过期、被误判为从未上线。
+func (s *RedisPresenceStore) Refresh(ctx context.Context, userID, connID string, now int64) error {
+	key := s.keyPrefix + userID
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, presenceConnPrefix+connID, now)
+	pipe.Expire(ctx, key, s.keyTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetOffline 移除连接并记录 last_seen，返回移除后该用户是否仍有其他在线连接。
+func (s *RedisPresenceStore) SetOffline(ctx context.Context, userID, connID string, now int64) (bool, error) {
+	return s.runScript(ctx, setOfflineScript, userID, connID, now)
+}
+
+// runScript 执行上下线脚本，返回除 connID 外是否还有在线连接。
+func (s *RedisPresenceStore) runScript(ctx context.Context, script *redis.Script, userID, connID string, now int64) (bool, error) {
+	online, err := script.Run(ctx, s.client, []string{s.keyPrefix + userID},
+		presenceConnPrefix+connID, now, s.staleAfter.Milliseconds(), int64(s.keyTTL.Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return online == 1, nil
+}
+
+// Get 批量查询在线状态。
+func (s *RedisPresenceStore) Get(ctx context.Context, userIDs []string, now int64) ([]PresenceStatus, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(userIDs))
+	for i, uid := range userIDs {
+		cmds[i] = pipe.HGetAll(ctx, s.keyPrefix+uid)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	out := make([]PresenceStatus, 0, len(userIDs))
+	for i, uid := range userIDs {
+		online, lastSeen := s.evaluate(cmds[i].Val(), now)
+		out = append(out, PresenceStatus{UserID: uid, Online: online, LastSeen: lastSeen})
+	}
+	return out, nil
+}
+
+// evaluate 根据连接心跳判断是否在线；last_seen 取下线时间与过期连接心跳中的较大值。
+func (s *RedisPresenceStore) evaluate(fields map[string]string, now int64) (bool, int64) {
+	var online bool
+	var lastSeen int64
+	for field, value := range fields {
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		isConn := strings.HasPrefix(field, presenceConnPrefix)
+		if isConn && now-ts <= s.staleAfter.Milliseconds() {
+			online = true
+		} else if (isConn || field == presenceLastSeen) && ts > lastSeen {
+			lastSeen = ts
+		}
+	}
+	if online {
+		lastSeen = 0
+	}
+	return online, lastSeen
+}
+
+// Publish 通过 Redis Pub/Sub 广播状态变化，各节点据此通知本地订阅者。
+func (s *RedisPresenceStore) Publish(ctx context.Context, status PresenceStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, s.channel, data).Err()
+}
+
+// Subscribe 订阅状态变化，ctx 结束时关闭返回的 channel。
+func (s *RedisPresenceStore) Subscribe(ctx context.Context) (<-chan PresenceStatus, error) {
+	sub := s.client.Subscribe(ctx, s.channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+	out := make(chan PresenceStatus, 256)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var status PresenceStatus
+				if err := json.Unmarshal([]byte(msg.Payload), &status); err != nil {
+					log.Printf("解析在线状态事件失败: %v", err)
+					continue
+				}
+				out <- status
+			}
+		}
+	}()
+	return out, nil
+}
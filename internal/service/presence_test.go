@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// memPresenceStore 以内存模拟 RedisPresenceStore 的连接登记。
+type memPresenceStore struct {
+	conns    map[string]map[string]int64
+	lastSeen map[string]int64
+}
+
+func newMemPresenceStore() *memPresenceStore {
+	return &memPresenceStore{conns: map[string]map[string]int64{}, lastSeen: map[string]int64{}}
+}
+
+func (s *memPresenceStore) SetOnline(ctx context.Context, userID, connID string, now int64) (bool, error) {
+	was := len(s.conns[userID]) > 0
+	if s.conns[userID] == nil {
+		s.conns[userID] = map[string]int64{}
+	}
+	s.conns[userID][connID] = now
+	return was, nil
+}
+
+func (s *memPresenceStore) Refresh(ctx context.Context, userID, connID string, now int64) error {
+	if s.conns[userID] != nil {
+		s.conns[userID][connID] = now
+	}
+	return nil
+}
+
+func (s *memPresenceStore) SetOffline(ctx context.Context, userID, connID string, now int64) (bool, error) {
+	delete(s.conns[userID], connID)
+	if len(s.conns[userID]) > 0 {
+		return true, nil
+	}
+	s.lastSeen[userID] = now
+	return false, nil
+}
+
+func (s *memPresenceStore) Get(ctx context.Context, userIDs []string, now int64) ([]PresenceStatus, error) {
+	out := make([]PresenceStatus, 0, len(userIDs))
+	for _, id := range userIDs {
+		online := len(s.conns[id]) > 0
+		st := PresenceStatus{UserID: id, Online: online}
+		if !online {
+			st.LastSeen = s.lastSeen[id]
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// 宽限期设为 1 小时，测试中直接调用 expire，避免定时器并发写 stubPusher
+func newTestPresence(devices stubDevices) (*PresenceService, *memPresenceStore, *stubPusher) {
+	store := newMemPresenceStore()
+	pusher := &stubPusher{}
+	svc := NewPresenceService(store, devices, "node-a", PresenceOptions{Grace: time.Hour, MaxSubscriptions: 2}).WithPusher(pusher)
+	return svc, store, pusher
+}
+
+func TestPresenceNotifiesWatchersOnTransitions(t *testing.T) {
+	ctx := context.Background()
+	svc, _, pusher := newTestPresence(stubDevices{})
+
+	if _, err := svc.Subscribe(ctx, "alice", []string{"bob"}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	svc.Connect(ctx, "bob", "phone")
+	svc.Connect(ctx, "bob", "pc") // 第二台设备上线不重复通知
+	if len(pusher.packets) != 1 {
+		t.Fatalf("expected 1 online push, got %d", len(pusher.packets))
+	}
+	st := pusher.packets[0].Payload.(PresenceStatus)
+	if pusher.packets[0].Cmd != model.CmdPresence || !st.Online || pusher.targets[0][0] != "alice" {
+		t.Fatalf("unexpected push %+v to %v", pusher.packets[0], pusher.targets[0])
+	}
+
+	svc.Disconnect("bob", "phone")
+	svc.expire("bob\x00node-a/phone", "bob", "phone")
+	if len(pusher.packets) != 1 {
+		t.Fatalf("bob still has pc online, expected no offline push")
+	}
+	svc.Disconnect("bob", "pc")
+	svc.expire("bob\x00node-a/pc", "bob", "pc")
+	if len(pusher.packets) != 2 {
+		t.Fatalf("expected offline push, got %d packets", len(pusher.packets))
+	}
+	st = pusher.packets[1].Payload.(PresenceStatus)
+	if st.Online || st.LastSeen == 0 {
+		t.Fatalf("expected offline with last_seen, got %+v", st)
+	}
+}
+
+func TestPresenceReconnectWithinGraceIsSilent(t *testing.T) {
+	ctx := context.Background()
+	svc, store, pusher := newTestPresence(stubDevices{})
+	_, _ = svc.Subscribe(ctx, "alice", []string{"bob"})
+
+	svc.Connect(ctx, "bob", "phone")
+	svc.Disconnect("bob", "phone")
+	svc.Connect(ctx, "bob", "phone")
+	// 重连已取消延迟下线，迟到的 expire 不生效
+	svc.expire("bob\x00node-a/phone", "bob", "phone")
+
+	if len(pusher.packets) != 1 {
+		t.Fatalf("expected only the initial online push, got %d", len(pusher.packets))
+	}
+	if len(store.conns["bob"]) != 1 {
+		t.Fatalf("expected bob to stay online, conns=%v", store.conns["bob"])
+	}
+}
+
+func TestPresenceSubscriptionLimitAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	svc, _, pusher := newTestPresence(stubDevices{})
+
+	statuses, err := svc.Subscribe(ctx, "alice", []string{"bob", "carol", "alice"})
+	if err != nil || len(statuses) != 3 {
+		t.Fatalf("subscribe: %v %v", statuses, err)
+	}
+	if _, err := svc.Subscribe(ctx, "alice", []string{"dave"}); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Fatalf("expected ErrTooManySubscriptions, got %v", err)
+	}
+
+	// alice 在本节点已无连接，宽限期结束后订阅被清理
+	svc.Disconnect("alice", "phone")
+	svc.expire("alice\x00node-a/phone", "alice", "phone")
+	svc.Connect(ctx, "bob", "phone")
+	if len(pusher.packets) != 0 {
+		t.Fatalf("expected no push after watcher left, got %d", len(pusher.packets))
+	}
+}
+
+func TestPresenceReconnectWithinGraceKeepsSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	svc, _, pusher := newTestPresence(stubDevices{})
+	_, _ = svc.Subscribe(ctx, "alice", []string{"bob"})
+
+	// alice 断线后在宽限期内重连，订阅保留
+	svc.Connect(ctx, "alice", "phone")
+	svc.Disconnect("alice", "phone")
+	svc.Connect(ctx, "alice", "phone")
+
+	svc.Connect(ctx, "bob", "phone")
+	if len(pusher.packets) != 1 || pusher.targets[0][0] != "alice" {
+		t.Fatalf("expected alice to keep receiving bob's presence, got %+v %v", pusher.packets, pusher.targets)
+	}
+}
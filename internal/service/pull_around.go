@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ErrMessageNotFound 表示锚点消息不存在或不属于该会话。
+var ErrMessageNotFound = errors.New("message not found")
+
+// AroundResult 是锚点上下文查询的结果，Messages 按 seq 升序。
+// PrevCursorSeq 用于继续向上翻（backward），NextCursorSeq 用于继续向下同步（forward）。
+type AroundResult struct {
+	Messages      []model.TimelineMessage `json:"messages"`
+	AnchorSeq     int64                   `json:"anchor_seq"`
+	PrevCursorSeq int64                   `json:"prev_cursor_seq"`
+	NextCursorSeq int64                   `json:"next_cursor_seq"`
+	HasMoreBefore bool                    `json:"has_more_before"`
+	HasMoreAfter  bool                    `json:"has_more_after"`
+}
+
+// PullAround 加载锚点消息前后各若干条，用于搜索结果跳转、回复定位。
+// 锚点可以是 seq，也可以是 msg_id（优先），msg_id 必须属于该会话。
+func (s *PullService) PullAround(ctx context.Context, conversationID string, anchorSeq int64, anchorMsgID string, before, after int) (AroundResult, error) {
+	if anchorMsgID != "" {
+		anchor, err := s.findAnchor(ctx, conversationID, anchorMsgID)
+		if err != nil {
+			return AroundResult{}, err
+		}
+		anchorSeq = int64(anchor.Seq)
+	}
+	if anchorSeq <= 0 {
+		return AroundResult{}, ErrMessageNotFound
+	}
+	before = normalizeLimit(before)
+	after = normalizeLimit(after)
+
+	older, err := s.store.ListMessagesBefore(ctx, conversationID, anchorSeq, before+1)
+	if err != nil {
+		return AroundResult{}, err
+	}
+	hasMoreBefore := len(older) > before
+	if hasMoreBefore {
+		older = older[:before]
+	}
+	// anchorSeq-1 之后的 after+1 条，包含锚点自身
+	newer, err := s.store.ListMessages(ctx, conversationID, anchorSeq-1, after+2)
+	if err != nil {
+		return AroundResult{}, err
+	}
+	limitAfter := after
+	if len(newer) > 0 && int64(newer[0].Seq) == anchorSeq {
+		limitAfter++ // 锚点不计入 after
+	}
+	hasMoreAfter := len(newer) > limitAfter
+	if hasMoreAfter {
+		newer = newer[:limitAfter]
+	}
+
+	msgs := make([]model.TimelineMessage, 0, len(older)+len(newer))
+	for i := len(older) - 1; i >= 0; i-- {
+		msgs = append(msgs, older[i])
+	}
+	msgs = append(msgs, newer...)
+
+	res := AroundResult{
+		Messages:      msgs,
+		AnchorSeq:     anchorSeq,
+		PrevCursorSeq: anchorSeq,
+		NextCursorSeq: anchorSeq - 1,
+		HasMoreBefore: hasMoreBefore,
+		HasMoreAfter:  hasMoreAfter,
+	}
+	if len(msgs) > 0 {
+		res.PrevCursorSeq = int64(msgs[0].Seq)
+		res.NextCursorSeq = int64(msgs[len(msgs)-1].Seq)
+	}
+	return res, nil
+}
+
+// findAnchor 按 msg_id 查找锚点，不存在或不属于该会话时返回 ErrMessageNotFound。
+func (s *PullService) findAnchor(ctx context.Context, conversationID, msgID string) (*model.TimelineMessage, error) {
+	if s.finder == nil {
+		return nil, errors.New("message finder not configured")
+	}
+	msg, err := s.finder.FindByMsgID(ctx, msgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.ConversationID != conversationID {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
@@ -2,11 +2,16 @@ package service
 
 import (
 	"context"
+	"log"
 
 	"go-im/internal/model"
 )
 
+// maxPullLimit 单页拉取条数上限，防止客户端请求过大的页。
+const maxPullLimit = 200
+
 // PullResult 封装拉取结果。
+// 向后翻历史时 Messages 按 seq 降序，NextCursorSeq 为本页最小 seq，HasMore 表示还有更早的消息。
 type PullResult struct {
 	Messages      []model.TimelineMessage
 	NextCursorSeq int64
@@ -16,45 +21,291 @@ type PullResult struct {
 // PullStorage 抽象仓储接口，便于测试替换。
 type PullStorage interface {
 	ListMessages(ctx context.Context, conversationID string, afterSeq int64, limit int) ([]model.TimelineMessage, error)
+	ListMessagesBefore(ctx context.Context, conversationID string, beforeSeq int64, limit int) ([]model.TimelineMessage, error)
+	ListBySeqs(ctx context.Context, conversationID string, seqs []uint64) ([]model.TimelineMessage, error)
+	ListThread(ctx context.Context, rootMsgID string, afterThreadSeq int64, limit int) ([]model.TimelineMessage, error)
+	ListAcks(ctx context.Context, userID string) ([]model.UserConversationState, error)
+	ListLatestMessages(ctx context.Context, conversationIDs []string) ([]model.TimelineMessage, error)
 	UpsertAck(ctx context.Context, userID, conversationID string, ackSeq int64) error
 }
 
 type PullService struct {
-	store PullStorage
+	store  PullStorage
+	inbox  InboxReader            // 可选：优先从用户 Inbox 读取，为 nil 时直接查 MySQL
+	cache  RecentCache            // 可选：会话最近消息缓存，用于回填 Inbox 引用的正文
+	seqs   SeqReader              // 可选：会话最新 seq，缓存/Inbox 结果不满一页时据此确认已读到末尾
+	finder MessageFinder          // 按 msg_id 定位锚点 / 话题根，为 nil 时不支持按 msg_id 拉取
+	auth   ConversationAuthorizer // 批量同步时校验会话成员并规范化会话 ID
+	recent RecentConversations    // 可选：批量同步时补齐从未 ACK 过的会话
 }
 
 func NewPullService(store PullStorage) *PullService {
 	return &PullService{store: store}
 }
 
+// WithInbox 可选注入 Inbox 读取器，单聊拉取优先走 Redis。
+func (s *PullService) WithInbox(inbox InboxReader) *PullService {
+	s.inbox = inbox
+	return s
+}
+
+// WithRecentCache 可选注入会话最近消息缓存。
+func (s *PullService) WithRecentCache(cache RecentCache) *PullService {
+	s.cache = cache
+	return s
+}
+
+// WithSeqReader 可选注入会话最新 seq 读取器；未注入时不满一页的缓存/Inbox 结果一律回源 MySQL。
+func (s *PullService) WithSeqReader(seqs SeqReader) *PullService {
+	s.seqs = seqs
+	return s
+}
+
+// WithAuthorizer 注入会话成员校验（MessageService），批量同步只返回用户所在的会话。
+func (s *PullService) WithAuthorizer(auth ConversationAuthorizer) *PullService {
+	s.auth = auth
+	return s
+}
+
+// WithRecentConversations 注入会话索引（ConversationService），未带游标的批量同步据此补齐新会话。
+func (s *PullService) WithRecentConversations(recent RecentConversations) *PullService {
+	s.recent = recent
+	return s
+}
+
+// WithMessageFinder 注入按 msg_id 查询消息的仓储（与 MessageService 共用 MessageRepository）。
+func (s *PullService) WithMessageFinder(finder MessageFinder) *PullService {
+	s.finder = finder
+	return s
+}
+
 // PullMessages 按会话内 seq 拉取消息，返回游标信息。
+// 配置了 RecentCache 时，游标落在缓存窗口内、结果连续且已读到会话最新 seq 则直接返回；否则回源 MySQL，
+// 并在拉到会话末尾时回填缓存（cache-aside）。
 func (s *PullService) PullMessages(ctx context.Context, conversationID string, cursorSeq int64, limit int) (PullResult, error) {
-	if limit <= 0 {
-		limit = 50
+	limit = normalizeLimit(limit)
+	if msgs, ok := s.rangeFromCache(ctx, conversationID, cursorSeq, limit+1); ok {
+		recentCacheStats.Add("range_hits", 1)
+		return buildPullResult(msgs, cursorSeq, limit), nil
 	}
+
 	// 多查一条用于判断是否还有更多
 	msgs, err := s.store.ListMessages(ctx, conversationID, cursorSeq, limit+1)
 	if err != nil {
 		return PullResult{}, err
 	}
+	res := buildPullResult(msgs, cursorSeq, limit)
+	if s.cache != nil {
+		recentCacheStats.Add("range_misses", 1)
+		if !res.HasMore {
+			s.fillCache(ctx, res.Messages)
+		}
+	}
+	return res, nil
+}
+
+// rangeFromCache 尝试从最近消息缓存读取；空结果同样视为未命中，
+// 以免最新一条消息写缓存失败时被误判为“没有新消息”。
+func (s *PullService) rangeFromCache(ctx context.Context, conversationID string, cursorSeq int64, limit int) ([]model.TimelineMessage, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	msgs, covered, err := s.cache.Range(ctx, conversationID, cursorSeq, limit)
+	if err != nil {
+		log.Printf("读取最近消息缓存失败 conv=%s: %v", conversationID, err)
+		return nil, false
+	}
+	if !covered || !isContiguousMessages(msgs, cursorSeq) {
+		return nil, false
+	}
+	// 不满一页说明读到了缓存末尾，但缓存末尾未必是会话末尾（写缓存可能失败），需与最新 seq 比对
+	if len(msgs) < limit && !s.reachesLatest(ctx, conversationID, msgs[len(msgs)-1].Seq) {
+		return nil, false
+	}
+	return msgs, true
+}
+
+// reachesLatest 判断 lastSeq 是否已到会话最新 seq；未注入读取器或读取失败时保守返回 false。
+func (s *PullService) reachesLatest(ctx context.Context, conversationID string, lastSeq uint64) bool {
+	if s.seqs == nil {
+		return false
+	}
+	latest, err := s.seqs.CurrentSeq(ctx, conversationID)
+	if err != nil {
+		log.Printf("读取会话最新 seq 失败 conv=%s: %v", conversationID, err)
+		return false
+	}
+	return latest > 0 && lastSeq >= latest
+}
+
+// fillCache 将回源得到的消息写回最近消息缓存，失败只记录日志。
+func (s *PullService) fillCache(ctx context.Context, msgs []model.TimelineMessage) {
+	for _, msg := range msgs {
+		if err := s.cache.Put(ctx, msg); err != nil {
+			log.Printf("回写最近消息缓存失败 conv=%s seq=%d: %v", msg.ConversationID, msg.Seq, err)
+			return
+		}
+	}
+}
+
+// PullHistory 向更早的方向翻页：返回 seq < beforeSeq 的消息（降序）。
+// 聊天界面从最新消息打开、向上滚动加载时使用；beforeSeq <= 0 等价于 PullLatest。
+func (s *PullService) PullHistory(ctx context.Context, conversationID string, beforeSeq int64, limit int) (PullResult, error) {
+	limit = normalizeLimit(limit)
+	msgs, err := s.store.ListMessagesBefore(ctx, conversationID, beforeSeq, limit+1)
+	if err != nil {
+		return PullResult{}, err
+	}
 	if len(msgs) == 0 {
-		return PullResult{NextCursorSeq: cursorSeq, Messages: msgs, HasMore: false}, nil
+		return PullResult{NextCursorSeq: beforeSeq, Messages: msgs, HasMore: false}, nil
 	}
 	hasMore := len(msgs) > limit
 	if hasMore {
 		msgs = msgs[:limit]
 	}
-	next := int64(msgs[len(msgs)-1].Seq)
-
 	return PullResult{
 		Messages:      msgs,
-		NextCursorSeq: next,
+		NextCursorSeq: int64(msgs[len(msgs)-1].Seq),
 		HasMore:       hasMore,
 	}, nil
 }
 
+// PullLatest 返回会话最新的 limit 条消息（降序），作为打开会话时的入口。
+func (s *PullService) PullLatest(ctx context.Context, conversationID string, limit int) (PullResult, error) {
+	return s.PullHistory(ctx, conversationID, 0, limit)
+}
+
+// PullForUser 以用户视角拉取会话消息：先读该用户的 Inbox，
+// 只有当 Inbox 中的数据从 cursorSeq+1 开始、seq 连续且（满一页或已到会话最新 seq）时才直接返回；
+// 否则（被裁剪、过期、群聊未写 Inbox 或 Redis 异常）透明回源 MySQL。
+// Inbox 只存引用，正文先查 RecentCache，未命中部分再按 seq 回查 MySQL。
+func (s *PullService) PullForUser(ctx context.Context, userID, conversationID string, cursorSeq int64, limit int) (PullResult, error) {
+	limit = normalizeLimit(limit)
+	if s.inbox != nil && userID != "" {
+		refs, err := s.inbox.ListConversation(ctx, userID, conversationID, cursorSeq, limit+1)
+		if err != nil {
+			log.Printf("读取 Inbox 失败，回源 MySQL user=%s conv=%s: %v", userID, conversationID, err)
+		} else if isContiguousFrom(refs, cursorSeq) {
+			msgs, err := s.hydrate(ctx, conversationID, refs)
+			if err != nil {
+				return PullResult{}, err
+			}
+			if len(msgs) == len(refs) {
+				return buildPullResult(msgs, cursorSeq, limit), nil
+			}
+		}
+	}
+	return s.PullMessages(ctx, conversationID, cursorSeq, limit)
+}
+
 // AckConversation 更新用户在会话的 last_ack_seq。
 func (s *PullService) AckConversation(ctx context.Context, userID, conversationID string, ackSeq int64) error {
 	// TODO: 调用 store.UpsertAck，并确保 ackSeq 回退不覆盖已有较大值（已在仓储层实现）
 	return s.store.UpsertAck(ctx, userID, conversationID, ackSeq)
 }
+
+// normalizeLimit 填充默认页大小并限制上限。
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return 50
+	}
+	if limit > maxPullLimit {
+		return maxPullLimit
+	}
+	return limit
+}
+
+// buildPullResult 根据多查的一条判断 HasMore，并计算下一次游标。
+func buildPullResult(msgs []model.TimelineMessage, cursorSeq int64, limit int) PullResult {
+	if len(msgs) == 0 {
+		return PullResult{NextCursorSeq: cursorSeq, Messages: msgs, HasMore: false}
+	}
+	hasMore := len(msgs) > limit
+	if hasMore {
+		msgs = msgs[:limit]
+	}
+	return PullResult{
+		Messages:      msgs,
+		NextCursorSeq: int64(msgs[len(msgs)-1].Seq),
+		HasMore:       hasMore,
+	}
+}
+
+// hydrate 将 Inbox 引用回填为完整消息：先查 RecentCache，未命中再查 MySQL 并回写缓存。
+// 返回结果按 seq 升序；MySQL 中也不存在的引用会被丢弃。
+func (s *PullService) hydrate(ctx context.Context, conversationID string, refs []InboxRef) ([]model.TimelineMessage, error) {
+	seqs := make([]uint64, 0, len(refs))
+	for _, ref := range refs {
+		seqs = append(seqs, ref.Seq)
+	}
+
+	found := make(map[uint64]model.TimelineMessage, len(refs))
+	if s.cache != nil {
+		cached, err := s.cache.Get(ctx, conversationID, seqs)
+		if err != nil {
+			log.Printf("读取最近消息缓存失败 conv=%s: %v", conversationID, err)
+		}
+		for seq, msg := range cached {
+			found[seq] = msg
+		}
+		recentCacheStats.Add("hydrate_hits", int64(len(found)))
+		recentCacheStats.Add("hydrate_misses", int64(len(seqs)-len(found)))
+	}
+
+	var missing []uint64
+	for _, seq := range seqs {
+		if _, ok := found[seq]; !ok {
+			missing = append(missing, seq)
+		}
+	}
+	if len(missing) > 0 {
+		loaded, err := s.store.ListBySeqs(ctx, conversationID, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range loaded {
+			found[msg.Seq] = msg
+		}
+		if s.cache != nil {
+			s.fillCache(ctx, loaded)
+		}
+	}
+
+	msgs := make([]model.TimelineMessage, 0, len(seqs))
+	for _, seq := range seqs {
+		if msg, ok := found[seq]; ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+// isContiguousFrom 判断引用是否恰好从 cursorSeq+1 开始且 seq 无空洞。
+func isContiguousFrom(refs []InboxRef, cursorSeq int64) bool {
+	if len(refs) == 0 {
+		return false
+	}
+	expect := uint64(cursorSeq) + 1
+	for _, m := range refs {
+		if m.Seq != expect {
+			return false
+		}
+		expect++
+	}
+	return true
+}
+
+// isContiguousMessages 与 isContiguousFrom 相同，作用于完整消息；空结果视为不连续。
+func isContiguousMessages(msgs []model.TimelineMessage, cursorSeq int64) bool {
+	if len(msgs) == 0 {
+		return false
+	}
+	expect := uint64(cursorSeq) + 1
+	for _, m := range msgs {
+		if m.Seq != expect {
+			return false
+		}
+		expect++
+	}
+	return true
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type stubPullStore struct {
+	msgs       []model.TimelineMessage
+	acks       []model.UserConversationState
+	calls      int
+	bySeqCalls int
+}
+
+func (s *stubPullStore) ListMessages(ctx context.Context, conversationID string, afterSeq int64, limit int) ([]model.TimelineMessage, error) {
+	s.calls++
+	var out []model.TimelineMessage
+	for _, m := range s.msgs {
+		if m.ConversationID == conversationID && int64(m.Seq) > afterSeq && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) ListMessagesBefore(ctx context.Context, conversationID string, beforeSeq int64, limit int) ([]model.TimelineMessage, error) {
+	s.calls++
+	var out []model.TimelineMessage
+	for i := len(s.msgs) - 1; i >= 0 && len(out) < limit; i-- {
+		m := s.msgs[i]
+		if m.ConversationID == conversationID && (beforeSeq <= 0 || int64(m.Seq) < beforeSeq) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) ListBySeqs(ctx context.Context, conversationID string, seqs []uint64) ([]model.TimelineMessage, error) {
+	s.bySeqCalls++
+	var out []model.TimelineMessage
+	for _, m := range s.msgs {
+		if m.ConversationID == conversationID && containsSeq(seqs, m.Seq) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) ListThread(ctx context.Context, rootMsgID string, afterThreadSeq int64, limit int) ([]model.TimelineMessage, error) {
+	var out []model.TimelineMessage
+	for _, m := range s.msgs {
+		if m.ThreadRootID == rootMsgID && int64(m.ThreadSeq) > afterThreadSeq && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) FindByMsgID(ctx context.Context, msgID string) (*model.TimelineMessage, error) {
+	for _, m := range s.msgs {
+		if m.MsgID == msgID {
+			cp := m
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *stubPullStore) ListAcks(ctx context.Context, userID string) ([]model.UserConversationState, error) {
+	var out []model.UserConversationState
+	for _, a := range s.acks {
+		if a.UserID == userID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) CountUnread(ctx context.Context, userID string, afterSeqs map[string]int64) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, m := range s.msgs {
+		after, ok := afterSeqs[m.ConversationID]
+		if ok && int64(m.Seq) > after && m.SenderID != userID && m.MsgType < model.MsgTypeSystem {
+			counts[m.ConversationID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *stubPullStore) ListLatestMessages(ctx context.Context, conversationIDs []string) ([]model.TimelineMessage, error) {
+	latest := make(map[string]model.TimelineMessage)
+	for _, m := range s.msgs {
+		if cur, ok := latest[m.ConversationID]; !ok || m.Seq > cur.Seq {
+			latest[m.ConversationID] = m
+		}
+	}
+	var out []model.TimelineMessage
+	for _, id := range conversationIDs {
+		if m, ok := latest[id]; ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubPullStore) UpsertAck(ctx context.Context, userID, conversationID string, ackSeq int64) error {
+	return nil
+}
+
+type stubInboxReader struct {
+	msgs  []model.TimelineMessage
+	err   error
+	calls int
+}
+
+func (r *stubInboxReader) ListConversation(ctx context.Context, userID, conversationID string, afterSeq int64, limit int) ([]InboxRef, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	var out []InboxRef
+	for _, m := range r.msgs {
+		if m.ConversationID == conversationID && int64(m.Seq) > afterSeq && len(out) < limit {
+			out = append(out, newInboxRef(m))
+		}
+	}
+	return out, nil
+}
+
+type stubRecentCache struct {
+	msgs map[uint64]model.TimelineMessage
+	puts int
+}
+
+func (c *stubRecentCache) Put(ctx context.Context, msg model.TimelineMessage) error {
+	if c.msgs == nil {
+		c.msgs = make(map[uint64]model.TimelineMessage)
+	}
+	c.msgs[msg.Seq] = msg
+	c.puts++
+	return nil
+}
+
+func (c *stubRecentCache) Get(ctx context.Context, conversationID string, seqs []uint64) (map[uint64]model.TimelineMessage, error) {
+	out := make(map[uint64]model.TimelineMessage)
+	for _, seq := range seqs {
+		if m, ok := c.msgs[seq]; ok && m.ConversationID == conversationID {
+			out[seq] = m
+		}
+	}
+	return out, nil
+}
+
+func (c *stubRecentCache) Range(ctx context.Context, conversationID string, afterSeq int64, limit int) ([]model.TimelineMessage, bool, error) {
+	var lowest uint64
+	for seq := range c.msgs {
+		if lowest == 0 || seq < lowest {
+			lowest = seq
+		}
+	}
+	if lowest == 0 || int64(lowest) > afterSeq+1 {
+		return nil, false, nil
+	}
+	var out []model.TimelineMessage
+	for seq := uint64(afterSeq) + 1; len(out) < limit; seq++ {
+		m, ok := c.msgs[seq]
+		if !ok {
+			break
+		}
+		out = append(out, m)
+	}
+	return out, true, nil
+}
+
+type stubSeqReader map[string]uint64
+
+func (r stubSeqReader) CurrentSeq(ctx context.Context, conversationID string) (uint64, error) {
+	return r[conversationID], nil
+}
+
+func containsSeq(seqs []uint64, target uint64) bool {
+	for _, s := range seqs {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+func convMessages(conv string, seqs ...uint64) []model.TimelineMessage {
+	msgs := make([]model.TimelineMessage, 0, len(seqs))
+	for _, seq := range seqs {
+		msgs = append(msgs, model.TimelineMessage{ConversationID: conv, Seq: seq, MsgID: fmt.Sprintf("%s-%d", conv, seq)})
+	}
+	return msgs
+}
+
+func TestPullForUserServesFromInbox(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4)}
+	inbox := &stubInboxReader{msgs: convMessages("c", 3, 4)}
+	svc := NewPullService(store).WithInbox(inbox).WithSeqReader(stubSeqReader{"c": 4})
+
+	res, err := svc.PullForUser(context.Background(), "u1", "c", 2, 10)
+	if err != nil {
+		t.Fatalf("PullForUser error: %v", err)
+	}
+	if store.calls != 0 {
+		t.Fatalf("expected no MySQL range query, got %d", store.calls)
+	}
+	if len(res.Messages) != 2 || res.NextCursorSeq != 4 || res.HasMore {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestPullForUserHydratesFromCacheThenMySQL(t *testing.T) {
+	full := convMessages("c", 1, 2, 3)
+	for i := range full {
+		full[i].Content = fmt.Sprintf("body-%d", full[i].Seq)
+	}
+	store := &stubPullStore{msgs: full}
+	inbox := &stubInboxReader{msgs: full}
+	cache := &stubRecentCache{}
+	_ = cache.Put(context.Background(), full[0])
+	cache.puts = 0
+	svc := NewPullService(store).WithInbox(inbox).WithRecentCache(cache).WithSeqReader(stubSeqReader{"c": 3})
+
+	res, err := svc.PullForUser(context.Background(), "u1", "c", 0, 10)
+	if err != nil {
+		t.Fatalf("PullForUser error: %v", err)
+	}
+	if store.calls != 0 || store.bySeqCalls != 1 {
+		t.Fatalf("expected one seq lookup for cache misses, got range=%d bySeq=%d", store.calls, store.bySeqCalls)
+	}
+	if cache.puts != 2 {
+		t.Fatalf("expected 2 cache fills, got %d", cache.puts)
+	}
+	for i, m := range res.Messages {
+		if m.Content != full[i].Content {
+			t.Fatalf("message %d not hydrated: %+v", i, m)
+		}
+	}
+}
+
+func TestPullForUserFallsBackWhenTrimmed(t *testing.T) {
+	// Inbox 只剩 seq 3、4，seq 1、2 已被裁剪
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4)}
+	inbox := &stubInboxReader{msgs: convMessages("c", 3, 4)}
+	svc := NewPullService(store).WithInbox(inbox)
+
+	res, err := svc.PullForUser(context.Background(), "u1", "c", 0, 10)
+	if err != nil {
+		t.Fatalf("PullForUser error: %v", err)
+	}
+	if store.calls != 1 {
+		t.Fatalf("expected fallback to MySQL, got %d calls", store.calls)
+	}
+	if len(res.Messages) != 4 || res.Messages[0].Seq != 1 {
+		t.Fatalf("expected full range from MySQL, got %+v", res.Messages)
+	}
+}
+
+func TestPullForUserFallsBackOnGapOrError(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3)}
+	gap := &stubInboxReader{msgs: convMessages("c", 1, 3)}
+	if _, err := NewPullService(store).WithInbox(gap).PullForUser(context.Background(), "u1", "c", 0, 10); err != nil {
+		t.Fatalf("PullForUser error: %v", err)
+	}
+	broken := &stubInboxReader{err: errors.New("redis down")}
+	if _, err := NewPullService(store).WithInbox(broken).PullForUser(context.Background(), "u1", "c", 0, 10); err != nil {
+		t.Fatalf("PullForUser should hide inbox error, got %v", err)
+	}
+	if store.calls != 2 {
+		t.Fatalf("expected 2 MySQL fallbacks, got %d", store.calls)
+	}
+}
+
+func TestPullForUserHasMoreFromInbox(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3)}
+	inbox := &stubInboxReader{msgs: convMessages("c", 1, 2, 3)}
+	svc := NewPullService(store).WithInbox(inbox)
+
+	res, err := svc.PullForUser(context.Background(), "u1", "c", 0, 2)
+	if err != nil {
+		t.Fatalf("PullForUser error: %v", err)
+	}
+	if !res.HasMore || res.NextCursorSeq != 2 || len(res.Messages) != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if store.calls != 0 {
+		t.Fatalf("expected no MySQL range query, got %d", store.calls)
+	}
+}
+
+func TestPullMessagesServesFromRecentCache(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4, 5)}
+	cache := &stubRecentCache{}
+	for _, m := range convMessages("c", 3, 4, 5) {
+		_ = cache.Put(context.Background(), m)
+	}
+	svc := NewPullService(store).WithRecentCache(cache).WithSeqReader(stubSeqReader{"c": 5})
+
+	hits := statValue("range_hits")
+	res, err := svc.PullMessages(context.Background(), "c", 2, 10)
+	if err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if store.calls != 0 {
+		t.Fatalf("expected cache hit without MySQL, got %d calls", store.calls)
+	}
+	if len(res.Messages) != 3 || res.NextCursorSeq != 5 || res.HasMore {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if statValue("range_hits") != hits+1 {
+		t.Fatalf("expected range_hits to increase")
+	}
+}
+
+func TestPullMessagesFallsBackWhenCacheBehindLatest(t *testing.T) {
+	// 缓存只有 3、4，seq 5 已落库但写缓存失败
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4, 5)}
+	cache := &stubRecentCache{}
+	for _, m := range convMessages("c", 3, 4) {
+		_ = cache.Put(context.Background(), m)
+	}
+	svc := NewPullService(store).WithRecentCache(cache).WithSeqReader(stubSeqReader{"c": 5})
+
+	res, err := svc.PullMessages(context.Background(), "c", 2, 10)
+	if err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if store.calls != 1 || len(res.Messages) != 3 || res.NextCursorSeq != 5 {
+		t.Fatalf("expected MySQL fallback including seq 5, calls=%d res=%+v", store.calls, res)
+	}
+
+	// 未注入 SeqReader 时无法确认末尾，同样回源
+	store.calls = 0
+	if _, err := NewPullService(store).WithRecentCache(cache).PullMessages(context.Background(), "c", 2, 10); err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if store.calls != 1 {
+		t.Fatalf("expected fallback without seq reader, got %d calls", store.calls)
+	}
+
+	// 满一页时无需比对最新 seq
+	store.calls = 0
+	res, err = NewPullService(store).WithRecentCache(cache).PullMessages(context.Background(), "c", 2, 1)
+	if err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if store.calls != 0 || !res.HasMore || res.NextCursorSeq != 3 {
+		t.Fatalf("expected full page from cache, calls=%d res=%+v", store.calls, res)
+	}
+}
+
+func TestPullMessagesOutsideWindowFallsBackAndFills(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4, 5)}
+	cache := &stubRecentCache{}
+	for _, m := range convMessages("c", 4, 5) {
+		_ = cache.Put(context.Background(), m)
+	}
+	cache.puts = 0
+	svc := NewPullService(store).WithRecentCache(cache)
+
+	misses := statValue("range_misses")
+	res, err := svc.PullMessages(context.Background(), "c", 1, 10)
+	if err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if store.calls != 1 || len(res.Messages) != 4 {
+		t.Fatalf("expected MySQL fallback returning 4 messages, calls=%d res=%+v", store.calls, res)
+	}
+	if cache.puts != 4 {
+		t.Fatalf("expected tail page written back to cache, got %d puts", cache.puts)
+	}
+	if statValue("range_misses") != misses+1 {
+		t.Fatalf("expected range_misses to increase")
+	}
+
+	// 非末尾页不回填缓存
+	empty := &stubRecentCache{}
+	if _, err := NewPullService(store).WithRecentCache(empty).PullMessages(context.Background(), "c", 0, 2); err != nil {
+		t.Fatalf("PullMessages error: %v", err)
+	}
+	if empty.puts != 0 {
+		t.Fatalf("expected no cache fill for non-tail page, got %d", empty.puts)
+	}
+}
+
+func TestPullLatestAndHistoryPaging(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4, 5)}
+	svc := NewPullService(store)
+
+	latest, err := svc.PullLatest(context.Background(), "c", 2)
+	if err != nil {
+		t.Fatalf("PullLatest error: %v", err)
+	}
+	if len(latest.Messages) != 2 || latest.Messages[0].Seq != 5 || latest.Messages[1].Seq != 4 {
+		t.Fatalf("expected seq 5,4 descending, got %+v", latest.Messages)
+	}
+	if !latest.HasMore || latest.NextCursorSeq != 4 {
+		t.Fatalf("unexpected paging info: %+v", latest)
+	}
+
+	older, err := svc.PullHistory(context.Background(), "c", latest.NextCursorSeq, 5)
+	if err != nil {
+		t.Fatalf("PullHistory error: %v", err)
+	}
+	if len(older.Messages) != 3 || older.Messages[0].Seq != 3 || older.HasMore || older.NextCursorSeq != 1 {
+		t.Fatalf("unexpected older page: %+v", older)
+	}
+
+	done, err := svc.PullHistory(context.Background(), "c", 1, 5)
+	if err != nil {
+		t.Fatalf("PullHistory error: %v", err)
+	}
+	if len(done.Messages) != 0 || done.HasMore || done.NextCursorSeq != 1 {
+		t.Fatalf("expected empty final page, got %+v", done)
+	}
+}
+
+func TestPullAroundBySeq(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("c", 1, 2, 3, 4, 5, 6, 7)}
+	svc := NewPullService(store)
+
+	res, err := svc.PullAround(context.Background(), "c", 4, "", 2, 2)
+	if err != nil {
+		t.Fatalf("PullAround error: %v", err)
+	}
+	var seqs []uint64
+	for _, m := range res.Messages {
+		seqs = append(seqs, m.Seq)
+	}
+	if fmt.Sprint(seqs) != "[2 3 4 5 6]" {
+		t.Fatalf("unexpected window: %v", seqs)
+	}
+	if !res.HasMoreBefore || !res.HasMoreAfter || res.PrevCursorSeq != 2 || res.NextCursorSeq != 6 {
+		t.Fatalf("unexpected cursors: %+v", res)
+	}
+}
+
+func TestPullAroundByMsgIDAtEdge(t *testing.T) {
+	msgs := convMessages("c", 1, 2, 3)
+	store := &stubPullStore{msgs: msgs}
+	svc := NewPullService(store).WithMessageFinder(store)
+
+	res, err := svc.PullAround(context.Background(), "c", 0, msgs[2].MsgID, 5, 5)
+	if err != nil {
+		t.Fatalf("PullAround error: %v", err)
+	}
+	if res.AnchorSeq != 3 || len(res.Messages) != 3 || res.HasMoreBefore || res.HasMoreAfter {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if _, err := svc.PullAround(context.Background(), "other", 0, msgs[0].MsgID, 1, 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound for foreign conversation, got %v", err)
+	}
+}
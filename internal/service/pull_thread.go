@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+
+	"go-im/internal/model"
+)
+
+// ThreadResult 是话题拉取结果，Messages 按 thread_seq 升序，NextCursorSeq 为本页最大 thread_seq。
+type ThreadResult struct {
+	Root          model.TimelineMessage   `json:"root"`
+	Messages      []model.TimelineMessage `json:"messages"`
+	NextCursorSeq int64                   `json:"next_cursor_seq"`
+	HasMore       bool                    `json:"has_more"`
+}
+
+// PullThread 按话题内 seq 拉取根消息下的回复，与会话 Timeline 独立翻页。
+func (s *PullService) PullThread(ctx context.Context, conversationID, rootMsgID string, cursorSeq int64, limit int) (ThreadResult, error) {
+	root, err := s.findAnchor(ctx, conversationID, rootMsgID)
+	if err != nil {
+		return ThreadResult{}, err
+	}
+	if root.ThreadRootID != "" {
+		// 话题不嵌套，回复本身不能作为根
+		return ThreadResult{}, ErrMessageNotFound
+	}
+	limit = normalizeLimit(limit)
+	msgs, err := s.store.ListThread(ctx, rootMsgID, cursorSeq, limit+1)
+	if err != nil {
+		return ThreadResult{}, err
+	}
+	res := ThreadResult{Root: *root, Messages: msgs, NextCursorSeq: cursorSeq}
+	if len(msgs) > limit {
+		res.Messages = msgs[:limit]
+		res.HasMore = true
+	}
+	if n := len(res.Messages); n > 0 {
+		res.NextCursorSeq = int64(res.Messages[n-1].ThreadSeq)
+	}
+	return res, nil
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"log"
 	"reflect"
 
 	"go-im/internal/model"
@@ -17,17 +19,108 @@ type ConnLookup interface {
 	Get(userID string) ConnWriter
 }
 
+// DeviceLookup 提供按用户 ID 获取其全部在线设备连接的能力，用于逐设备跟踪送达。
+type DeviceLookup interface {
+	Devices(userID string) []ConnWriter
+}
+
+// RouteLookup 查询用户连接所在的网关节点，返回 node_id -> 用户列表。
+type RouteLookup interface {
+	Lookup(ctx context.Context, userIDs []string) (map[string][]string, error)
+}
+
+// NodeBus 在网关节点间投递数据，由 RedisNodeBus 实现。
+type NodeBus interface {
+	Send(ctx context.Context, nodeID string, data []byte) error
+	Receive(ctx context.Context, nodeID string) (<-chan []byte, error)
+}
+
+// remotePush 是转发给其他节点的推送，由目标节点写给本地连接。
+type remotePush struct {
+	Targets []string           `json:"targets"`
+	Packet  model.OutputPacket `json:"packet"`
+}
+
 // PushService 负责将 OutputPacket 推送到在线用户。
 type PushService struct {
 	conns ConnLookup
+
+	tracker *DeliveryTracker // 可选：跟踪新消息推送的送达确认
+	devices DeviceLookup
+
+	routes RouteLookup // 可选：多节点部署时把推送转发到目标用户所在节点
+	bus    NodeBus
+	nodeID string
 }
 
 func NewPushService(conns ConnLookup) *PushService {
 	return &PushService{conns: conns}
 }
 
+// WithDeliveryTracker 启用送达跟踪：CmdPush 逐设备写出并登记，等待客户端按 msg_id 确认。
+func (s *PushService) WithDeliveryTracker(tracker *DeliveryTracker, devices DeviceLookup) *PushService {
+	s.tracker = tracker
+	s.devices = devices
+	return s
+}
+
+// WithRouter 启用跨节点路由：推送除写给本节点连接外，还按路由表转发给目标用户所在的其他节点。
+// 调用 Run 后才会接收其他节点转发来的推送。
+func (s *PushService) WithRouter(routes RouteLookup, bus NodeBus, nodeID string) *PushService {
+	s.routes = routes
+	s.bus = bus
+	s.nodeID = nodeID
+	return s
+}
+
+// Run 接收其他节点转发的推送并写给本地连接，直到 ctx 结束。
+func (s *PushService) Run(ctx context.Context) error {
+	if s.bus == nil {
+		return nil
+	}
+	data, err := s.bus.Receive(ctx, s.nodeID)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for raw := range data {
+			s.handleRemote(raw)
+		}
+	}()
+	return nil
+}
+
+// Local 返回只写本节点连接、不跨节点转发的 Pusher，
+// 供各节点自行维护订阅关系的场景使用（如在线状态），避免重复推送。
+func (s *PushService) Local() Pusher {
+	return localPusher{s}
+}
+
+type localPusher struct{ s *PushService }
+
+func (l localPusher) Broadcast(ctx context.Context, packet model.OutputPacket, targets []string) error {
+	return l.s.deliverLocal(packet, targets)
+}
+
 // Broadcast 将消息推送给 targets 中的用户，最佳努力发送。
 func (s *PushService) Broadcast(ctx context.Context, packet model.OutputPacket, targets []string) error {
+	err := s.deliverLocal(packet, targets)
+	if s.routes != nil {
+		if fwdErr := s.forward(ctx, packet, targets); fwdErr != nil && err == nil {
+			err = fwdErr
+		}
+	}
+	return err
+}
+
+// deliverLocal 写给本节点上的连接。
+func (s *PushService) deliverLocal(packet model.OutputPacket, targets []string) error {
+	if s.tracker != nil && packet.Cmd == model.CmdPush {
+		if msg, ok := packet.Payload.(model.TimelineMessage); ok {
+			return s.broadcastTracked(packet, msg, targets)
+		}
+	}
+
 	// TODO: 遍历 targets，获取连接并 WriteJSON；缺失连接或写失败时继续其他用户，最后返回汇总/首个错误。
 	var err error
 	for _, target := range targets {
@@ -46,3 +139,74 @@ func (s *PushService) Broadcast(ctx context.Context, packet model.OutputPacket,
 	}
 	return err
 }
+
+// forward 按路由表把推送转发给其他节点；本节点上的连接已由 deliverLocal 处理。
+func (s *PushService) forward(ctx context.Context, packet model.OutputPacket, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	nodes, err := s.routes.Lookup(ctx, targets)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for node, users := range nodes {
+		if node == s.nodeID {
+			continue
+		}
+		data, err := json.Marshal(remotePush{Targets: users, Packet: packet})
+		if err == nil {
+			err = s.bus.Send(ctx, node, data)
+		}
+		if err != nil {
+			log.Printf("转发推送到节点 %s 失败: %v", node, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// handleRemote 解析其他节点转发的推送并写给本地连接。Payload 保留原始 JSON 原样写出；
+// 新消息推送还原为 TimelineMessage，以便本节点继续跟踪送达。
+func (s *PushService) handleRemote(raw []byte) {
+	var in struct {
+		Targets []string `json:"targets"`
+		Packet  struct {
+			model.OutputPacket
+			Payload json.RawMessage `json:"payload,omitempty"`
+		} `json:"packet"`
+	}
+	if err := json.Unmarshal(raw, &in); err != nil {
+		log.Printf("解析跨节点推送失败: %v", err)
+		return
+	}
+	packet := in.Packet.OutputPacket
+	if len(in.Packet.Payload) > 0 {
+		packet.Payload = in.Packet.Payload
+		if packet.Cmd == model.CmdPush {
+			var msg model.TimelineMessage
+			if err := json.Unmarshal(in.Packet.Payload, &msg); err == nil {
+				packet.Payload = msg
+			}
+		}
+	}
+	if err := s.deliverLocal(packet, in.Targets); err != nil {
+		log.Printf("写出跨节点推送失败 cmd=%d: %v", packet.Cmd, err)
+	}
+}
+
+// broadcastTracked 逐设备推送新消息并登记送达跟踪；写失败的设备同样登记，由重发兜底。
+func (s *PushService) broadcastTracked(packet model.OutputPacket, msg model.TimelineMessage, targets []string) error {
+	var err error
+	for _, target := range targets {
+		for _, conn := range s.devices.Devices(target) {
+			if curErr := conn.WriteJSON(packet); curErr != nil && err == nil {
+				err = curErr
+			}
+			s.tracker.Track(conn, target, msg, packet)
+		}
+	}
+	return err
+}
@@ -2,8 +2,10 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"go-im/internal/model"
 	"go-im/internal/service"
@@ -96,3 +98,91 @@ func TestBroadcastSkipsMissingConnection(t *testing.T) {
 		t.Fatalf("expected present connection to receive payload")
 	}
 }
+
+// memNodeBus 以进程内 channel 模拟节点间频道。
+type memNodeBus struct {
+	channels map[string]chan []byte
+}
+
+func (b *memNodeBus) Send(ctx context.Context, nodeID string, data []byte) error {
+	if ch, ok := b.channels[nodeID]; ok {
+		ch <- data
+	}
+	return nil
+}
+
+func (b *memNodeBus) Receive(ctx context.Context, nodeID string) (<-chan []byte, error) {
+	return b.channels[nodeID], nil
+}
+
+type stubRoutes map[string][]string // node -> users
+
+func (r stubRoutes) Lookup(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	return r, nil
+}
+
+// notifyConn 每次写入后通知，便于等待异步的跨节点投递。
+type notifyConn struct {
+	writes chan interface{}
+}
+
+func (c *notifyConn) WriteJSON(v interface{}) error {
+	c.writes <- v
+	return nil
+}
+
+type notifyLookup map[string]*notifyConn
+
+func (l notifyLookup) Get(userID string) service.ConnWriter {
+	if c, ok := l[userID]; ok {
+		return c
+	}
+	return nil
+}
+
+func TestBroadcastForwardsToRemoteNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := &memNodeBus{channels: map[string]chan []byte{"node-a": make(chan []byte, 4), "node-b": make(chan []byte, 4)}}
+	routes := stubRoutes{"node-a": {"u1"}, "node-b": {"u2"}}
+
+	u1 := &notifyConn{writes: make(chan interface{}, 4)}
+	u2 := &notifyConn{writes: make(chan interface{}, 4)}
+	pushA := service.NewPushService(notifyLookup{"u1": u1}).WithRouter(routes, bus, "node-a")
+	pushB := service.NewPushService(notifyLookup{"u2": u2}).WithRouter(routes, bus, "node-b")
+	if err := pushB.Run(ctx); err != nil {
+		t.Fatalf("run node-b: %v", err)
+	}
+
+	packet := model.OutputPacket{Cmd: model.CmdSignal, Payload: map[string]string{"kind": "typing"}}
+	if err := pushA.Broadcast(ctx, packet, []string{"u1", "u2"}); err != nil {
+		t.Fatalf("Broadcast returned error: %v", err)
+	}
+	if got := <-u1.writes; got.(model.OutputPacket).Cmd != model.CmdSignal {
+		t.Fatalf("unexpected local write %#v", got)
+	}
+	select {
+	case got := <-u2.writes:
+		data, _ := json.Marshal(got)
+		if string(data) != `{"cmd":14,"code":0,"payload":{"kind":"typing"}}` {
+			t.Fatalf("unexpected remote write %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("remote node did not deliver")
+	}
+	if len(bus.channels["node-a"]) != 0 {
+		t.Fatalf("local node should not forward to itself")
+	}
+}
+
+func TestLocalPusherDoesNotForward(t *testing.T) {
+	bus := &memNodeBus{channels: map[string]chan []byte{"node-b": make(chan []byte, 1)}}
+	push := service.NewPushService(notifyLookup{}).WithRouter(stubRoutes{"node-b": {"u2"}}, bus, "node-a")
+
+	if err := push.Local().Broadcast(context.Background(), model.OutputPacket{Cmd: model.CmdPresence}, []string{"u2"}); err != nil {
+		t.Fatalf("Broadcast returned error: %v", err)
+	}
+	if len(bus.channels["node-b"]) != 0 {
+		t.Fatalf("local pusher should not forward to other nodes")
+	}
+}
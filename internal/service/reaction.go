@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"go-im/internal/model"
+)
+
+// MaxEmojiLength 单个表情的最大字符数（兼容组合表情与 :shortcode:）。
+const MaxEmojiLength = 16
+
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// 表情回应动作
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+// ReactionStore 保存表情回应，由 ReactionRepository 实现；无变化时返回 false。
+type ReactionStore interface {
+	AddReaction(ctx context.Context, msgID, emoji, userID string) (bool, error)
+	RemoveReaction(ctx context.Context, msgID, emoji, userID string) (bool, error)
+	ListReactions(ctx context.Context, msgID string) ([]model.MessageReaction, error)
+}
+
+// ReactionSummary 某个表情的回应人数与回应者（按回应先后）。
+type ReactionSummary struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// ReactionEvent 是表情回应事件（msg_type=102）的正文，Count 为该表情变更后的总数。
+type ReactionEvent struct {
+	MsgID     string `json:"msg_id"`
+	Seq       uint64 `json:"seq"`
+	Emoji     string `json:"emoji"`
+	Action    string `json:"action"`
+	UserID    string `json:"user_id"`
+	Count     int    `json:"count"`
+	ReactedAt int64  `json:"reacted_at"`
+}
+
+// WithReactionStore 启用表情回应。
+func (s *MessageService) WithReactionStore(store ReactionStore) *MessageService {
+	s.reactions = store
+	return s
+}
+
+// React 添加或取消表情回应，并在 Timeline 追加回应事件供离线客户端同步。
+// 重复添加或取消不存在的回应视为幂等成功，返回 nil 事件且不占用 seq。
+func (s *MessageService) React(ctx context.Context, userID, conversationID, msgID, emoji, action string) (*model.TimelineMessage, error) {
+	if s.reactions == nil {
+		return nil, errors.New("reactions not enabled")
+	}
+	if emoji == "" || utf8.RuneCountInString(emoji) > MaxEmojiLength || (action != ReactionAdd && action != ReactionRemove) {
+		return nil, ErrInvalidEmoji
+	}
+	conv, orig, err := s.findTarget(ctx, userID, conversationID, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed bool
+	if action == ReactionAdd {
+		changed, err = s.reactions.AddReaction(ctx, msgID, emoji, userID)
+	} else {
+		changed, err = s.reactions.RemoveReaction(ctx, msgID, emoji, userID)
+	}
+	if err != nil || !changed {
+		return nil, err
+	}
+
+	rows, err := s.reactions.ListReactions(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	event := ReactionEvent{MsgID: orig.MsgID, Seq: orig.Seq, Emoji: emoji, Action: action, UserID: userID, ReactedAt: time.Now().UnixMilli()}
+	for _, sum := range summarizeReactions(rows) {
+		if sum.Emoji == emoji {
+			event.Count = sum.Count
+		}
+	}
+	return s.appendEvent(ctx, conv, userID, model.MsgTypeReaction, event)
+}
+
+// ListReactions 返回消息按表情聚合的回应，表情按首次回应时间排序。
+func (s *MessageService) ListReactions(ctx context.Context, userID, conversationID, msgID string) ([]ReactionSummary, error) {
+	if s.reactions == nil {
+		return nil, errors.New("reactions not enabled")
+	}
+	if _, _, err := s.findTarget(ctx, userID, conversationID, msgID); err != nil {
+		return nil, err
+	}
+	rows, err := s.reactions.ListReactions(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	return summarizeReactions(rows), nil
+}
+
+func summarizeReactions(rows []model.MessageReaction) []ReactionSummary {
+	index := make(map[string]int)
+	summaries := make([]ReactionSummary, 0)
+	for _, r := range rows {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(summaries)
+			index[r.Emoji] = i
+			summaries = append(summaries, ReactionSummary{Emoji: r.Emoji})
+		}
+		summaries[i].Count++
+		summaries[i].Users = append(summaries[i].Users, r.UserID)
+	}
+	return summaries
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+type stubReactionStore struct {
+	rows []model.MessageReaction
+}
+
+func (s *stubReactionStore) AddReaction(ctx context.Context, msgID, emoji, userID string) (bool, error) {
+	for _, r := range s.rows {
+		if r.MsgID == msgID && r.Emoji == emoji && r.UserID == userID {
+			return false, nil
+		}
+	}
+	s.rows = append(s.rows, model.MessageReaction{MsgID: msgID, Emoji: emoji, UserID: userID})
+	return true, nil
+}
+
+func (s *stubReactionStore) RemoveReaction(ctx context.Context, msgID, emoji, userID string) (bool, error) {
+	for i, r := range s.rows {
+		if r.MsgID == msgID && r.Emoji == emoji && r.UserID == userID {
+			s.rows = append(s.rows[:i], s.rows[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *stubReactionStore) ListReactions(ctx context.Context, msgID string) ([]model.MessageReaction, error) {
+	var out []model.MessageReaction
+	for _, r := range s.rows {
+		if r.MsgID == msgID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func TestReactAppendsEventsAndAggregates(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2", "u3"}}
+	svc, _, _, pusher := newMessageFixture(conv, 0)
+	svc.WithReactionStore(&stubReactionStore{})
+	ctx := context.Background()
+
+	event, err := svc.React(ctx, "u2", conv.ID, "m1", "👍", ReactionAdd)
+	if err != nil {
+		t.Fatalf("React returned error: %v", err)
+	}
+	if event.Seq != 2 || event.MsgType != model.MsgTypeReaction {
+		t.Fatalf("expected reaction event at seq 2, got %+v", event)
+	}
+	if len(pusher.targets) != 1 || len(pusher.targets[0]) != 2 || containsUser(pusher.targets[0], "u2") {
+		t.Fatalf("expected event pushed to other participants, got %v", pusher.targets)
+	}
+
+	// 重复添加为幂等，不追加事件
+	if again, err := svc.React(ctx, "u2", conv.ID, "m1", "👍", ReactionAdd); err != nil || again != nil {
+		t.Fatalf("duplicate add should be a no-op, got %+v err=%v", again, err)
+	}
+	event, err = svc.React(ctx, "u3", conv.ID, "m1", "👍", ReactionAdd)
+	if err != nil {
+		t.Fatalf("React returned error: %v", err)
+	}
+	var payload ReactionEvent
+	if err := json.Unmarshal([]byte(event.Content), &payload); err != nil || payload.Count != 2 || payload.MsgID != "m1" {
+		t.Fatalf("unexpected event content %q: %v", event.Content, err)
+	}
+	if _, err := svc.React(ctx, "u1", conv.ID, "m1", "🎉", ReactionAdd); err != nil {
+		t.Fatalf("React returned error: %v", err)
+	}
+	if _, err := svc.React(ctx, "u2", conv.ID, "m1", "👍", ReactionRemove); err != nil {
+		t.Fatalf("React remove returned error: %v", err)
+	}
+
+	summaries, err := svc.ListReactions(ctx, "u1", conv.ID, "m1")
+	if err != nil {
+		t.Fatalf("ListReactions returned error: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Emoji != "👍" || summaries[0].Count != 1 || summaries[0].Users[0] != "u3" || summaries[1].Count != 1 {
+		t.Fatalf("unexpected summaries %+v", summaries)
+	}
+}
+
+func TestReactValidatesInput(t *testing.T) {
+	conv := ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}
+	svc, repo, _, _ := newMessageFixture(conv, time.Second)
+	svc.WithReactionStore(&stubReactionStore{})
+	ctx := context.Background()
+
+	if _, err := svc.React(ctx, "u2", conv.ID, "m1", "", ReactionAdd); !errors.Is(err, ErrInvalidEmoji) {
+		t.Fatalf("empty emoji should be rejected, got %v", err)
+	}
+	if _, err := svc.React(ctx, "u2", conv.ID, "m1", "👍", "toggle"); !errors.Is(err, ErrInvalidEmoji) {
+		t.Fatalf("unknown action should be rejected, got %v", err)
+	}
+	repo.store["m1"].Status = model.MessageStatusRecalled
+	if _, err := svc.React(ctx, "u2", conv.ID, "m1", "👍", ReactionAdd); !errors.Is(err, ErrAlreadyRecalled) {
+		t.Fatalf("recalled message should reject reactions, got %v", err)
+	}
+}
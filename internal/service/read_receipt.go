@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// ReceiptStore 抽象已读位点的存储，便于测试替换。
+type ReceiptStore interface {
+	UpsertRead(ctx context.Context, userID, conversationID string, readSeq, readAt int64) error
+	GetState(ctx context.Context, userID, conversationID string) (model.UserConversationState, error)
+	ListReaders(ctx context.Context, conversationID string, seq int64) ([]model.UserConversationState, error)
+	ListSenders(ctx context.Context, conversationID string, afterSeq, upToSeq int64) ([]string, error)
+	MarkMessagesRead(ctx context.Context, conversationID, readerID string, afterSeq, upToSeq int64) error
+	LatestSeq(ctx context.Context, conversationID string) (int64, error)
+}
+
+// ReadReceipt 是推送给消息发送者的已读回执：reader 已读到 read_seq（含）。
+type ReadReceipt struct {
+	ConversationID string `json:"conversation_id"`
+	ReaderID       string `json:"reader_id"`
+	ReadSeq        int64  `json:"read_seq"`
+	ReadAt         int64  `json:"read_at"`
+}
+
+// ReadState 描述用户与（单聊）对方在会话中的已读位点。
+type ReadState struct {
+	ConversationID string `json:"conversation_id"`
+	ReadSeq        int64  `json:"read_seq"`                // 我的已读位点
+	PeerReadSeq    int64  `json:"peer_read_seq,omitempty"` // 单聊对方已读到的 seq
+}
+
+// Reader 是群消息已读列表中的一项。
+type Reader struct {
+	UserID  string `json:"user_id"`
+	ReadSeq int64  `json:"read_seq"`
+	ReadAt  int64  `json:"read_at"`
+}
+
+// ReceiptService 处理已读回执。已读位点与送达 ACK 分开记录：ACK 表示消息已到达设备，已读表示用户看过。
+type ReceiptService struct {
+	store    ReceiptStore
+	resolver ParticipantResolver
+	pusher   Pusher // 可选：通知发送者的在线设备
+}
+
+func NewReceiptService(store ReceiptStore, resolver ParticipantResolver) *ReceiptService {
+	return &ReceiptService{store: store, resolver: resolver}
+}
+
+// WithPusher 可选注入在线推送。
+func (s *ReceiptService) WithPusher(pusher Pusher) *ReceiptService {
+	s.pusher = pusher
+	return s
+}
+
+// MarkRead 记录 userID 已读到 readSeq，并通知区间内消息的发送者；位点不前进时不重复通知。
+// readSeq 超过会话已落库的最新 seq 时按最新 seq 记录，避免位点跑到未来、后续消息被直接算作已读。
+// 单聊同时把对方发来的消息状态置为已读（status=2）。
+func (s *ReceiptService) MarkRead(ctx context.Context, userID, conversationID string, readSeq int64) (ReadReceipt, error) {
+	if readSeq <= 0 {
+		return ReadReceipt{}, errors.New("read seq must be positive")
+	}
+	conv, err := s.authorize(ctx, userID, conversationID)
+	if err != nil {
+		return ReadReceipt{}, err
+	}
+	latest, err := s.store.LatestSeq(ctx, conv.ID)
+	if err != nil {
+		return ReadReceipt{}, err
+	}
+	if readSeq > latest {
+		readSeq = latest
+	}
+	prev, err := s.store.GetState(ctx, userID, conv.ID)
+	if err != nil {
+		return ReadReceipt{}, err
+	}
+	receipt := ReadReceipt{ConversationID: conv.ID, ReaderID: userID, ReadSeq: readSeq, ReadAt: time.Now().UnixMilli()}
+	if readSeq <= prev.LastReadSeq {
+		receipt.ReadSeq = prev.LastReadSeq
+		return receipt, nil
+	}
+	if err := s.store.UpsertRead(ctx, userID, conv.ID, readSeq, receipt.ReadAt); err != nil {
+		return ReadReceipt{}, err
+	}
+
+	var targets []string
+	if conv.Type == model.ConversationTypePrivate {
+		if err := s.store.MarkMessagesRead(ctx, conv.ID, userID, prev.LastReadSeq, readSeq); err != nil {
+			log.Printf("更新消息已读状态失败 conv=%s reader=%s: %v", conv.ID, userID, err)
+		}
+		targets = excludeUser(conv.Participants, userID)
+	} else {
+		senders, err := s.store.ListSenders(ctx, conv.ID, prev.LastReadSeq, readSeq)
+		if err != nil {
+			log.Printf("查询已读区间发送者失败 conv=%s: %v", conv.ID, err)
+		}
+		targets = excludeUser(senders, userID)
+	}
+	if s.pusher != nil && len(targets) > 0 {
+		packet := model.OutputPacket{Cmd: model.CmdRead, Seq: readSeq, Payload: receipt}
+		if err := s.pusher.Broadcast(ctx, packet, targets); err != nil {
+			log.Printf("推送已读回执失败 conv=%s reader=%s: %v", conv.ID, userID, err)
+		}
+	}
+	return receipt, nil
+}
+
+// ReadState 返回用户的已读位点；单聊附带对方已读到的 seq。
+func (s *ReceiptService) ReadState(ctx context.Context, userID, conversationID string) (ReadState, error) {
+	conv, err := s.authorize(ctx, userID, conversationID)
+	if err != nil {
+		return ReadState{}, err
+	}
+	mine, err := s.store.GetState(ctx, userID, conv.ID)
+	if err != nil {
+		return ReadState{}, err
+	}
+	state := ReadState{ConversationID: conv.ID, ReadSeq: mine.LastReadSeq}
+	if conv.Type == model.ConversationTypePrivate {
+		for _, peer := range excludeUser(conv.Participants, userID) {
+			peerState, err := s.store.GetState(ctx, peer, conv.ID)
+			if err != nil {
+				return ReadState{}, err
+			}
+			state.PeerReadSeq = peerState.LastReadSeq
+		}
+	}
+	return state, nil
+}
+
+// ListReaders 返回已读到 seq 的会话成员（不含查询者本人），用于群消息的“谁已读”。
+func (s *ReceiptService) ListReaders(ctx context.Context, userID, conversationID string, seq int64) ([]Reader, error) {
+	conv, err := s.authorize(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	states, err := s.store.ListReaders(ctx, conv.ID, seq)
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]Reader, 0, len(states))
+	for _, st := range states {
+		// 已退群的成员不再展示
+		if st.UserID == userID || !containsUser(conv.Participants, st.UserID) {
+			continue
+		}
+		readAt := st.ReadAt
+		if readAt == 0 {
+			// 补列前写入的行没有 read_at，退回 updated_at
+			readAt = st.UpdatedAt.UnixMilli()
+		}
+		readers = append(readers, Reader{UserID: st.UserID, ReadSeq: st.LastReadSeq, ReadAt: readAt})
+	}
+	return readers, nil
+}
+
+// authorize 解析会话并确认 userID 是参与者。
+func (s *ReceiptService) authorize(ctx context.Context, userID, conversationID string) (ConversationInfo, error) {
+	conv, err := s.resolver.Resolve(ctx, conversationID, userID)
+	if err != nil {
+		return ConversationInfo{}, err
+	}
+	if !containsUser(conv.Participants, userID) {
+		return conv, ErrForbidden
+	}
+	return conv, nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+type stubReceiptStore struct {
+	states  map[string]model.UserConversationState // key: user|conv
+	msgs    []model.TimelineMessage
+	marked  [][2]int64 // (afterSeq, upToSeq]
+	upserts int
+}
+
+func newStubReceiptStore(msgs ...model.TimelineMessage) *stubReceiptStore {
+	return &stubReceiptStore{states: make(map[string]model.UserConversationState), msgs: msgs}
+}
+
+func (s *stubReceiptStore) UpsertRead(ctx context.Context, userID, conversationID string, readSeq, readAt int64) error {
+	s.upserts++
+	st := s.states[userID+"|"+conversationID]
+	st.UserID, st.ConversationID = userID, conversationID
+	if readSeq > st.LastReadSeq {
+		st.LastReadSeq = readSeq
+		st.ReadAt = readAt
+	}
+	s.states[userID+"|"+conversationID] = st
+	return nil
+}
+
+func (s *stubReceiptStore) GetState(ctx context.Context, userID, conversationID string) (model.UserConversationState, error) {
+	return s.states[userID+"|"+conversationID], nil
+}
+
+func (s *stubReceiptStore) ListReaders(ctx context.Context, conversationID string, seq int64) ([]model.UserConversationState, error) {
+	var out []model.UserConversationState
+	for _, st := range s.states {
+		if st.ConversationID == conversationID && st.LastReadSeq >= seq {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubReceiptStore) ListSenders(ctx context.Context, conversationID string, afterSeq, upToSeq int64) ([]string, error) {
+	var out []string
+	for _, m := range s.msgs {
+		if m.ConversationID == conversationID && int64(m.Seq) > afterSeq && int64(m.Seq) <= upToSeq && !containsUser(out, m.SenderID) {
+			out = append(out, m.SenderID)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubReceiptStore) LatestSeq(ctx context.Context, conversationID string) (int64, error) {
+	var latest int64
+	for _, m := range s.msgs {
+		if m.ConversationID == conversationID && int64(m.Seq) > latest {
+			latest = int64(m.Seq)
+		}
+	}
+	return latest, nil
+}
+
+func (s *stubReceiptStore) MarkMessagesRead(ctx context.Context, conversationID, readerID string, afterSeq, upToSeq int64) error {
+	s.marked = append(s.marked, [2]int64{afterSeq, upToSeq})
+	return nil
+}
+
+func TestMarkReadPrivateNotifiesPeerOnce(t *testing.T) {
+	store := newStubReceiptStore(convMessages("private_u1_u2", 1, 2, 3, 4, 5)...)
+	pusher := &stubPusher{}
+	resolver := &countingResolver{info: ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}}
+	svc := NewReceiptService(store, resolver).WithPusher(pusher)
+
+	receipt, err := svc.MarkRead(context.Background(), "u2", "private_u1_u2", 5)
+	if err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+	if receipt.ReadSeq != 5 || len(store.marked) != 1 {
+		t.Fatalf("expected read seq 5 and status update, got %+v marked=%v", receipt, store.marked)
+	}
+	if len(pusher.packets) != 1 || pusher.packets[0].Cmd != model.CmdRead || pusher.targets[0][0] != "u1" {
+		t.Fatalf("expected receipt pushed to u1, got %+v %v", pusher.packets, pusher.targets)
+	}
+
+	// 位点回退或不变：不写库、不推送
+	if receipt, _ = svc.MarkRead(context.Background(), "u2", "private_u1_u2", 3); receipt.ReadSeq != 5 {
+		t.Fatalf("read seq must not move backwards, got %d", receipt.ReadSeq)
+	}
+	if store.upserts != 1 || len(pusher.packets) != 1 {
+		t.Fatalf("stale receipt should be a no-op, upserts=%d pushes=%d", store.upserts, len(pusher.packets))
+	}
+
+	state, err := svc.ReadState(context.Background(), "u1", "private_u1_u2")
+	if err != nil || state.PeerReadSeq != 5 {
+		t.Fatalf("expected peer read seq 5, got %+v err=%v", state, err)
+	}
+
+	// 再次前进只标记新区间
+	store.msgs = append(store.msgs, convMessages("private_u1_u2", 6, 7)...)
+	if _, err := svc.MarkRead(context.Background(), "u2", "private_u1_u2", 7); err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+	if len(store.marked) != 2 || store.marked[1] != [2]int64{5, 7} {
+		t.Fatalf("expected status update bounded to (5, 7], got %v", store.marked)
+	}
+}
+
+func TestMarkReadGroupNotifiesSendersAndListsReaders(t *testing.T) {
+	msgs := []model.TimelineMessage{
+		{ConversationID: "group_1", Seq: 1, SenderID: "u1"},
+		{ConversationID: "group_1", Seq: 2, SenderID: "u2"},
+		{ConversationID: "group_1", Seq: 3, SenderID: "u3"},
+	}
+	store := newStubReceiptStore(msgs...)
+	pusher := &stubPusher{}
+	resolver := &countingResolver{info: ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2", "u3"}}}
+	svc := NewReceiptService(store, resolver).WithPusher(pusher)
+
+	if _, err := svc.MarkRead(context.Background(), "u3", "group_1", 3); err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+	if got := pusher.targets[0]; len(got) != 2 || containsUser(got, "u3") {
+		t.Fatalf("expected senders u1,u2 notified, got %v", got)
+	}
+	if len(store.marked) != 0 {
+		t.Fatalf("group read should not update message status")
+	}
+	if _, err := svc.MarkRead(context.Background(), "u2", "group_1", 1); err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+
+	readers, err := svc.ListReaders(context.Background(), "u1", "group_1", 2)
+	if err != nil {
+		t.Fatalf("ListReaders returned error: %v", err)
+	}
+	if len(readers) != 1 || readers[0].UserID != "u3" {
+		t.Fatalf("expected only u3 to have read seq 2, got %+v", readers)
+	}
+
+	if _, err := svc.ListReaders(context.Background(), "u9", "group_1", 2); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("non-member should be forbidden, got %v", err)
+	}
+}
+
+func TestMarkReadClampsToLatestSeq(t *testing.T) {
+	store := newStubReceiptStore(convMessages("private_u1_u2", 1, 2, 3)...)
+	resolver := &countingResolver{info: ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}}
+	svc := NewReceiptService(store, resolver)
+
+	receipt, err := svc.MarkRead(context.Background(), "u2", "private_u1_u2", 1000)
+	if err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+	if receipt.ReadSeq != 3 || store.states["u2|private_u1_u2"].LastReadSeq != 3 {
+		t.Fatalf("expected read seq clamped to 3, got receipt=%+v state=%+v", receipt, store.states["u2|private_u1_u2"])
+	}
+	if len(store.marked) != 1 || store.marked[0] != [2]int64{0, 3} {
+		t.Fatalf("expected status update for (0, 3], got %v", store.marked)
+	}
+
+	// 新消息到达后，之前超前的上报不会让它被算作已读
+	store.msgs = append(store.msgs, convMessages("private_u1_u2", 4)...)
+	if state, _ := svc.ReadState(context.Background(), "u2", "private_u1_u2"); state.ReadSeq != 3 {
+		t.Fatalf("expected seq 4 to stay unread, got %+v", state)
+	}
+}
+
+func TestListReadersUsesReadTimeNotLastUpdate(t *testing.T) {
+	store := newStubReceiptStore(convMessages("group_1", 1, 2, 3)...)
+	resolver := &countingResolver{info: ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2"}}}
+	svc := NewReceiptService(store, resolver)
+
+	receipt, err := svc.MarkRead(context.Background(), "u2", "group_1", 2)
+	if err != nil {
+		t.Fatalf("MarkRead returned error: %v", err)
+	}
+	// 之后的 ACK 会刷新 updated_at，但不应改变已读时间
+	st := store.states["u2|group_1"]
+	st.UpdatedAt = time.Now().Add(time.Hour)
+	store.states["u2|group_1"] = st
+
+	readers, err := svc.ListReaders(context.Background(), "u1", "group_1", 2)
+	if err != nil {
+		t.Fatalf("ListReaders returned error: %v", err)
+	}
+	if len(readers) != 1 || readers[0].ReadAt != receipt.ReadAt {
+		t.Fatalf("expected read_at %d, got %+v", receipt.ReadAt, readers)
+	}
+}
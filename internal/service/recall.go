@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"go-im/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultRecallWindow 发送者可撤回自己消息的默认时限。
+const DefaultRecallWindow = 2 * time.Minute
+
+var (
+	ErrRecallWindowExpired = errors.New("recall window expired")
+	ErrAlreadyRecalled     = errors.New("message already recalled")
+)
+
+// RecallStore 将消息标记为已撤回，由 MessageRepository 实现；已撤回时返回 false。
+type RecallStore interface {
+	MarkRecalled(ctx context.Context, msgID string) (bool, error)
+}
+
+// GroupRoleSource 提供群成员角色，用于管理员撤回等特权操作。
+type GroupRoleSource interface {
+	GetRole(ctx context.Context, groupID, userID string) (int8, error)
+}
+
+// RecallEvent 是撤回事件（msg_type=100）的正文，追加在会话 Timeline 中。
+type RecallEvent struct {
+	MsgID      string `json:"msg_id"`
+	Seq        uint64 `json:"seq"`
+	OperatorID string `json:"operator_id"`
+	RecalledAt int64  `json:"recalled_at"`
+}
+
+// WithRecall 启用撤回，window 为发送者可撤回的时限（<=0 时使用默认值）。
+func (s *MessageService) WithRecall(store RecallStore, window time.Duration) *MessageService {
+	if window <= 0 {
+		window = DefaultRecallWindow
+	}
+	s.recallStore = store
+	s.recallWindow = window
+	return s
+}
+
+// WithGroupRoles 可选注入群成员角色来源，群管理员可随时撤回任意消息。
+func (s *MessageService) WithGroupRoles(roles GroupRoleSource) *MessageService {
+	s.roles = roles
+	return s
+}
+
+// Recall 撤回一条消息：原消息清空正文并标记为已撤回，同时在 Timeline 追加撤回事件，
+// 经与聊天消息相同的扩散流程写 Inbox 并推送，离线客户端同步时即可看到。
+func (s *MessageService) Recall(ctx context.Context, operatorID, conversationID, msgID string) (*model.TimelineMessage, error) {
+	if s.recallStore == nil {
+		return nil, errors.New("recall not enabled")
+	}
+	conv, err := s.Authorize(ctx, operatorID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	orig, err := s.msgRepo.FindByMsgID(ctx, msgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if orig.ConversationID != conv.ID || orig.MsgType >= model.MsgTypeRecall {
+		return nil, ErrMessageNotFound
+	}
+	if orig.Status == model.MessageStatusRecalled {
+		return nil, ErrAlreadyRecalled
+	}
+	if err := s.canRecall(ctx, operatorID, conv, orig); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.recallStore.MarkRecalled(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAlreadyRecalled
+	}
+	orig.Status = model.MessageStatusRecalled
+	orig.Content = ""
+	// Inbox 只存引用，正文从最近消息缓存回填，覆盖缓存即可让所有读者看到撤回后的内容
+	if s.recent != nil {
+		if err := s.recent.Put(ctx, *orig); err != nil {
+			log.Printf("更新最近消息缓存失败 conv=%s msg_id=%s: %v", conv.ID, msgID, err)
+		}
+	}
+
+	return s.appendEvent(ctx, conv, operatorID, model.MsgTypeRecall, RecallEvent{
+		MsgID:      orig.MsgID,
+		Seq:        orig.Seq,
+		OperatorID: operatorID,
+		RecalledAt: time.Now().UnixMilli(),
+	})
+}
+
+// canRecall 发送者在时限内可撤回；群管理员与群主不受时限限制。
+func (s *MessageService) canRecall(ctx context.Context, operatorID string, conv ConversationInfo, orig *model.TimelineMessage) error {
+	if operatorID == orig.SenderID && time.Since(sentAt(orig)) <= s.recallWindow {
+		return nil
+	}
+	if conv.Type == model.ConversationTypeGroup && s.roles != nil {
+		role, err := s.roles.GetRole(ctx, conv.ID, operatorID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if role >= model.GroupRoleAdmin {
+			return nil
+		}
+	}
+	if operatorID == orig.SenderID {
+		return ErrRecallWindowExpired
+	}
+	return ErrForbidden
+}
+
+// sentAt 以服务端落库时间为准，缺失时退回客户端上报的发送时间。
+func sentAt(msg *model.TimelineMessage) time.Time {
+	if !msg.CreatedAt.IsZero() {
+		return msg.CreatedAt
+	}
+	return time.UnixMilli(msg.SendTime)
+}
+
+// appendEvent 以系统事件（msg_type >= 100）的形式追加到会话 Timeline，并走正常投递流程。
+func (s *MessageService) appendEvent(ctx context.Context, conv ConversationInfo, operatorID string, msgType int8, event interface{}) (*model.TimelineMessage, error) {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	msg := &model.TimelineMessage{
+		MsgID:          uuid.NewString(),
+		ConversationID: conv.ID,
+		SenderID:       operatorID,
+		Content:        string(content),
+		MsgType:        msgType,
+		Status:         model.MessageStatusSending,
+		SendTime:       time.Now().UnixMilli(),
+	}
+	if s.seqGen != nil {
+		seq, err := s.seqGen.NextSeq(ctx, conv.ID)
+		if err != nil {
+			return nil, err
+		}
+		msg.Seq = seq
+	}
+	if err := s.msgRepo.SaveMessage(ctx, msg); err != nil {
+		return nil, err
+	}
+	s.deliver(ctx, msg, conv)
+	return msg, nil
+}
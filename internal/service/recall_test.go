@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+func TestRecallBySenderAppendsEvent(t *testing.T) {
+	conv := ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}
+	svc, repo, cache, pusher := newMessageFixture(conv, 10*time.Second)
+
+	event, err := svc.Recall(context.Background(), "u1", conv.ID, "m1")
+	if err != nil {
+		t.Fatalf("Recall returned error: %v", err)
+	}
+	if orig := repo.store["m1"]; orig.Status != model.MessageStatusRecalled || orig.Content != "" {
+		t.Fatalf("original should be recalled and cleared, got %+v", orig)
+	}
+	if cached := cache.msgs[1]; cached.Status != model.MessageStatusRecalled {
+		t.Fatalf("recent cache should hold recalled original, got %+v", cached)
+	}
+	if event.Seq != 2 || event.MsgType != model.MsgTypeRecall {
+		t.Fatalf("expected recall event at seq 2, got %+v", event)
+	}
+	var payload RecallEvent
+	if err := json.Unmarshal([]byte(event.Content), &payload); err != nil || payload.MsgID != "m1" || payload.Seq != 1 {
+		t.Fatalf("unexpected event content %q: %v", event.Content, err)
+	}
+	if len(pusher.targets) != 1 || pusher.targets[0][0] != "u2" {
+		t.Fatalf("expected event pushed to peer, got %v", pusher.targets)
+	}
+
+	if _, err := svc.Recall(context.Background(), "u1", conv.ID, "m1"); !errors.Is(err, ErrAlreadyRecalled) {
+		t.Fatalf("expected ErrAlreadyRecalled, got %v", err)
+	}
+}
+
+func TestRecallRespectsWindowAndRoles(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2", "u3"}}
+
+	svc, _, _, _ := newMessageFixture(conv, time.Hour)
+	if _, err := svc.Recall(context.Background(), "u1", conv.ID, "m1"); !errors.Is(err, ErrRecallWindowExpired) {
+		t.Fatalf("sender past window should be rejected, got %v", err)
+	}
+
+	svc.WithGroupRoles(stubRoles{"u2": model.GroupRoleAdmin})
+	if _, err := svc.Recall(context.Background(), "u3", conv.ID, "m1"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("plain member should be forbidden, got %v", err)
+	}
+	if _, err := svc.Recall(context.Background(), "u2", conv.ID, "m1"); err != nil {
+		t.Fatalf("admin should recall anytime, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"go-im/internal/model"
+)
+
+// RecentCache 定义会话最近消息缓存，按会话共享，供 Inbox 引用回填内容与近端拉取。
+type RecentCache interface {
+	Put(ctx context.Context, msg model.TimelineMessage) error
+	Get(ctx context.Context, conversationID string, seqs []uint64) (map[uint64]model.TimelineMessage, error)
+	// Range 返回 seq > afterSeq 的至多 limit 条消息；covered 表示 afterSeq 落在缓存窗口内，
+	// 即缓存中最小的 seq 不大于 afterSeq+1，否则调用方需回源 MySQL。
+	Range(ctx context.Context, conversationID string, afterSeq int64, limit int) (msgs []model.TimelineMessage, covered bool, err error)
+}
+
+// recentCacheStats 暴露在 /admin/debug/vars 的命中率指标。
+var recentCacheStats = expvar.NewMap("im_recent_cache")
+
+func init() {
+	expvar.Publish("im_recent_cache_hit_rate", expvar.Func(func() interface{} {
+		hits := statValue("range_hits") + statValue("hydrate_hits")
+		total := hits + statValue("range_misses") + statValue("hydrate_misses")
+		if total == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(total)
+	}))
+}
+
+func statValue(key string) int64 {
+	if v, ok := recentCacheStats.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// RedisRecentCache 使用 Sorted Set 保存每个会话最近 N 条完整消息。
+// Key：{prefix}{conversation_id}，Score：seq，Member：JSON 序列化的消息。
+type RedisRecentCache struct {
+	client    *redis.Client
+	keyPrefix string
+	size      int64
+	ttl       time.Duration
+}
+
+func NewRedisRecentCache(client *redis.Client, prefix string, size int64, ttl time.Duration) *RedisRecentCache {
+	if size <= 0 {
+		size = 200
+	}
+	return &RedisRecentCache{
+		client:    client,
+		keyPrefix: prefix,
+		size:      size,
+		ttl:       ttl,
+	}
+}
+
+// Put 写入或覆盖（同 seq）一条消息，并裁剪到最近 size 条。
+// 覆盖语义使撤回、编辑等变更可以直接反映到所有读者。
+func (c *RedisRecentCache) Put(ctx context.Context, msg model.TimelineMessage) error {
+	if c.client == nil {
+		return nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	key := c.keyPrefix + msg.ConversationID
+	seq := strconv.FormatUint(msg.Seq, 10)
+
+	pipe := c.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, seq, seq)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(msg.Seq), Member: data})
+	pipe.ZRemRangeByRank(ctx, key, 0, -c.size-1)
+	if c.ttl > 0 {
+		pipe.Expire(ctx, key, c.ttl)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Get 按 seq 批量读取缓存，未命中的 seq 不出现在返回结果中。
+func (c *RedisRecentCache) Get(ctx context.Context, conversationID string, seqs []uint64) (map[uint64]model.TimelineMessage, error) {
+	out := make(map[uint64]model.TimelineMessage, len(seqs))
+	if c.client == nil || len(seqs) == 0 {
+		return out, nil
+	}
+	minSeq, maxSeq := seqs[0], seqs[0]
+	wanted := make(map[uint64]struct{}, len(seqs))
+	for _, seq := range seqs {
+		wanted[seq] = struct{}{}
+		if seq < minSeq {
+			minSeq = seq
+		}
+		if seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+
+	members, err := c.client.ZRangeByScore(ctx, c.keyPrefix+conversationID, &redis.ZRangeBy{
+		Min: strconv.FormatUint(minSeq, 10),
+		Max: strconv.FormatUint(maxSeq, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		var msg model.TimelineMessage
+		if err := json.Unmarshal([]byte(member), &msg); err != nil {
+			continue
+		}
+		if _, ok := wanted[msg.Seq]; ok {
+			out[msg.Seq] = msg
+		}
+	}
+	return out, nil
+}
+
+// Range 读取缓存窗口内 seq > afterSeq 的消息，按 seq 升序。
+func (c *RedisRecentCache) Range(ctx context.Context, conversationID string, afterSeq int64, limit int) ([]model.TimelineMessage, bool, error) {
+	if c.client == nil {
+		return nil, false, nil
+	}
+	key := c.keyPrefix + conversationID
+	lowest, err := c.client.ZRangeWithScores(ctx, key, 0, 0).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(lowest) == 0 || int64(lowest[0].Score) > afterSeq+1 {
+		return nil, false, nil
+	}
+
+	members, err := c.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "(" + strconv.FormatInt(afterSeq, 10),
+		Max:   "+inf",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	msgs := make([]model.TimelineMessage, 0, len(members))
+	for _, member := range members {
+		var msg model.TimelineMessage
+		if err := json.Unmarshal([]byte(member), &msg); err != nil {
+			return nil, false, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, true, nil
+}
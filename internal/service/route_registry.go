@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// routeOwnedBy 是路由脚本共用的 Lua 片段：判断字段值是否登记在 node 上，兼容不带时间戳的旧格式。
+const routeOwnedBy = `
+local function owned_by(value, node)
+	if not value then
+		return false
+	end
+	if value == node then
+		return true
+	end
+	return string.sub(value, 1, #node + 1) == node .. '|' and tonumber(string.sub(value, #node + 2)) ~= nil
+end
+`
+
+// touchRouteScript 登记或续期设备路由，并顺带删除该用户下超过 ttl 未续期的设备（如宕机节点遗留的记录）。
+// KEYS[1]=用户 key；ARGV: device_id、node_id、当前时间(ms)、ttl(ms)、key 过期时间(s)、force。
+// force=0（心跳续期）时，设备已登记到其他节点则不覆盖。
+var touchRouteScript = redis.NewScript(routeOwnedBy + `
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if ARGV[6] == '0' and cur and not owned_by(cur, ARGV[2]) then
+	return 0
+end
+local now, ttl = tonumber(ARGV[3]), tonumber(ARGV[4])
+local fields = redis.call('HGETALL', KEYS[1])
+for i = 1, #fields, 2 do
+	local ts = tonumber(string.match(fields[i + 1], '|(%d+)$'))
+	if fields[i] ~= ARGV[1] and ts and now - ts > ttl then
+		redis.call('HDEL', KEYS[1], fields[i])
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2] .. '|' .. ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// unregisterScript 仅当设备仍登记在本节点时才删除，避免误删已迁移到其他节点的新连接。
+var unregisterScript = redis.NewScript(routeOwnedBy + `
+if owned_by(redis.call('HGET', KEYS[1], ARGV[1]), ARGV[2]) then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// routeLookupBatch 是 Lookup 单次 pipeline 查询的用户数上限，避免大群扇出时单批过大。
+const routeLookupBatch = 500
+
+// RedisRouteRegistry 在 Redis Hash 中记录用户各设备所在的网关节点，供跨节点推送路由。
+// Key：{prefix}{user_id}，Field：device_id -> {node_id}|{最近心跳时间(ms)}。
+// 每个设备单独记录心跳时间，Lookup 忽略超过 ttl 未续期的设备：同一用户仍有其他设备在线、
+// key 持续被续期时，宕机节点遗留的设备记录也不会继续收到转发。key 本身同样带过期时间。
+type RedisRouteRegistry struct {
+	client    *redis.Client
+	keyPrefix string
+	nodeID    string
+	ttl       time.Duration
+}
+
+func NewRedisRouteRegistry(client *redis.Client, prefix, nodeID string, ttl time.Duration) *RedisRouteRegistry {
+	return &RedisRouteRegistry{client: client, keyPrefix: prefix, nodeID: nodeID, ttl: ttl}
+}
+
+// Register 登记设备连接在本节点，覆盖该设备在其他节点的旧记录。
+func (r *RedisRouteRegistry) Register(ctx context.Context, userID, deviceID string) error {
+	return r.touch(ctx, userID, deviceID, true)
+}
+
+// Refresh 续期设备的路由记录，随心跳调用；设备已迁移到其他节点时不覆盖。
+func (r *RedisRouteRegistry) Refresh(ctx context.Context, userID, deviceID string) error {
+	return r.touch(ctx, userID, deviceID, false)
+}
+
+func (r *RedisRouteRegistry) touch(ctx context.Context, userID, deviceID string, force bool) error {
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	return touchRouteScript.Run(ctx, r.client, []string{r.keyPrefix + userID},
+		deviceID, r.nodeID, time.Now().UnixMilli(), r.ttl.Milliseconds(), int64(r.ttl.Seconds()), forceArg).Err()
+}
+
+// Unregister 注销本节点上的设备连接。
+func (r *RedisRouteRegistry) Unregister(ctx context.Context, userID, deviceID string) error {
+	return unregisterScript.Run(ctx, r.client, []string{r.keyPrefix + userID}, deviceID, r.nodeID).Err()
+}
+
+// Lookup 返回 targets 在各节点上的分布：node_id -> 该节点上有连接的用户。实现 RouteLookup。
+// 按 routeLookupBatch 分批 pipeline 查询，每批一次往返；超过 ttl 未续期的设备不计入。
+func (r *RedisRouteRegistry) Lookup(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	now := time.Now().UnixMilli()
+	for start := 0; start < len(userIDs); start += routeLookupBatch {
+		batch := userIDs[start:min(start+routeLookupBatch, len(userIDs))]
+		pipe := r.client.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(batch))
+		for i, uid := range batch {
+			cmds[i] = pipe.HGetAll(ctx, r.keyPrefix+uid)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, uid := range batch {
+			for _, node := range liveRouteNodes(cmds[i].Val(), now, r.ttl.Milliseconds()) {
+				out[node] = append(out[node], uid)
+			}
+		}
+	}
+	return out, nil
+}
+
+// liveRouteNodes 返回未过期设备所在的节点（去重）；不带时间戳的旧格式记录视为有效，由 key 过期兜底。
+func liveRouteNodes(fields map[string]string, now, ttlMs int64) []string {
+	var nodes []string
+	for _, value := range fields {
+		node := value
+		if i := strings.LastIndexByte(value, '|'); i >= 0 {
+			if ts, err := strconv.ParseInt(value[i+1:], 10, 64); err == nil {
+				if now-ts > ttlMs {
+					continue
+				}
+				node = value[:i]
+			}
+		}
+		if !containsUser(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// RedisNodeBus 通过 Redis Pub/Sub 向指定节点投递数据，每个节点订阅 {prefix}{node_id} 频道。
+// Pub/Sub 不持久化，节点不在线时投递丢失，由客户端重连后的拉取兜底。
+type RedisNodeBus struct {
+	client        *redis.Client
+	channelPrefix string
+}
+
+func NewRedisNodeBus(client *redis.Client, prefix string) *RedisNodeBus {
+	return &RedisNodeBus{client: client, channelPrefix: prefix}
+}
+
+// Send 向节点频道发布数据。
+func (b *RedisNodeBus) Send(ctx context.Context, nodeID string, data []byte) error {
+	return b.client.Publish(ctx, b.channelPrefix+nodeID, data).Err()
+}
+
+// Receive 订阅本节点频道，ctx 结束时关闭返回的 channel。
+func (b *RedisNodeBus) Receive(ctx context.Context, nodeID string) (<-chan []byte, error) {
+	sub := b.client.Subscribe(ctx, b.channelPrefix+nodeID)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+	out := make(chan []byte, 1024)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				out <- []byte(msg.Payload)
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestLiveRouteNodesSkipsStaleDevices(t *testing.T) {
+	now := int64(1_000_000)
+	fields := map[string]string{
+		"phone":  "node-a|999000", // 1s 前续期
+		"pc":     "node-b|100000", // 宕机节点遗留，早已超过 ttl
+		"pad":    "node-a|998000",
+		"legacy": "node-c", // 旧格式，没有时间戳
+	}
+	nodes := liveRouteNodes(fields, now, 60_000)
+	sort.Strings(nodes)
+	if len(nodes) != 2 || nodes[0] != "node-a" || nodes[1] != "node-c" {
+		t.Fatalf("expected node-a and node-c, got %v", nodes)
+	}
+}
@@ -12,6 +12,11 @@ type SeqGenerator interface {
 	NextSeq(ctx context.Context, conversationID string) (uint64, error)
 }
 
+// SeqReader 读取会话当前已分配的最大 seq，拉取时据此判断缓存是否覆盖到会话末尾。
+type SeqReader interface {
+	CurrentSeq(ctx context.Context, conversationID string) (uint64, error)
+}
+
 // RedisSeqGenerator 使用 Redis INCR 生成 per-conversation 序号。
 type RedisSeqGenerator struct {
 	client *redis.Client
@@ -33,3 +38,18 @@ func (g *RedisSeqGenerator) NextSeq(ctx context.Context, conversationID string)
 	}
 	return uint64(val), nil
 }
+
+// CurrentSeq 返回会话当前的 seq 计数；key 不存在时返回 0。
+func (g *RedisSeqGenerator) CurrentSeq(ctx context.Context, conversationID string) (uint64, error) {
+	if g.client == nil {
+		return 0, errors.New("redis client is nil")
+	}
+	val, err := g.client.Get(ctx, g.prefix+conversationID).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return val, nil
+}
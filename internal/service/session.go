@@ -0,0 +1,93 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const sessionWriteTimeout = 10 * time.Second // 写超时防止阻塞
+
+// 会话的下行传输方式
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// Stream 是 WebSocket 之外的下行通道（如 SSE），由 handler 实现，需自行处理写超时。
+type Stream interface {
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// Session 封装单条客户端连接（WebSocket 或 Stream）。gorilla/websocket 不允许并发写，
+// 读循环的响应与 PushService 的推送都必须经由 WriteJSON 串行化。
+type Session struct {
+	UserID      string
+	DeviceID    string // 同一用户多端在线时区分设备，缺省为 DefaultDeviceID
+	Transport   string // 见 Transport*
+	ConnectedAt time.Time
+	RemoteAddr  string
+
+	conn   *websocket.Conn
+	stream Stream
+	mu     sync.Mutex
+	closed atomic.Bool
+}
+
+// DefaultDeviceID 客户端未指定 device_id 时使用，与单设备时代的行为一致（新连接踢掉旧连接）。
+const DefaultDeviceID = "default"
+
+func NewSession(userID, deviceID string, conn *websocket.Conn) *Session {
+	if deviceID == "" {
+		deviceID = DefaultDeviceID
+	}
+	sess := &Session{UserID: userID, DeviceID: deviceID, Transport: TransportWebSocket, ConnectedAt: time.Now(), conn: conn}
+	if conn != nil {
+		sess.RemoteAddr = conn.RemoteAddr().String()
+	}
+	return sess
+}
+
+// NewStreamSession 创建以 Stream 为下行通道的会话，上行指令由 handler 另行接收。
+func NewStreamSession(userID, deviceID, transport, remoteAddr string, stream Stream) *Session {
+	if deviceID == "" {
+		deviceID = DefaultDeviceID
+	}
+	return &Session{UserID: userID, DeviceID: deviceID, Transport: transport, ConnectedAt: time.Now(), RemoteAddr: remoteAddr, stream: stream}
+}
+
+// Conn 返回底层 WebSocket 连接，仅供读循环使用；Stream 会话返回 nil。
+func (s *Session) Conn() *websocket.Conn {
+	return s.conn
+}
+
+// WriteJSON 加锁写入并设置写超时。
+func (s *Session) WriteJSON(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream != nil {
+		return s.stream.WriteJSON(v)
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(sessionWriteTimeout))
+	return s.conn.WriteJSON(v)
+}
+
+// Close 关闭底层连接，可重复调用。
+func (s *Session) Close() error {
+	s.closed.Store(true)
+	if s.stream != nil {
+		return s.stream.Close()
+	}
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// Closed 报告会话是否已调用过 Close。
+func (s *Session) Closed() bool {
+	return s.closed.Load()
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"go-im/internal/model"
+)
+
+// signalStats 暴露在 /admin/debug/vars 的瞬时信令指标。
+var signalStats = expvar.NewMap("im_signal")
+
+var ErrInvalidSignal = errors.New("invalid signal")
+
+// 信令类型与状态
+const (
+	SignalTyping    = "typing"
+	SignalRecording = "recording"
+
+	SignalStart = "start"
+	SignalStop  = "stop"
+)
+
+// ConversationAuthorizer 校验用户是否为会话参与者并返回规范化后的会话信息，由 MessageService 实现。
+type ConversationAuthorizer interface {
+	Authorize(ctx context.Context, userID, conversationID string) (ConversationInfo, error)
+}
+
+// SignalEvent 是转发给其他参与者的瞬时信令，ExpiresIn 为 start 信号的有效期（ms）。
+type SignalEvent struct {
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	Kind           string `json:"kind"`
+	State          string `json:"state"`
+	ExpiresIn      int64  `json:"expires_in,omitempty"`
+}
+
+type SignalOptions struct {
+	MinInterval time.Duration // 同一用户在同一会话重复 start 的最小转发间隔，期间只续期不转发
+	TTL         time.Duration // 未收到 stop 时自动过期并代发 stop
+	MaxFanout   int           // 参与者超过该值的会话（大群）不转发
+}
+
+type signalKey struct {
+	conversationID string
+	userID         string
+	kind           string
+}
+
+// activeSignal 记录最近一次转发的 start。stop 后条目保留到限频间隔结束，
+// 使 start/stop 交替发送也受 MinInterval 约束。
+type activeSignal struct {
+	targets   []string
+	lastRelay time.Time
+	deadline  time.Time // 对端可见时为自动代发 stop 的时间，否则为条目清理时间
+	visible   bool      // 对端当前是否处于 start 状态
+}
+
+// SignalService 转发输入中、录音中等瞬时信令：只推送给在线参与者，
+// 不分配 seq、不落库、不经过 MQ；服务端限频并在 stop 丢失时自动过期。
+type SignalService struct {
+	auth   ConversationAuthorizer
+	pusher Pusher
+
+	minInterval time.Duration
+	ttl         time.Duration
+	maxFanout   int
+
+	mu     sync.Mutex
+	active map[signalKey]*activeSignal
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewSignalService(auth ConversationAuthorizer, pusher Pusher, opts SignalOptions) *SignalService {
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = 3 * time.Second
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 6 * time.Second
+	}
+	if opts.MaxFanout <= 0 {
+		opts.MaxFanout = DefaultReadDiffusionThreshold
+	}
+	s := &SignalService{
+		auth:        auth,
+		pusher:      pusher,
+		minInterval: opts.MinInterval,
+		ttl:         opts.TTL,
+		maxFanout:   opts.MaxFanout,
+		active:      make(map[signalKey]*activeSignal),
+		stop:        make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+// Relay 处理一次信令。距上次转发的 start 不足限频间隔的 start（包括 stop 之后再次 start）只续期不转发；
+// 对端未处于 start 状态时 stop 直接忽略。
+func (s *SignalService) Relay(ctx context.Context, userID, conversationID, kind, state string) error {
+	if (kind != SignalTyping && kind != SignalRecording) || (state != SignalStart && state != SignalStop) {
+		return ErrInvalidSignal
+	}
+	conv, err := s.auth.Authorize(ctx, userID, conversationID)
+	if err != nil {
+		return err
+	}
+	targets := excludeUser(conv.Participants, userID)
+	if len(targets) == 0 || len(targets) > s.maxFanout {
+		signalStats.Add("skipped", 1)
+		return nil
+	}
+
+	key := signalKey{conversationID: conv.ID, userID: userID, kind: kind}
+	now := time.Now()
+	s.mu.Lock()
+	cur, ok := s.active[key]
+	if state == SignalStop {
+		visible := ok && cur.visible
+		if visible {
+			cur.visible = false
+			cur.deadline = cur.lastRelay.Add(s.minInterval)
+		}
+		s.mu.Unlock()
+		if visible {
+			s.push(ctx, key, SignalStop, targets)
+		}
+		return nil
+	}
+	if ok && now.Sub(cur.lastRelay) < s.minInterval {
+		if cur.visible {
+			cur.deadline = now.Add(s.ttl)
+		}
+		s.mu.Unlock()
+		signalStats.Add("throttled", 1)
+		return nil
+	}
+	s.active[key] = &activeSignal{targets: targets, lastRelay: now, deadline: now.Add(s.ttl), visible: true}
+	s.mu.Unlock()
+
+	s.push(ctx, key, SignalStart, targets)
+	return nil
+}
+
+// Stop 停止后台过期循环。
+func (s *SignalService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *SignalService) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
+
+// expire 为超时未收到 stop 的信令代发 stop，并清理限频期已过的条目；推送在锁外进行。
+func (s *SignalService) expire(now time.Time) {
+	type expired struct {
+		key     signalKey
+		targets []string
+	}
+	var due []expired
+	s.mu.Lock()
+	for key, sig := range s.active {
+		if now.Before(sig.deadline) {
+			continue
+		}
+		delete(s.active, key)
+		if sig.visible {
+			due = append(due, expired{key: key, targets: sig.targets})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		signalStats.Add("expired", 1)
+		s.push(context.Background(), e.key, SignalStop, e.targets)
+	}
+}
+
+func (s *SignalService) push(ctx context.Context, key signalKey, state string, targets []string) {
+	if s.pusher == nil {
+		return
+	}
+	event := SignalEvent{ConversationID: key.conversationID, UserID: key.userID, Kind: key.kind, State: state}
+	if state == SignalStart {
+		event.ExpiresIn = s.ttl.Milliseconds()
+	}
+	signalStats.Add("relayed", 1)
+	if err := s.pusher.Broadcast(ctx, model.OutputPacket{Cmd: model.CmdSignal, Payload: event}, targets); err != nil {
+		log.Printf("转发信令失败 conv=%s user=%s kind=%s: %v", key.conversationID, key.userID, key.kind, err)
+	}
+}
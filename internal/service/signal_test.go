@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-im/internal/model"
+)
+
+func newSignalFixture(conv ConversationInfo) (*SignalService, *stubPusher) {
+	msgSvc := NewMessageService(newStubMsgRepo()).WithConversationRegistry(&countingResolver{info: conv})
+	pusher := &stubPusher{}
+	// TTL 足够长，避免后台循环干扰；过期逻辑直接调用 expire 验证
+	svc := NewSignalService(msgSvc, pusher, SignalOptions{MinInterval: time.Hour, TTL: time.Hour})
+	return svc, pusher
+}
+
+func TestSignalRelayThrottlesAndStops(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2", "u3"}}
+	svc, pusher := newSignalFixture(conv)
+	defer svc.Stop()
+	ctx := context.Background()
+
+	if err := svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStart); err != nil {
+		t.Fatalf("Relay returned error: %v", err)
+	}
+	// 限频间隔内重复 start 只续期
+	if err := svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStart); err != nil {
+		t.Fatalf("Relay returned error: %v", err)
+	}
+	if len(pusher.packets) != 1 || pusher.packets[0].Cmd != model.CmdSignal {
+		t.Fatalf("expected one relayed start, got %+v", pusher.packets)
+	}
+	if len(pusher.targets[0]) != 2 || containsUser(pusher.targets[0], "u1") {
+		t.Fatalf("signal should go to other participants only, got %v", pusher.targets[0])
+	}
+
+	if err := svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStop); err != nil {
+		t.Fatalf("Relay returned error: %v", err)
+	}
+	// 重复 stop 不再转发
+	if err := svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStop); err != nil {
+		t.Fatalf("Relay returned error: %v", err)
+	}
+	if len(pusher.packets) != 2 || pusher.packets[1].Payload.(SignalEvent).State != SignalStop {
+		t.Fatalf("expected start then stop, got %+v", pusher.packets)
+	}
+	// stop 不重置限频：间隔内交替 start/stop 不再转发
+	for i := 0; i < 3; i++ {
+		_ = svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStart)
+		_ = svc.Relay(ctx, "u1", conv.ID, SignalTyping, SignalStop)
+	}
+	if len(pusher.packets) != 2 {
+		t.Fatalf("start/stop flapping should be throttled, got %+v", pusher.packets)
+	}
+	// 限频期过后条目被清理，不代发 stop
+	svc.expire(time.Now().Add(2 * time.Hour))
+	if len(pusher.packets) != 2 || len(svc.active) != 0 {
+		t.Fatalf("expected silent cleanup, packets=%+v active=%d", pusher.packets, len(svc.active))
+	}
+
+	if err := svc.Relay(ctx, "u1", conv.ID, "dancing", SignalStart); !errors.Is(err, ErrInvalidSignal) {
+		t.Fatalf("expected ErrInvalidSignal, got %v", err)
+	}
+	if err := svc.Relay(ctx, "u9", conv.ID, SignalTyping, SignalStart); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("non-participant should be forbidden, got %v", err)
+	}
+}
+
+func TestSignalExpiresWithoutStop(t *testing.T) {
+	conv := ConversationInfo{ID: "private_u1_u2", Type: model.ConversationTypePrivate, Participants: []string{"u1", "u2"}}
+	svc, pusher := newSignalFixture(conv)
+	defer svc.Stop()
+
+	if err := svc.Relay(context.Background(), "u1", conv.ID, SignalRecording, SignalStart); err != nil {
+		t.Fatalf("Relay returned error: %v", err)
+	}
+	svc.expire(time.Now())
+	if len(pusher.packets) != 1 {
+		t.Fatalf("signal should not expire before TTL, got %+v", pusher.packets)
+	}
+	svc.expire(time.Now().Add(2 * time.Hour))
+	if len(pusher.packets) != 2 {
+		t.Fatalf("expected synthesized stop, got %+v", pusher.packets)
+	}
+	if ev := pusher.packets[1].Payload.(SignalEvent); ev.State != SignalStop || ev.Kind != SignalRecording || pusher.targets[1][0] != "u2" {
+		t.Fatalf("unexpected expiry event %+v to %v", ev, pusher.targets[1])
+	}
+}
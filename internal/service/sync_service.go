@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"go-im/internal/model"
+)
+
+const (
+	defaultSyncPageSize  = 20
+	maxSyncConversations = 500 // 单次同步的会话数上限
+)
+
+// RecentConversations 返回用户最近活跃的会话，由 ConversationService 实现。
+type RecentConversations interface {
+	RecentConversationIDs(ctx context.Context, userID string, limit int) ([]string, error)
+}
+
+// ConversationSync 是批量同步中单个会话的结果。
+type ConversationSync struct {
+	ConversationID string                  `json:"conversation_id"`
+	CursorSeq      int64                   `json:"cursor_seq"` // 本次同步使用的起始游标
+	LatestSeq      int64                   `json:"latest_seq"` // 会话当前最新 seq
+	NewCount       int64                   `json:"new_count"`  // cursor 之后的新消息数
+	LatestMessage  *model.TimelineMessage  `json:"latest_message,omitempty"`
+	Messages       []model.TimelineMessage `json:"messages,omitempty"` // cursor 之后的第一页
+	NextCursorSeq  int64                   `json:"next_cursor_seq"`
+	HasMore        bool                    `json:"has_more"`
+}
+
+// SyncResult 是批量同步的结果。Truncated 表示会话数超过上限，
+// 只返回了最活跃的 maxSyncConversations 个，其余会话需客户端带上游标再次同步。
+type SyncResult struct {
+	Conversations []ConversationSync `json:"conversations"`
+	Truncated     bool               `json:"truncated"`
+}
+
+// SyncConversations 重连后一次性同步多个会话。
+// cursors 为空时使用服务端 user_conversation_state 中记录的 last_ack_seq，
+// 并合并会话索引中最近活跃的会话（离线期间新建的单聊、群聊从未 ACK 过，游标为 0）；
+// 每个会话都经过成员校验并换成规范 ID，非成员或不存在的会话直接丢弃；
+// 会话按最新消息时间倒序，超过上限时截掉最不活跃的部分并标记 Truncated；
+// 只有存在新消息的会话才会拉取第一页。
+func (s *PullService) SyncConversations(ctx context.Context, userID string, cursors map[string]int64, pageSize int) (SyncResult, error) {
+	if pageSize <= 0 {
+		pageSize = defaultSyncPageSize
+	}
+	if len(cursors) == 0 {
+		states, err := s.store.ListAcks(ctx, userID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		cursors = make(map[string]int64, len(states))
+		for _, st := range states {
+			cursors[st.ConversationID] = st.LastAckSeq
+		}
+		if s.recent != nil {
+			// 多取一个，超过上限时由下方的截断逻辑标记 Truncated
+			recent, err := s.recent.RecentConversationIDs(ctx, userID, maxSyncConversations+1)
+			if err != nil {
+				return SyncResult{}, err
+			}
+			for _, convID := range recent {
+				if _, ok := cursors[convID]; !ok {
+					cursors[convID] = 0
+				}
+			}
+		}
+	}
+
+	cursors, err := s.authorizeCursors(ctx, userID, cursors)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	convIDs := make([]string, 0, len(cursors))
+	for convID := range cursors {
+		convIDs = append(convIDs, convID)
+	}
+	if len(convIDs) == 0 {
+		return SyncResult{Conversations: []ConversationSync{}}, nil
+	}
+
+	latestByConv, err := s.latestMessages(ctx, convIDs)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	// 先按活跃度排序再截断，保证截掉的是最久没有消息的会话；时间相同按 ID 排序保持稳定
+	sort.Slice(convIDs, func(i, j int) bool {
+		ti, tj := latestByConv[convIDs[i]].SendTime, latestByConv[convIDs[j]].SendTime
+		if ti != tj {
+			return ti > tj
+		}
+		return convIDs[i] < convIDs[j]
+	})
+	res := SyncResult{}
+	if len(convIDs) > maxSyncConversations {
+		convIDs = convIDs[:maxSyncConversations]
+		res.Truncated = true
+	}
+
+	res.Conversations = make([]ConversationSync, 0, len(convIDs))
+	for _, convID := range convIDs {
+		cursor := cursors[convID]
+		item := ConversationSync{ConversationID: convID, CursorSeq: cursor, NextCursorSeq: cursor}
+		if last, ok := latestByConv[convID]; ok {
+			item.LatestMessage = &last
+			item.LatestSeq = int64(last.Seq)
+		}
+		if item.LatestSeq > cursor {
+			item.NewCount = item.LatestSeq - cursor
+			page, err := s.PullForUser(ctx, userID, convID, cursor, pageSize)
+			if err != nil {
+				return SyncResult{}, err
+			}
+			item.Messages = page.Messages
+			item.NextCursorSeq = page.NextCursorSeq
+			item.HasMore = page.HasMore
+		}
+		res.Conversations = append(res.Conversations, item)
+	}
+	return res, nil
+}
+
+// authorizeCursors 校验用户是各会话的成员并将游标换到规范会话 ID 下；
+// 多个 ID 指向同一会话时取较小的游标，避免漏消息。未注入校验器时只过滤空 ID。
+func (s *PullService) authorizeCursors(ctx context.Context, userID string, cursors map[string]int64) (map[string]int64, error) {
+	out := make(map[string]int64, len(cursors))
+	for convID, cursor := range cursors {
+		if convID == "" {
+			continue
+		}
+		if s.auth != nil {
+			conv, err := s.auth.Authorize(ctx, userID, convID)
+			if errors.Is(err, ErrForbidden) || errors.Is(err, ErrConversationNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			convID = conv.ID
+		}
+		if prev, ok := out[convID]; ok && prev <= cursor {
+			continue
+		}
+		out[convID] = cursor
+	}
+	return out, nil
+}
+
+// latestMessages 分批查询各会话的最新消息，每批不超过 maxSyncConversations 个会话。
+func (s *PullService) latestMessages(ctx context.Context, convIDs []string) (map[string]model.TimelineMessage, error) {
+	latestByConv := make(map[string]model.TimelineMessage, len(convIDs))
+	for start := 0; start < len(convIDs); start += maxSyncConversations {
+		end := start + maxSyncConversations
+		if end > len(convIDs) {
+			end = len(convIDs)
+		}
+		latest, err := s.store.ListLatestMessages(ctx, convIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range latest {
+			latestByConv[msg.ConversationID] = msg
+		}
+	}
+	return latestByConv, nil
+}
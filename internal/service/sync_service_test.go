@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+func TestSyncConversationsUsesServerAcks(t *testing.T) {
+	msgs := append(convMessages("a", 1, 2, 3), convMessages("b", 1, 2)...)
+	msgs[2].SendTime = 100 // a 的最新消息
+	msgs[4].SendTime = 200 // b 的最新消息
+	store := &stubPullStore{
+		msgs: msgs,
+		acks: []model.UserConversationState{
+			{UserID: "u1", ConversationID: "a", LastAckSeq: 1},
+			{UserID: "u1", ConversationID: "b", LastAckSeq: 2},
+		},
+	}
+	svc := NewPullService(store)
+
+	out, err := svc.SyncConversations(context.Background(), "u1", nil, 1)
+	if err != nil {
+		t.Fatalf("SyncConversations error: %v", err)
+	}
+	res := out.Conversations
+	if len(res) != 2 || res[0].ConversationID != "b" {
+		t.Fatalf("expected 2 conversations ordered by activity, got %+v", res)
+	}
+	b, a := res[0], res[1]
+	if b.NewCount != 0 || len(b.Messages) != 0 || b.LatestMessage == nil || b.LatestSeq != 2 {
+		t.Fatalf("up-to-date conversation should carry only latest message: %+v", b)
+	}
+	if a.NewCount != 2 || len(a.Messages) != 1 || a.Messages[0].Seq != 2 || !a.HasMore || a.NextCursorSeq != 2 {
+		t.Fatalf("unexpected first page for a: %+v", a)
+	}
+	if store.calls != 1 {
+		t.Fatalf("expected a single page query, got %d", store.calls)
+	}
+}
+
+func TestSyncConversationsWithClientCursors(t *testing.T) {
+	store := &stubPullStore{msgs: convMessages("a", 1, 2, 3)}
+	svc := NewPullService(store)
+
+	out, err := svc.SyncConversations(context.Background(), "u1", map[string]int64{"a": 0, "empty": 0}, 0)
+	if err != nil {
+		t.Fatalf("SyncConversations error: %v", err)
+	}
+	res := out.Conversations
+	if out.Truncated {
+		t.Fatalf("two conversations should not be truncated")
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(res))
+	}
+	if res[0].ConversationID != "a" || res[0].NewCount != 3 || len(res[0].Messages) != 3 || res[0].HasMore {
+		t.Fatalf("unexpected result for a: %+v", res[0])
+	}
+	if res[1].LatestMessage != nil || res[1].NewCount != 0 {
+		t.Fatalf("empty conversation should have no latest message: %+v", res[1])
+	}
+}
+
+func TestSyncConversationsTruncatesLeastActive(t *testing.T) {
+	var msgs []model.TimelineMessage
+	cursors := make(map[string]int64)
+	for i := 0; i <= maxSyncConversations; i++ {
+		conv := fmt.Sprintf("c%03d", i)
+		m := convMessages(conv, 1)[0]
+		m.SendTime = int64(i)
+		msgs = append(msgs, m)
+		cursors[conv] = 1
+	}
+	store := &stubPullStore{msgs: msgs}
+	svc := NewPullService(store)
+
+	out, err := svc.SyncConversations(context.Background(), "u1", cursors, 0)
+	if err != nil {
+		t.Fatalf("SyncConversations error: %v", err)
+	}
+	if !out.Truncated || len(out.Conversations) != maxSyncConversations {
+		t.Fatalf("expected truncation to %d, got truncated=%v len=%d", maxSyncConversations, out.Truncated, len(out.Conversations))
+	}
+	// 最不活跃的 c000 被截掉，最活跃的排在最前
+	if out.Conversations[0].ConversationID != fmt.Sprintf("c%03d", maxSyncConversations) {
+		t.Fatalf("expected most active conversation first, got %s", out.Conversations[0].ConversationID)
+	}
+	for _, c := range out.Conversations {
+		if c.ConversationID == "c000" {
+			t.Fatalf("least active conversation should be truncated")
+		}
+	}
+}
+
+// stubAuthorizer 按会话 ID 返回会话信息，键可以是旧 ID，未登记的会话返回 ErrConversationNotFound。
+type stubAuthorizer map[string]ConversationInfo
+
+func (a stubAuthorizer) Authorize(ctx context.Context, userID, conversationID string) (ConversationInfo, error) {
+	conv, ok := a[conversationID]
+	if !ok {
+		return ConversationInfo{}, ErrConversationNotFound
+	}
+	if !containsUser(conv.Participants, userID) {
+		return conv, ErrForbidden
+	}
+	return conv, nil
+}
+
+func TestSyncConversationsDropsUnauthorizedCursors(t *testing.T) {
+	msgs := append(convMessages("mine", 1, 2), convMessages("secret", 1, 2)...)
+	store := &stubPullStore{msgs: msgs}
+	mine := ConversationInfo{ID: "mine", Participants: []string{"u1", "u2"}}
+	svc := NewPullService(store).WithAuthorizer(stubAuthorizer{
+		"mine":   mine,
+		"legacy": mine,
+		"secret": {ID: "secret", Participants: []string{"u2", "u3"}},
+	})
+
+	cursors := map[string]int64{"mine": 1, "legacy": 0, "secret": 0, "missing": 0}
+	out, err := svc.SyncConversations(context.Background(), "u1", cursors, 0)
+	if err != nil {
+		t.Fatalf("SyncConversations error: %v", err)
+	}
+	if len(out.Conversations) != 1 {
+		t.Fatalf("expected only the member conversation, got %+v", out.Conversations)
+	}
+	// 旧 ID 与规范 ID 合并到规范 ID 下，取较小的游标
+	if c := out.Conversations[0]; c.ConversationID != "mine" || c.CursorSeq != 0 || len(c.Messages) != 2 {
+		t.Fatalf("unexpected conversation %+v", c)
+	}
+}
+
+func TestSyncConversationsIncludesUnackedConversations(t *testing.T) {
+	store := &stubPullStore{
+		msgs: append(convMessages("acked", 1, 2), convMessages("fresh", 1)...),
+		acks: []model.UserConversationState{{UserID: "u1", ConversationID: "acked", LastAckSeq: 2}},
+	}
+	index := newStubConvIndex()
+	_ = index.Touch(context.Background(), "acked", 100, []string{"u1"})
+	_ = index.Touch(context.Background(), "fresh", 200, []string{"u1"})
+	svc := NewPullService(store).WithRecentConversations(NewConversationService(index, store))
+
+	out, err := svc.SyncConversations(context.Background(), "u1", nil, 0)
+	if err != nil {
+		t.Fatalf("SyncConversations error: %v", err)
+	}
+	var fresh *ConversationSync
+	for i := range out.Conversations {
+		if out.Conversations[i].ConversationID == "fresh" {
+			fresh = &out.Conversations[i]
+		}
+	}
+	if len(out.Conversations) != 2 || fresh == nil {
+		t.Fatalf("expected never-acked conversation in sync, got %+v", out.Conversations)
+	}
+	if fresh.CursorSeq != 0 || fresh.NewCount != 1 || len(fresh.Messages) != 1 {
+		t.Fatalf("never-acked conversation should sync from cursor 0, got %+v", fresh)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-im/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ResolveReply 查找被回复的消息，不存在、不属于该会话或为系统事件时返回 ErrMessageNotFound。
+// 已撤回的消息仍可被引用，客户端按 status 展示为“已撤回”。
+func (s *MessageService) ResolveReply(ctx context.Context, conv ConversationInfo, replyToMsgID string) (*model.TimelineMessage, error) {
+	target, err := s.msgRepo.FindByMsgID(ctx, replyToMsgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if target.ConversationID != conv.ID || target.MsgType >= model.MsgTypeRecall {
+		return nil, ErrMessageNotFound
+	}
+	return target, nil
+}
+
+// attachReply 填充回复引用；话题回复归属到被回复消息所在话题的根消息（话题不嵌套），
+// 话题内 seq 与根消息回复数由仓储在写入事务中分配。
+func (s *MessageService) attachReply(ctx context.Context, conv ConversationInfo, msg *model.TimelineMessage, payload ChatPayload) error {
+	if payload.ReplyToMsgID == "" {
+		return nil
+	}
+	target, err := s.ResolveReply(ctx, conv, payload.ReplyToMsgID)
+	if err != nil {
+		return err
+	}
+	msg.ReplyToMsgID = target.MsgID
+	msg.ReplyToSeq = target.Seq
+	if payload.InThread {
+		msg.ThreadRootID = target.ThreadRootID
+		if msg.ThreadRootID == "" {
+			msg.ThreadRootID = target.MsgID
+		}
+	}
+	return nil
+}
+
+// touchThreadRoot 话题回复写入后刷新最近消息缓存中的根消息，使回复数对拉取方可见。
+func (s *MessageService) touchThreadRoot(ctx context.Context, msg *model.TimelineMessage) {
+	if msg.ThreadRootID == "" || s.recent == nil {
+		return
+	}
+	root, err := s.msgRepo.FindByMsgID(ctx, msg.ThreadRootID)
+	if err != nil {
+		log.Printf("查询话题根消息失败 root=%s: %v", msg.ThreadRootID, err)
+		return
+	}
+	if err := s.recent.Put(ctx, *root); err != nil {
+		log.Printf("更新最近消息缓存失败 conv=%s msg_id=%s: %v", root.ConversationID, root.MsgID, err)
+	}
+}
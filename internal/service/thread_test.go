@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-im/internal/model"
+)
+
+func TestHandleChatThreadRepliesShareRoot(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2"}}
+	svc, repo, cache, _ := newMessageFixture(conv, 0)
+	ctx := context.Background()
+
+	send := func(msgID string, payload ChatPayload) (model.OutputPacket, error) {
+		return svc.HandleChat(ctx, "u2", model.InputPacket{Cmd: model.CmdChat, ConversationId: conv.ID, MsgId: msgID}, payload)
+	}
+	if _, err := send("r1", ChatPayload{Content: "first", ReplyToMsgID: "m1", InThread: true}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	// 回复话题内的回复，仍归属原根消息
+	if _, err := send("r2", ChatPayload{Content: "second", ReplyToMsgID: "r1", InThread: true}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+	// 普通引用不计入话题
+	if _, err := send("q1", ChatPayload{Content: "quote", ReplyToMsgID: "m1"}); err != nil {
+		t.Fatalf("HandleChat returned error: %v", err)
+	}
+
+	r2 := repo.store["r2"]
+	if r2.ThreadRootID != "m1" || r2.ThreadSeq != 2 || r2.ReplyToMsgID != "r1" || r2.ReplyToSeq != repo.store["r1"].Seq {
+		t.Fatalf("unexpected thread reply %+v", r2)
+	}
+	if q1 := repo.store["q1"]; q1.ThreadRootID != "" || q1.ReplyToSeq != 1 {
+		t.Fatalf("quote should reference without joining thread, got %+v", q1)
+	}
+	if root := repo.store["m1"]; root.ReplyCount != 2 {
+		t.Fatalf("expected root reply count 2, got %d", root.ReplyCount)
+	}
+	if cached := cache.msgs[1]; cached.ReplyCount != 2 {
+		t.Fatalf("recent cache should hold root with reply count, got %+v", cached)
+	}
+}
+
+func TestHandleChatRejectsReplyToOtherConversation(t *testing.T) {
+	conv := ConversationInfo{ID: "group_1", Type: model.ConversationTypeGroup, Participants: []string{"u1", "u2"}}
+	svc, repo, _, _ := newMessageFixture(conv, 0)
+	repo.store["x1"] = &model.TimelineMessage{MsgID: "x1", ConversationID: "group_2", Seq: 1, SenderID: "u9"}
+
+	out, err := svc.HandleChat(context.Background(), "u2", model.InputPacket{Cmd: model.CmdChat, ConversationId: conv.ID, MsgId: "bad"}, ChatPayload{Content: "hi", ReplyToMsgID: "x1"})
+	if !errors.Is(err, ErrMessageNotFound) || out.Code != 404 {
+		t.Fatalf("expected 404 ErrMessageNotFound, got code=%d err=%v", out.Code, err)
+	}
+	if _, ok := repo.store["bad"]; ok {
+		t.Fatalf("rejected reply should not be saved")
+	}
+}
+
+func TestPullThreadPagesByThreadSeq(t *testing.T) {
+	store := &stubPullStore{msgs: []model.TimelineMessage{
+		{MsgID: "m1", ConversationID: "c1", Seq: 1, ReplyCount: 3},
+		{MsgID: "r1", ConversationID: "c1", Seq: 2, ThreadRootID: "m1", ThreadSeq: 1},
+		{MsgID: "x", ConversationID: "c1", Seq: 3},
+		{MsgID: "r2", ConversationID: "c1", Seq: 4, ThreadRootID: "m1", ThreadSeq: 2},
+		{MsgID: "r3", ConversationID: "c1", Seq: 5, ThreadRootID: "m1", ThreadSeq: 3},
+	}}
+	svc := NewPullService(store).WithMessageFinder(store)
+
+	res, err := svc.PullThread(context.Background(), "c1", "m1", 0, 2)
+	if err != nil {
+		t.Fatalf("PullThread returned error: %v", err)
+	}
+	if res.Root.MsgID != "m1" || len(res.Messages) != 2 || !res.HasMore || res.NextCursorSeq != 2 {
+		t.Fatalf("unexpected first page %+v", res)
+	}
+	res, err = svc.PullThread(context.Background(), "c1", "m1", res.NextCursorSeq, 2)
+	if err != nil || len(res.Messages) != 1 || res.Messages[0].MsgID != "r3" || res.HasMore {
+		t.Fatalf("unexpected second page %+v err=%v", res, err)
+	}
+	if _, err := svc.PullThread(context.Background(), "c1", "r1", 0, 2); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("reply should not be usable as thread root, got %v", err)
+	}
+}
@@ -11,13 +11,57 @@ CREATE TABLE IF NOT EXISTS `timeline_message` (
     `seq` BIGINT UNSIGNED NOT NULL,         -- 会话内序列号（核心字段）
     `sender_id` VARCHAR(64) NOT NULL,       -- 发送者ID
     `content` VARCHAR(4096),                -- 消息内容（限制长度，防止超大消息）
-    `msg_type` TINYINT DEFAULT 1,           -- 1:文本, 2:图片
-    `status` TINYINT DEFAULT 0,             -- 0:发送中, 1:已送达, 2:已读
+    `msg_type` TINYINT DEFAULT 1,           -- 1:文本, 2:图片, >=100:系统事件（100 撤回, 101 编辑, 102 表情回应）
+    `status` TINYINT DEFAULT 0,             -- 0:发送中, 1:已送达, 2:已读, 3:已撤回
+    `version` INT DEFAULT 0,                -- 编辑版本号，0 表示未编辑
+    `reply_to_msg_id` VARCHAR(64) DEFAULT '', -- 引用/回复的消息
+    `reply_to_seq` BIGINT UNSIGNED DEFAULT 0, -- 被回复消息的会话内 seq
+    `thread_root_id` VARCHAR(64) DEFAULT '',  -- 所属话题的根消息，空表示不在话题内
+    `thread_seq` BIGINT UNSIGNED DEFAULT 0,   -- 话题内序列号
+    `reply_count` INT DEFAULT 0,              -- 话题根消息的回复数
+    `mentions` TEXT DEFAULT NULL,             -- 被 @ 的用户 ID（JSON 数组）
+    `mention_all` TINYINT(1) DEFAULT 0,       -- 是否 @所有人
     `send_time` BIGINT NOT NULL,            -- 发送时间戳
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     UNIQUE INDEX `uk_msg_id` (`msg_id`),                    -- 幂等去重索引
     UNIQUE INDEX `uk_conv_seq` (`conversation_id`, `seq`),  -- 核心：保证会话内seq唯一
-    INDEX `idx_conv_seq` (`conversation_id`, `seq`)         -- 核心：用于范围拉取
+    INDEX `idx_conv_seq` (`conversation_id`, `seq`),        -- 核心：用于范围拉取
+    INDEX `idx_thread` (`thread_root_id`, `thread_seq`)     -- 话题内拉取
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 1.1 消息编辑历史（version=0 为原始内容）
+CREATE TABLE IF NOT EXISTS `message_edit` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `msg_id` VARCHAR(64) NOT NULL,
+    `version` INT NOT NULL,
+    `content` VARCHAR(4096),
+    `editor_id` VARCHAR(64) NOT NULL,
+    `edited_at` BIGINT NOT NULL,
+    UNIQUE INDEX `uk_msg_version` (`msg_id`, `version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 1.2 消息表情回应（每个用户对同一消息的同一表情只记一次）
+CREATE TABLE IF NOT EXISTS `message_reaction` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `msg_id` VARCHAR(64) NOT NULL,
+    `emoji` VARCHAR(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL, -- 二进制比较，避免不同表情（如肤色变体）被排序规则视为相同而触发唯一键冲突
+    `user_id` VARCHAR(64) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX `uk_msg_emoji_user` (`msg_id`, `emoji`, `user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 1.3 @提及（@所有人 每条消息只写一行 user_id='@all'，读取时按群成员解析），用于“@我的”未读数与查询
+CREATE TABLE IF NOT EXISTS `message_mention` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `msg_id` VARCHAR(64) NOT NULL,
+    `conversation_id` VARCHAR(64) NOT NULL,
+    `seq` BIGINT UNSIGNED NOT NULL,
+    `user_id` VARCHAR(64) NOT NULL,           -- 被提及的用户，@所有人 为 '@all'
+    `sender_id` VARCHAR(64) NOT NULL,
+    `mention_all` TINYINT(1) DEFAULT 0,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX `uk_msg_user` (`msg_id`, `user_id`),
+    INDEX `idx_user_conv_seq` (`user_id`, `conversation_id`, `seq`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 -- 2. 用户表
@@ -33,8 +77,11 @@ CREATE TABLE IF NOT EXISTS `user_conversation_state` (
     `user_id` VARCHAR(64) NOT NULL,
     `conversation_id` VARCHAR(64) NOT NULL,
     `last_ack_seq` BIGINT UNSIGNED DEFAULT 0,  -- 用户在该会话的最后确认序号
+    `last_read_seq` BIGINT UNSIGNED DEFAULT 0, -- 用户在该会话的已读序号（旧库需 ALTER TABLE 补列）
+    `read_at` BIGINT NOT NULL DEFAULT 0,       -- last_read_seq 最近一次前进的时间（毫秒），旧库需 ALTER TABLE 补列
     `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    PRIMARY KEY (`user_id`, `conversation_id`)
+    PRIMARY KEY (`user_id`, `conversation_id`),
+    INDEX `idx_conv_read` (`conversation_id`, `last_read_seq`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 -- 4. 群成员表
@@ -42,9 +89,25 @@ CREATE TABLE IF NOT EXISTS `group_member` (
     `group_id` VARCHAR(64) NOT NULL,
     `user_id` VARCHAR(64) NOT NULL,
     `join_time` BIGINT NOT NULL,
+    `role` TINYINT NOT NULL DEFAULT 0,       -- 0:成员, 1:管理员, 2:群主
     PRIMARY KEY (`group_id`, `user_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+-- 5. 会话元数据表 (会话类型与参与者的唯一来源)
+CREATE TABLE IF NOT EXISTS `conversation` (
+    `conversation_id` VARCHAR(64) NOT NULL PRIMARY KEY, -- 单聊为规范化 ID（旧 ID 下已有消息时沿用旧 ID），群聊即 group_member.group_id
+    `type` TINYINT NOT NULL,                 -- 1:单聊, 2:群聊
+    `title` VARCHAR(128),
+    `avatar` VARCHAR(512),
+    `creator_id` VARCHAR(64),
+    `peer_a` VARCHAR(64),                    -- 单聊参与者（字典序较小）
+    `peer_b` VARCHAR(64),                    -- 单聊参与者（字典序较大）
+    `settings` TEXT,                         -- JSON 格式的会话设置
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    KEY `idx_peers` (`peer_a`, `peer_b`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 -- 插入测试数据
 INSERT INTO `user` (`user_id`, `nickname`) VALUES
     ('user_1', '张三'),
@@ -53,8 +116,12 @@ INSERT INTO `user` (`user_id`, `nickname`) VALUES
 ON DUPLICATE KEY UPDATE `nickname` = VALUES(`nickname`);
 
 -- 初始化一个测试群组
-INSERT INTO `group_member` (`group_id`, `user_id`, `join_time`) VALUES
-    ('group_1', 'user_1', UNIX_TIMESTAMP() * 1000),
-    ('group_1', 'user_2', UNIX_TIMESTAMP() * 1000),
-    ('group_1', 'user_3', UNIX_TIMESTAMP() * 1000)
+INSERT INTO `group_member` (`group_id`, `user_id`, `join_time`, `role`) VALUES
+    ('group_1', 'user_1', UNIX_TIMESTAMP() * 1000, 2),
+    ('group_1', 'user_2', UNIX_TIMESTAMP() * 1000, 0),
+    ('group_1', 'user_3', UNIX_TIMESTAMP() * 1000, 0)
 ON DUPLICATE KEY UPDATE `join_time` = VALUES(`join_time`);
+
+INSERT INTO `conversation` (`conversation_id`, `type`, `title`, `creator_id`) VALUES
+    ('group_1', 2, '测试群', 'user_1')
+ON DUPLICATE KEY UPDATE `title` = VALUES(`title`);